@@ -0,0 +1,230 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"encoding/json"
+)
+
+/**
+List the assets the invoker has bid on with their latest bid, the current high bid and the time left to bid. args[0] is an
+optional currency the bids are also shown in, converted with the exchange rates of the auction house.
+ */
+func (t *AuctionChaincode) getBidsForUser(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	user, err := getUserByEmail(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	var displayCurrency string
+	var rates *FxRates
+	if len(args) > 0 && len(args[0]) > 0 {
+		displayCurrency = args[0]
+		if err = checkCurrency("displayCurrency", displayCurrency); err != nil {
+			return errorResponse(err)
+		}
+		if rates, err = getFxRatesFromLedger(stub); err != nil {
+			return errorResponse(err)
+		}
+		if rates == nil || rates.rate(displayCurrency) == nil {
+			return errorResponse(newError(ERROR_NOT_FOUND, "displayCurrency", "There is no exchange rate for %v", displayCurrency))
+		}
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	indexIterator, err := stub.GetStateByPartialCompositeKey(COMPOSITE_KEY_BIDDER_ASSET, []string{user.Email})
+	if err != nil {
+		return errorResponse(err)
+	}
+	defer indexIterator.Close()
+
+	var activities = make([]BidActivity, 0)
+	for indexIterator.HasNext() {
+		responseRange, err := indexIterator.Next()
+		if err != nil {
+			return errorResponse(err)
+		}
+		//bidder~asset is {bidder}{asset}
+		_, keyParts, err := stub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return errorResponse(err)
+		}
+		assetId := keyParts[1]
+		assetObj, err := getAsset(stub, assetId)
+		if err != nil {
+			return errorResponse(err)
+		}
+		if assetObj == nil {
+			return errorResponse(newError(ERROR_NOT_FOUND, "", "Asset : %v is not found", assetId))
+		}
+
+		activity := BidActivity{
+			AssetId:   assetId,
+			AssetName: assetObj.Name,
+			Currency:  currencyOf(assetObj.Currency),
+			IsSold:    assetObj.IsSold,
+			BidEnd:    assetObj.BidEnd,
+		}
+		ownBidKey, err := getCompositeKey(stub, COMPOSITE_KEY_BID_ASSET_BIDDER, assetId, user.Email)
+		if err != nil {
+			return errorResponse(err)
+		}
+		ownBidBytes, err := stub.GetState(ownBidKey)
+		if err != nil {
+			return errorResponse(err)
+		}
+		if ownBidBytes != nil {
+			var ownBid Bid
+			if err = json.Unmarshal(ownBidBytes, &ownBid); err != nil {
+				return errorResponse(err)
+			}
+			activity.BidAmount = ownBid.BidAmount
+			activity.BidTime = ownBid.BidTime
+		}
+		highBid, highBidderEmail, _, err := getHighBid(stub, assetId, "")
+		if err != nil {
+			return errorResponse(err)
+		}
+		activity.HighBid = highBid
+		activity.IsLeading = highBidderEmail == user.Email
+		//an asset in a currency without a rate is left unconverted
+		if rates != nil && rates.rate(activity.Currency) != nil {
+			activity.DisplayCurrency = displayCurrency
+			activity.DisplayBidAmount = rates.convert(activity.BidAmount, activity.Currency, displayCurrency)
+			activity.DisplayHighBid = rates.convert(activity.HighBid, activity.Currency, displayCurrency)
+		}
+		if assetObj.BidEnd != nil && assetObj.BidEnd.After(*txTime) {
+			activity.SecondsRemaining = int64(assetObj.BidEnd.Sub(*txTime).Seconds())
+		}
+		activities = append(activities, activity)
+	}
+
+	return listSuccess(activities, "")
+}
+
+/**
+Find the high bid on an asset, the email of the high bidder and the emails of everybody who bid, leaving out the bid of
+excludeEmail if it is not empty. Ties go to the bidder found first, the same way declareWinnerForAsset picks the
+winner. The high bid is nil when there are no bids.
+ */
+func getHighBid(stub shim.ChaincodeStubInterface, assetId string, excludeEmail string) (*Money, string, []string, error) {
+	bidsIterator, err := stub.GetStateByPartialCompositeKey(COMPOSITE_KEY_BID_ASSET_BIDDER, []string{assetId})
+	if err != nil {
+		return nil, "", nil, err
+	}
+	defer bidsIterator.Close()
+
+	var highBid *Money
+	var highBidderEmail string
+	var bidders []string
+	for bidsIterator.HasNext() {
+		responseRange, err := bidsIterator.Next()
+		if err != nil {
+			return nil, "", nil, err
+		}
+		//asset~bidder is {asset}{bidder}
+		_, keyParts, err := stub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		var bid Bid
+		if err = json.Unmarshal(responseRange.Value, &bid); err != nil {
+			return nil, "", nil, err
+		}
+		if bid.BidAmount == nil || keyParts[1] == excludeEmail {
+			continue
+		}
+		bidders = append(bidders, keyParts[1])
+		if highBid == nil || bid.BidAmount.Cmp(highBid) > 0 {
+			highBid = bid.BidAmount
+			highBidderEmail = keyParts[1]
+		}
+	}
+	return highBid, highBidderEmail, bidders, nil
+}
+
+/**
+Set aside held for the bid of email on assetId, in place of what was held for it. A nil held gives back what was held.
+The bid is changed and the bidder is changed through users, the caller stores the bid and flushes users.
+ */
+func setBidHold(stub shim.ChaincodeStubInterface, journal *Journal, users *UserCache, assetId string, email string, bid *Bid, held *Money) error {
+	if bid.Held == nil && held == nil {
+		return nil
+	}
+	bidder, err := users.get(stub, email)
+	if err != nil {
+		return err
+	}
+	currency := currencyOf(bid.Currency)
+	if bid.Held != nil {
+		if _, err = journal.hold(stub, bidder, currency, JOURNAL_RELEASE, bid.Held.Neg(), assetId); err != nil {
+			return err
+		}
+	}
+	if held != nil {
+		if _, err = journal.hold(stub, bidder, currency, JOURNAL_HOLD, held, assetId); err != nil {
+			return err
+		}
+	}
+	bid.Held = held
+	users.put(bidder)
+	return nil
+}
+
+/**
+Give back what is held for the bids on an asset whose auction is over.
+ */
+func releaseHolds(stub shim.ChaincodeStubInterface, journal *Journal, users *UserCache, assetId string) error {
+	bidsIterator, err := stub.GetStateByPartialCompositeKey(COMPOSITE_KEY_BID_ASSET_BIDDER, []string{assetId})
+	if err != nil {
+		return err
+	}
+	defer bidsIterator.Close()
+	for bidsIterator.HasNext() {
+		responseRange, err := bidsIterator.Next()
+		if err != nil {
+			return err
+		}
+		var bid Bid
+		if err = json.Unmarshal(responseRange.Value, &bid); err != nil {
+			return err
+		}
+		if bid.Held == nil {
+			continue
+		}
+		//asset~bidder is {asset}{bidder}
+		_, keyParts, err := stub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return err
+		}
+		if err = setBidHold(stub, journal, users, assetId, keyParts[1], &bid, nil); err != nil {
+			return err
+		}
+		bidBytes, err := json.Marshal(bid)
+		if err != nil {
+			return err
+		}
+		if err = stub.PutState(responseRange.Key, bidBytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rankedBid is a bid on an asset with the email of its bidder, for ranking the
+// bids when the auction closes.
+type rankedBid struct {
+	email  string
+	amount *Money
+}
+
+/**
+Whether a bid of amount by bidderEmail ranks above the bid of otherAmount by otherEmail. Bids are found in key order,
+which is the order of the bidder emails, and the first of two equal bids wins.
+ */
+func outbids(amount *Money, bidderEmail string, otherAmount *Money, otherEmail string) bool {
+	cmp := amount.Cmp(otherAmount)
+	return cmp > 0 || (cmp == 0 && bidderEmail < otherEmail)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const (
+	MAX_TAGS = 10
+)
+
+func (t *AuctionChaincode) addCategory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	org, _ := getMSPAttr(stub, MSP_ATTRIBUTE_ORG)
+	if org != "Org2" {
+		return unauthorized("Only Auction house users are allowed to invoke this function")
+	}
+
+	var category Category
+	err := decodeInput(args[0], &category)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if err = validateCategoryInput(&category); err != nil {
+		return errorResponse(err)
+	}
+
+	categoryKey, err := getCompositeKey(stub, COMPOSITE_KEY_CATEGORY, category.CategoryId)
+	if err != nil {
+		return errorResponse(err)
+	}
+	existing, err := stub.GetState(categoryKey)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if existing != nil {
+		return errorResponse(newError(ERROR_ALREADY_EXISTS, "categoryId", "Category %v already exists", category.CategoryId))
+	}
+
+	category.DocType = reflect.TypeOf(category).Name()
+	categoryBytes, err := json.Marshal(category)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if err = stub.PutState(categoryKey, []byte(categoryBytes)); err != nil {
+		return errorResponse(err)
+	}
+	return invokeSuccess(stub, category, nil)
+}
+
+func (t *AuctionChaincode) getCategories(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	categoriesIterator, err := stub.GetStateByPartialCompositeKey(COMPOSITE_KEY_CATEGORY, []string{})
+	if err != nil {
+		return errorResponse(err)
+	}
+	defer categoriesIterator.Close()
+
+	var categories = make([]Category, 0)
+	for categoriesIterator.HasNext() {
+		responseRange, err := categoriesIterator.Next()
+		if err != nil {
+			return errorResponse(err)
+		}
+		var category Category
+		if err = json.Unmarshal(responseRange.Value, &category); err != nil {
+			return errorResponse(err)
+		}
+		categories = append(categories, category)
+	}
+	return listSuccess(categories, "")
+}
+
+/**
+Browse the assets of a category. args are the category id, an optional page size and an optional bookmark.
+ */
+func (t *AuctionChaincode) getAssetsByCategory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	categoryId := args[0]
+	if len(categoryId) == 0 {
+		return errorResponse(newError(ERROR_REQUIRED, "categoryId", "Category ID is mandatory"))
+	}
+	size := ""
+	if len(args) > 1 {
+		size = args[1]
+	}
+	pageSize, err := parseCountArg("pageSize", size, DEFAULT_PAGE_SIZE, MAX_PAGE_SIZE,
+		fmt.Sprintf("Page size must be a number between 1 and %v", MAX_PAGE_SIZE))
+	if err != nil {
+		return errorResponse(err)
+	}
+	var bookmark string
+	if len(args) > 2 {
+		bookmark = args[2]
+	}
+
+	indexIterator, metadata, err := stub.GetStateByPartialCompositeKeyWithPagination(COMPOSITE_KEY_CATEGORY_ASSET, []string{categoryId}, int32(pageSize), bookmark)
+	if err != nil {
+		return errorResponse(err)
+	}
+	defer indexIterator.Close()
+
+	assets := make([]Asset, 0)
+	for indexIterator.HasNext() {
+		responseRange, err := indexIterator.Next()
+		if err != nil {
+			return errorResponse(err)
+		}
+		//category~asset is {category}{asset}
+		_, keyParts, err := stub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return errorResponse(err)
+		}
+		assetObj, err := getAsset(stub, keyParts[1])
+		if err != nil {
+			return errorResponse(err)
+		}
+		if assetObj == nil {
+			return errorResponse(newError(ERROR_NOT_FOUND, "", "Asset : %v in category %v is not found", keyParts[1], categoryId))
+		}
+		assets = append(assets, *assetObj)
+	}
+	return listSuccess(assets, metadata.GetBookmark())
+}
+
+/**
+Check the category of a new asset and tidy up its tags: trimmed, lower case, without duplicates.
+ */
+func validateAssetCategory(stub shim.ChaincodeStubInterface, assetObj *Asset) error {
+	if len(assetObj.Category) > 0 {
+		categoryKey, err := getCompositeKey(stub, COMPOSITE_KEY_CATEGORY, assetObj.Category)
+		if err != nil {
+			return err
+		}
+		category, err := stub.GetState(categoryKey)
+		if err != nil {
+			return err
+		}
+		if category == nil {
+			return newError(ERROR_NOT_FOUND, "category", "Category %v is not defined", assetObj.Category)
+		}
+	}
+
+	var tags []string
+	seen := make(map[string]bool)
+	for _, tag := range assetObj.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if len(tag) == 0 || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	if len(tags) > MAX_TAGS {
+		return newError(ERROR_TOO_MANY, "tags", "An asset can carry at most %v tags", MAX_TAGS)
+	}
+	assetObj.Tags = tags
+	return nil
+}
+
+func putCategoryIndex(stub shim.ChaincodeStubInterface, assetObj *Asset) error {
+	if len(assetObj.Category) == 0 {
+		return nil
+	}
+	indexKey, err := getCompositeKey(stub, COMPOSITE_KEY_CATEGORY_ASSET, assetObj.Category, assetObj.AssetId)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(indexKey, []byte{0x00})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+/**
+List an asset in category whose bidding opens in an hour and runs for duration. Returns the generated asset id.
+ */
+func (f *auctionFixture) addAssetInCategory(seller *testIdentity, name string, category string, duration time.Duration) string {
+	f.t.Helper()
+	var asset Asset
+	decodeEntity(f.t, f.mustInvoke(seller, "addAssetForBid", fmt.Sprintf(`{"name":%q,"price":"10","category":%q,"tags":[" Blue ","blue"],"bidStart":%q,"bidEnd":%q}`,
+		name, category, f.now.Add(time.Hour).Format(time.RFC3339), f.now.Add(time.Hour+duration).Format(time.RFC3339))), &asset)
+	return asset.AssetId
+}
+
+func TestGetCategories(t *testing.T) {
+	f := newAuctionFixture(t)
+	f.expectErrorCode(ERROR_UNAUTHORIZED, "", f.alice, "addCategory", `{"categoryId":"art","name":"Art"}`)
+	f.mustInvoke(f.house, "addCategory", `{"categoryId":"toys","name":"Toys"}`)
+	f.mustInvoke(f.house, "addCategory", `{"categoryId":"art","name":"Art"}`)
+	f.expectErrorCode(ERROR_ALREADY_EXISTS, "categoryId", f.house, "addCategory", `{"categoryId":"art","name":"Fine art"}`)
+
+	var categories []Category
+	decodeItems(t, f.mustInvoke(f.bob, "getCategories"), &categories)
+	if len(categories) != 2 || categories[0].CategoryId != "art" || categories[0].Name != "Art" || categories[1].CategoryId != "toys" {
+		t.Fatalf("categories are %+v", categories)
+	}
+}
+
+func TestGetAssetsByCategory(t *testing.T) {
+	f := newAuctionFixture(t)
+	f.mustInvoke(f.house, "addCategory", `{"categoryId":"art","name":"Art"}`)
+	f.mustInvoke(f.house, "addCategory", `{"categoryId":"toys","name":"Toys"}`)
+	art := make(map[string]bool)
+	var sold string
+	for i := 0; i < 5; i++ {
+		assetId := f.addAssetInCategory(f.alice, fmt.Sprintf("Print %v", i), "art", time.Hour)
+		art[assetId] = true
+		sold = assetId
+	}
+	f.addAssetInCategory(f.alice, "Kite", "toys", time.Hour)
+	f.addAsset(f.alice, "Lamp", "10", time.Hour)
+
+	f.expectErrorCode(ERROR_REQUIRED, "categoryId", f.bob, "getAssetsByCategory", "")
+	f.expectErrorCode(ERROR_OUT_OF_RANGE, "pageSize", f.bob, "getAssetsByCategory", "art", "0")
+	f.expectErrorCode(ERROR_OUT_OF_RANGE, "pageSize", f.bob, "getAssetsByCategory", "art", fmt.Sprint(MAX_PAGE_SIZE+1))
+
+	//two per page, a short page is the last one
+	seen := make(map[string]bool)
+	var pages []int
+	bookmark := ""
+	for {
+		var assets []Asset
+		list := decodeItems(t, f.mustInvoke(f.bob, "getAssetsByCategory", "art", "2", bookmark), &assets)
+		pages = append(pages, len(assets))
+		for _, asset := range assets {
+			if !art[asset.AssetId] || seen[asset.AssetId] {
+				t.Fatalf("page %v lists %v (%v) again or from another category", len(pages), asset.AssetId, asset.Category)
+			}
+			if len(asset.Tags) != 1 || asset.Tags[0] != "blue" {
+				t.Fatalf("tags of %v are %q", asset.AssetId, asset.Tags)
+			}
+			seen[asset.AssetId] = true
+		}
+		if len(assets) < 2 {
+			break
+		}
+		bookmark = list.Bookmark
+	}
+	if fmt.Sprint(pages) != "[2 2 1]" || len(seen) != len(art) {
+		t.Fatalf("pages hold %v assets, %v of %v art assets seen", pages, len(seen), len(art))
+	}
+
+	var none []Asset
+	if list := decodeItems(t, f.mustInvoke(f.bob, "getAssetsByCategory", "cars"), &none); list.Count != 0 {
+		t.Fatalf("an unknown category lists %+v", none)
+	}
+
+	//the index follows the asset to its new owner
+	f.advance(90 * time.Minute)
+	if response := f.placeBid(f.bob, sold, "10"); response.Status != 200 {
+		t.Fatalf("bid failed : %v", response.Message)
+	}
+	f.advance(time.Hour)
+	f.getBidResult()
+	var assets []Asset
+	decodeItems(t, f.mustInvoke(f.carol, "getAssetsByCategory", "art"), &assets)
+	owners := make(map[string]string)
+	for _, asset := range assets {
+		owners[asset.AssetId] = asset.Owner.Email
+	}
+	if len(assets) != len(art) || owners[sold] != f.bob.email {
+		t.Fatalf("after the sale the category lists %v", owners)
+	}
+}
@@ -2,11 +2,12 @@ package main
 
 import (
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"encoding/base64"
 	"errors"
-	"runtime"
-	"fmt"
 	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
 	"encoding/json"
+	"sort"
+	"time"
 )
 
 var Logger = shim.NewLogger("auction_cc")
@@ -15,23 +16,107 @@ const (
 	name                = "auction-chaincode"
 	MSP_ATTRIBUTE_EMAIL = "email"
 	MSP_ATTRIBUTE_ORG   = "org"
+	MSP_ATTRIBUTE_ROLE  = "role"
 )
 
+// ROLE_TREASURY is the role attribute of users allowed to move funds in and
+// out of the auction besides the auction house, ROLE_ADMIN of users allowed to
+// approve new users.
 const (
-	JSON_PREFIX = ""
-	JSON_INDENT = "    "
+	ROLE_TREASURY = "treasury"
+	ROLE_ADMIN    = "admin"
 )
 
+// A user registers as pending and can only list or bid once approved. Users
+// registered before approvals existed have no status and count as approved.
 const (
-	COMPOSITE_KEY_OWNER_ASSET      = "owner~asset"
-	COMPOSITE_KEY_BID_ASSET_BIDDER = "asset~bidder"
-	USER_KEY                       = "user~email"
+	USER_STATUS_PENDING  = "pending"
+	USER_STATUS_APPROVED = "approved"
 )
 
 const (
-	QUERY_ALL_CLOSED_BIDS = "{\"selector\":{\"docType\":\"Asset\",\"bidEnd\":{\"$gt\":\"%v\"}}}"
+	COMPOSITE_KEY_ASSET             = "asset~id"
+	COMPOSITE_KEY_OWNER_ASSET       = "owner~asset"
+	COMPOSITE_KEY_BID_ASSET_BIDDER  = "asset~bidder"
+	COMPOSITE_KEY_BIDDER_ASSET      = "bidder~asset"
+	COMPOSITE_KEY_USER_WATCH_ASSET  = "user~watch~asset"
+	COMPOSITE_KEY_ASSET_WATCHER     = "asset~watcher"
+	USER_KEY                        = "user~email"
+	COMPOSITE_KEY_SETTLEMENT_ASSET  = "settlement~asset"
+	COMPOSITE_KEY_BUYER_SETTLEMENT  = "buyer~settlement"
+	COMPOSITE_KEY_SELLER_SETTLEMENT = "seller~settlement"
+	COMPOSITE_KEY_FAILED_CLOSURE    = "closure~failed"
+	COMPOSITE_KEY_CATEGORY          = "category~id"
+	COMPOSITE_KEY_CATEGORY_ASSET    = "category~asset"
+	COMPOSITE_KEY_JOURNAL           = "journal~user~time~tx"
+	FEE_SCHEDULE_KEY                = "fee~schedule"
+	FX_RATES_KEY                    = "fx~rates"
 )
 
+// Amounts are in the ISO 4217 currency named next to them. An amount without a
+// currency, including every amount stored before currencies existed, is in
+// DEFAULT_CURRENCY.
+const (
+	DEFAULT_CURRENCY = "USD"
+)
+
+// The closed bids query is served by this index, see
+// META-INF/statedb/couchdb/indexes/indexAssetClosing.json
+const (
+	INDEX_ASSET_CLOSING_DDOC = "_design/indexAssetClosingDoc"
+	INDEX_ASSET_CLOSING      = "indexAssetClosing"
+)
+
+// Times CouchDB compares, such as the bidding window of an asset, are stored in
+// UTC with all nine fractional digits so that comparing the strings compares
+// the times.
+const (
+	LEDGER_TIME_FORMAT = "2006-01-02T15:04:05.000000000Z"
+)
+
+// Watchers and bidders are told about an auction that ends within this many
+// minutes unless notifyClosingSoon is given a different window.
+const (
+	DEFAULT_CLOSING_SOON_MINUTES = 60
+)
+
+const (
+	DEFAULT_PAGE_SIZE = 20
+	MAX_PAGE_SIZE     = 200
+)
+
+// getBidResult settles at most this many assets per transaction unless the
+// caller asks for a different page size.
+const (
+	DEFAULT_BATCH_SIZE = 100
+	MAX_BATCH_SIZE     = 1000
+)
+
+func currencyOf(code string) string {
+	if len(code) == 0 {
+		return DEFAULT_CURRENCY
+	}
+	return code
+}
+
+/**
+The currency codes of the balances, sorted so that peers report them in the same order.
+ */
+func sortedCurrencies(balances ...map[string]*Money) []string {
+	seen := make(map[string]bool)
+	var currencies []string
+	for _, currencyBalances := range balances {
+		for currency := range currencyBalances {
+			if !seen[currency] {
+				seen[currency] = true
+				currencies = append(currencies, currency)
+			}
+		}
+	}
+	sort.Strings(currencies)
+	return currencies
+}
+
 func getCompositeKey(stub shim.ChaincodeStubInterface, keyConstant string, keys ...string) (string, error) {
 	key, err := stub.CreateCompositeKey(keyConstant, keys)
 	if err != nil {
@@ -40,12 +125,6 @@ func getCompositeKey(stub shim.ChaincodeStubInterface, keyConstant string, keys
 	return key, nil
 }
 
-func getErrorString(err error) string {
-	_, fn, line, _ := runtime.Caller(1)
-	errStr := fmt.Sprintf("[error] %s:%d %v", fn, line, err)
-	return errStr
-}
-
 func getMSPAttr(stub shim.ChaincodeStubInterface, attribute string) (string, error) {
 	val, _, err := cid.GetAttributeValue(stub, attribute);
 	if err != nil {
@@ -73,7 +152,7 @@ func getUserByEmail(stub shim.ChaincodeStubInterface, userEmail ...string) (*Use
 		return nil, err
 	}
 	if invokerString == nil {
-		return nil, errors.New("user not registered")
+		return nil, newError(ERROR_NOT_REGISTERED, "", "user not registered")
 	}
 	err = json.Unmarshal([]byte(invokerString), &user)
 	if err != nil {
@@ -81,3 +160,193 @@ func getUserByEmail(stub shim.ChaincodeStubInterface, userEmail ...string) (*Use
 	}
 	return &user, nil;
 }
+
+func putUser(stub shim.ChaincodeStubInterface, user *User) error {
+	userKey, err := getCompositeKey(stub, USER_KEY, user.Email)
+	if err != nil {
+		return err
+	}
+	userBytes, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(userKey, []byte(userBytes))
+}
+
+/**
+The transaction timestamp is set by the client in the proposal, so it is the same on every endorser.
+ */
+func getTxTime(stub shim.ChaincodeStubInterface) (*time.Time, error) {
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return nil, err
+	}
+	txTime := time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC()
+	return &txTime, nil
+}
+
+/**
+The id of an asset listed in this transaction. The tx ID is the same on every endorser and never repeats, and
+addAssetForBid lists a single asset per transaction.
+ */
+func newAssetId(stub shim.ChaincodeStubInterface) string {
+	return stub.GetTxID()
+}
+
+/**
+Assets are stored under their id alone so that the key, and with it the key history, survives a change of owner.
+Returns nil when there is no asset with the given id.
+ */
+func getAsset(stub shim.ChaincodeStubInterface, assetId string) (*Asset, error) {
+	assetKey, err := getCompositeKey(stub, COMPOSITE_KEY_ASSET, assetId)
+	if err != nil {
+		return nil, err
+	}
+	assetBytes, err := stub.GetState(assetKey)
+	if err != nil || assetBytes == nil {
+		return nil, err
+	}
+	var asset Asset
+	if err = json.Unmarshal(assetBytes, &asset); err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+func putAsset(stub shim.ChaincodeStubInterface, asset *Asset) error {
+	assetKey, err := getCompositeKey(stub, COMPOSITE_KEY_ASSET, asset.AssetId)
+	if err != nil {
+		return err
+	}
+	assetBytes, err := json.Marshal(asset)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(assetKey, []byte(assetBytes))
+}
+
+func ledgerTime(value time.Time) string {
+	return value.UTC().Format(LEDGER_TIME_FORMAT)
+}
+
+/**
+Store the bidding window of an asset in LEDGER_TIME_FORMAT, the queries on bidStart and bidEnd rely on it.
+ */
+func (a Asset) MarshalJSON() ([]byte, error) {
+	type storedAsset Asset
+	stored := struct {
+		storedAsset
+		BidStart string `json:"bidStart,omitempty"`
+		BidEnd   string `json:"bidEnd,omitempty"`
+	}{storedAsset: storedAsset(a)}
+	if a.BidStart != nil {
+		stored.BidStart = ledgerTime(*a.BidStart)
+	}
+	if a.BidEnd != nil {
+		stored.BidEnd = ledgerTime(*a.BidEnd)
+	}
+	return json.Marshal(stored)
+}
+
+/**
+Read an asset, moving its amounts to the scale of its currency, see Money.UnmarshalText.
+ */
+func (a *Asset) UnmarshalJSON(data []byte) error {
+	type storedAsset Asset
+	if err := json.Unmarshal(data, (*storedAsset)(a)); err != nil {
+		return err
+	}
+	if err := checkAmount("price", a.Price, a.Currency); err != nil {
+		return err
+	}
+	return checkAmount("soldPrice", a.SoldPrice, a.Currency)
+}
+
+func putOwnerIndex(stub shim.ChaincodeStubInterface, ownerEmail string, assetId string) error {
+	indexKey, err := getCompositeKey(stub, COMPOSITE_KEY_OWNER_ASSET, ownerEmail, assetId)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(indexKey, []byte{0x00})
+}
+
+// closedBidsCursor is the position of the closed bids sweep. The query is
+// sorted on bidEnd and CouchDB breaks ties on the document id, so the pair
+// identifies where the next page starts.
+type closedBidsCursor struct {
+	BidEnd string `json:"bidEnd"`
+	Key    string `json:"key"`
+}
+
+func encodeClosedBidsCursor(cursor *closedBidsCursor) (string, error) {
+	cursorBytes, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(cursorBytes), nil
+}
+
+func decodeClosedBidsCursor(bookmark string) (*closedBidsCursor, error) {
+	cursorBytes, err := base64.StdEncoding.DecodeString(bookmark)
+	if err != nil {
+		return nil, err
+	}
+	var cursor closedBidsCursor
+	if err = json.Unmarshal(cursorBytes, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+/**
+Build the rich query for unsold assets whose bidding ended before currentTime, starting after the cursor if one is given.
+ */
+func getClosedBidsQuery(currentTime time.Time, cursor *closedBidsCursor) (string, error) {
+	//a lot none of the bidders could pay for waits for closeAuction or extendAuction
+	selector := map[string]interface{}{
+		"docType":       "Asset",
+		"isSold":        map[string]interface{}{"$ne": true},
+		"bidEnd":        map[string]interface{}{"$lt": ledgerTime(currentTime)},
+		"closureFailed": map[string]interface{}{"$ne": true},
+	}
+	if cursor != nil {
+		selector["$or"] = []interface{}{
+			map[string]interface{}{"bidEnd": map[string]interface{}{"$gt": cursor.BidEnd}},
+			map[string]interface{}{"bidEnd": cursor.BidEnd, "_id": map[string]interface{}{"$gt": cursor.Key}},
+		}
+	}
+	query := map[string]interface{}{
+		"selector":  selector,
+		"sort":      []interface{}{map[string]string{"docType": "asc"}, map[string]string{"bidEnd": "asc"}},
+		"use_index": []string{INDEX_ASSET_CLOSING_DDOC, INDEX_ASSET_CLOSING},
+	}
+	queryBytes, err := json.Marshal(query)
+	if err != nil {
+		return "", err
+	}
+	return string(queryBytes), nil
+}
+
+/**
+Build the rich query for unsold assets whose bidding ends between from and to and that nobody has been told about yet.
+ */
+func getClosingSoonQuery(from time.Time, to time.Time) (string, error) {
+	query := map[string]interface{}{
+		"selector": map[string]interface{}{
+			"docType": "Asset",
+			"isSold":  map[string]interface{}{"$ne": true},
+			"bidEnd": map[string]interface{}{
+				"$gte": ledgerTime(from),
+				"$lt":  ledgerTime(to),
+			},
+			"closingSoonNotified": map[string]interface{}{"$ne": true},
+		},
+		"sort":      []interface{}{map[string]string{"docType": "asc"}, map[string]string{"bidEnd": "asc"}},
+		"use_index": []string{INDEX_ASSET_CLOSING_DDOC, INDEX_ASSET_CLOSING},
+	}
+	queryBytes, err := json.Marshal(query)
+	if err != nil {
+		return "", err
+	}
+	return string(queryBytes), nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+)
+
+/**
+List an asset priced in currency whose bidding opens in an hour and runs for duration. Returns the generated asset id.
+ */
+func (f *auctionFixture) addAssetIn(seller *testIdentity, name string, price string, currency string, duration time.Duration) string {
+	f.t.Helper()
+	var asset Asset
+	decodeEntity(f.t, f.mustInvoke(seller, "addAssetForBid", fmt.Sprintf(`{"name":%q,"price":%q,"currency":%q,"bidStart":%q,"bidEnd":%q}`,
+		name, price, currency, f.now.Add(time.Hour).Format(time.RFC3339), f.now.Add(time.Hour+duration).Format(time.RFC3339))), &asset)
+	return asset.AssetId
+}
+
+func (f *auctionFixture) bidIn(bidder *testIdentity, assetId string, amount string, currency string) string {
+	return fmt.Sprintf(`{"asset":{"assetId":%q},"bidAmount":%q,"currency":%q,"bidTime":%q}`, assetId, amount, currency, f.now.Format(time.RFC3339))
+}
+
+func TestMultiCurrencySettlement(t *testing.T) {
+	f := newAuctionFixture(t)
+	f.mustInvoke(f.house, "setFeeSchedule", `{"buyerPremiumPct":"10","sellerCommissionPct":"5","houseAccountEmail":"house@example.com"}`)
+
+	f.expectErrorCode(ERROR_INVALID_CURRENCY, "currency", f.alice, "addAssetForBid", fmt.Sprintf(`{"name":"Vase","price":"100","currency":"eur","bidStart":%q,"bidEnd":%q}`,
+		f.now.Add(time.Hour).Format(time.RFC3339), f.now.Add(2*time.Hour).Format(time.RFC3339)))
+	if asset := f.getAsset(f.addAsset(f.alice, "Lamp", "100", time.Hour)); asset.Currency != DEFAULT_CURRENCY {
+		t.Fatalf("asset listed without a currency is in %q", asset.Currency)
+	}
+	assetId := f.addAssetIn(f.alice, "Vase", "100", "EUR", time.Hour)
+	f.advance(90 * time.Minute)
+
+	//a bid is in the currency of the asset and paid from the balance in that currency
+	f.expectErrorCode(ERROR_CURRENCY_MISMATCH, "currency", f.bob, "placeBid", f.bidIn(f.bob, assetId, "200", ""), "-")
+	f.expectErrorCode(ERROR_CURRENCY_MISMATCH, "currency", f.bob, "placeBid", f.bidIn(f.bob, assetId, "200", "GBP"), "-")
+	f.expectErrorCode(ERROR_INSUFFICIENT_FUNDS, "bidAmount", f.bob, "placeBid", f.bidIn(f.bob, assetId, "200", "EUR"), "-")
+	f.mustInvoke(f.house, "deposit", `{"email":"bob@example.com","amount":"300","currency":"EUR"}`)
+	var bid Bid
+	decodeEntity(t, f.mustInvoke(f.bob, "placeBid", f.bidIn(f.bob, assetId, "200", "EUR"), "-"), &bid)
+	if bid.Currency != "EUR" {
+		t.Fatalf("bid is in %q", bid.Currency)
+	}
+
+	f.advance(time.Hour)
+	f.getBidResult()
+	var settlements []Settlement
+	decodeItems(t, f.mustInvoke(f.house, "getSettlementsForAsset", assetId), &settlements)
+	if len(settlements) != 1 || settlements[0].Currency != "EUR" || settlements[0].PriceCharged.Cmp(money(t, "220")) != 0 {
+		t.Fatalf("settlements are %+v", settlements)
+	}
+
+	//the euro balances moved, the dollar balances did not
+	for _, want := range []struct {
+		identity *testIdentity
+		eur      string
+	}{{f.bob, "80"}, {f.alice, "190"}, {f.house, "30"}} {
+		user := f.getUser(f.house, want.identity.email)
+		if user.balance("EUR").Cmp(money(t, want.eur)) != 0 || user.balance(DEFAULT_CURRENCY).Cmp(money(t, "1000")) != 0 {
+			t.Fatalf("balances of %v are %v", want.identity.email, user.Balances)
+		}
+	}
+	entries, _ := f.getStatement(f.bob)
+	if last := entries[len(entries)-1]; last.Currency != "EUR" || last.Balance.Cmp(money(t, "80")) != 0 {
+		t.Fatalf("last entry of bob is %+v", last)
+	}
+	f.expectErrorCode(ERROR_INSUFFICIENT_FUNDS, "amount", f.house, "withdraw", `{"email":"bob@example.com","amount":"81","currency":"EUR"}`)
+	f.expectConsistent()
+}
+
+func TestSearchPricesWithinACurrency(t *testing.T) {
+	f := newAuctionFixture(t)
+	f.addAssetIn(f.alice, "Vase", "500", "USD", time.Hour)
+	f.addAssetIn(f.alice, "Lamp", "1000", "JPY", time.Hour)
+	f.addAssetIn(f.alice, "Kite", "50", "USD", time.Hour)
+
+	//1000 yen is not dearer than 500 dollars, a price range only looks at one currency
+	var assets []Asset
+	decodeItems(t, f.mustInvoke(f.bob, "searchAssets", `{"filter":{"minPrice":"100","currency":"USD"},"sortBy":"price"}`), &assets)
+	if len(assets) != 1 || assets[0].Name != "Vase" {
+		t.Fatalf("dollar assets from 100 are %+v", assets)
+	}
+	decodeItems(t, f.mustInvoke(f.bob, "searchAssets", `{"filter":{"currency":"USD"},"sortBy":"price","sortDesc":true}`), &assets)
+	if len(assets) != 2 || assets[0].Name != "Vase" || assets[1].Name != "Kite" {
+		t.Fatalf("dollar assets by price are %+v", assets)
+	}
+}
+
+func TestFxRates(t *testing.T) {
+	f := newAuctionFixture(t)
+	f.expectErrorCode(ERROR_NOT_FOUND, "", f.alice, "getFxRates")
+	f.expectErrorCode(ERROR_UNAUTHORIZED, "", f.alice, "setFxRates", `{"base":"USD","rates":{"EUR":"0.8"}}`)
+	f.expectErrorCode(ERROR_REQUIRED, "base", f.house, "setFxRates", `{"rates":{"EUR":"0.8"}}`)
+	f.expectErrorCode(ERROR_REQUIRED, "rates", f.house, "setFxRates", `{"base":"USD"}`)
+	f.expectErrorCode(ERROR_INVALID_CURRENCY, "rates.euro", f.house, "setFxRates", `{"base":"USD","rates":{"euro":"0.8"}}`)
+	f.expectErrorCode(ERROR_NOT_POSITIVE, "rates.GBP", f.house, "setFxRates", `{"base":"USD","rates":{"EUR":"0.8","GBP":"0"}}`)
+	f.expectErrorCode(ERROR_OUT_OF_RANGE, "rates.USD", f.house, "setFxRates", `{"base":"USD","rates":{"USD":"2"}}`)
+	f.expectErrorCode(ERROR_READ_ONLY, "updatedBy", f.house, "setFxRates", `{"base":"USD","rates":{"EUR":"0.8"},"updatedBy":"bob@example.com"}`)
+	f.mustInvoke(f.house, "setFxRates", `{"base":"USD","rates":{"EUR":"0.8","GBP":"0.75"}}`)
+
+	var rates FxRates
+	if err := json.Unmarshal(f.mustInvoke(f.alice, "getFxRates"), &rates); err != nil {
+		t.Fatal(err)
+	}
+	if rates.Base != "USD" || rates.UpdatedBy != f.house.email || rates.rate("EUR").Cmp(big.NewRat(4, 5)) != 0 {
+		t.Fatalf("rates are %+v", rates)
+	}
+
+	dollars := f.addAsset(f.alice, "Lamp", "100", time.Hour)
+	euros := f.addAssetIn(f.alice, "Vase", "100", "EUR", time.Hour)
+	yen := f.addAssetIn(f.alice, "Bowl", "100", "JPY", time.Hour)
+	f.mustInvoke(f.house, "deposit", `{"email":"bob@example.com","amount":"1000","currency":"EUR"}`)
+	f.mustInvoke(f.house, "deposit", `{"email":"bob@example.com","amount":"1000","currency":"JPY"}`)
+	f.advance(90 * time.Minute)
+	f.mustInvoke(f.bob, "placeBid", f.bidIn(f.bob, dollars, "150", "USD"), "-")
+	f.mustInvoke(f.bob, "placeBid", f.bidIn(f.bob, euros, "120", "EUR"), "-")
+	f.mustInvoke(f.bob, "placeBid", f.bidIn(f.bob, yen, "500", "JPY"), "-")
+
+	f.expectErrorCode(ERROR_INVALID_CURRENCY, "displayCurrency", f.bob, "getBidsForUser", "pounds")
+	f.expectErrorCode(ERROR_NOT_FOUND, "displayCurrency", f.bob, "getBidsForUser", "CHF")
+	var activities []BidActivity
+	decodeItems(t, f.mustInvoke(f.bob, "getBidsForUser", "GBP"), &activities)
+	display := make(map[string]BidActivity)
+	for _, activity := range activities {
+		display[activity.AssetId] = activity
+	}
+	if activity := display[dollars]; activity.Currency != "USD" || activity.DisplayCurrency != "GBP" || activity.DisplayBidAmount.Cmp(money(t, "112.5")) != 0 {
+		t.Fatalf("dollar bid is shown as %+v", activity)
+	}
+	//120 EUR is 150 USD is 112.50 GBP
+	if activity := display[euros]; activity.BidAmount.Cmp(money(t, "120")) != 0 || activity.DisplayHighBid.Cmp(money(t, "112.5")) != 0 {
+		t.Fatalf("euro bid is shown as %+v", activity)
+	}
+	if activity := display[yen]; len(activity.DisplayCurrency) != 0 || activity.DisplayBidAmount != nil {
+		t.Fatalf("yen bid without a rate is shown as %+v", activity)
+	}
+}
+
+func TestSingleBalanceOfEarlierUsers(t *testing.T) {
+	f := newAuctionFixture(t)
+	//before balances were kept per currency a user had a single balance in dollars
+	dave, erin := newTestIdentity(t, "dave@example.com", "Org1"), newTestIdentity(t, "erin@example.com", "Org1")
+	for _, user := range []struct {
+		identity *testIdentity
+		document string
+	}{
+		{dave, `{"userId":"dave","email":"dave@example.com","balance":"1000","org":"Org1","docType":"User"}`},
+		{erin, `{"userId":"erin","email":"erin@example.com","balance":"50","org":"Org1","docType":"User"}`},
+	} {
+		userKey, _ := getCompositeKey(f.stub, USER_KEY, user.identity.email)
+		putStored(t, f.testLedger, userKey, user.document)
+	}
+	f.expectBalance(dave, "1000")
+
+	vase := f.addAsset(f.alice, "Vase", "100", time.Hour)
+	lamp := f.addAsset(erin, "Lamp", "100", time.Hour)
+	f.advance(90 * time.Minute)
+	f.expectErrorCode(ERROR_INSUFFICIENT_FUNDS, "bidAmount", dave, "placeBid", f.bidIn(dave, vase, "1000.01", ""), "-")
+	if response := f.placeBid(dave, vase, "400"); response.Status != 200 {
+		t.Fatalf("bid failed : %v", response.Message)
+	}
+	if response := f.placeBid(f.bob, lamp, "120"); response.Status != 200 {
+		t.Fatalf("bid failed : %v", response.Message)
+	}
+	f.advance(time.Hour)
+	if result := f.getBidResult(); result.Settled != 2 {
+		t.Fatalf("expected two settlements, got %+v", result)
+	}
+	f.expectBalance(dave, "600")
+	f.expectBalance(erin, "170")
+	f.expectBalance(f.alice, "1400")
+
+	//settling wrote the users back in the current layout
+	daveKey, _ := getCompositeKey(f.stub, USER_KEY, dave.email)
+	var stored map[string]interface{}
+	json.Unmarshal(f.stub.State[daveKey], &stored)
+	if _, ok := stored["balance"]; ok || fmt.Sprint(stored["balances"]) != "map[USD:600.00]" {
+		t.Fatalf("dave is stored as %v", stored)
+	}
+}
+
+func TestAmountsOfEarlierVersions(t *testing.T) {
+	f := newAuctionFixture(t)
+	//amounts were stored as big.Rat, which wrote whole numbers without decimals and the rest as fractions
+	dave, erin := newTestIdentity(t, "dave@example.com", "Org1"), newTestIdentity(t, "erin@example.com", "Org1")
+	for _, user := range []struct {
+		identity *testIdentity
+		document string
+	}{
+		{dave, `{"userId":"dave","email":"dave@example.com","balances":{"USD":"2001/2"},"org":"Org1","docType":"User"}`},
+		{erin, `{"userId":"erin","email":"erin@example.com","balances":{"USD":"1001/1000"},"org":"Org1","docType":"User"}`},
+	} {
+		userKey, _ := getCompositeKey(f.stub, USER_KEY, user.identity.email)
+		putStored(t, f.testLedger, userKey, user.document)
+	}
+	if balance := f.getUser(dave, dave.email).balance(DEFAULT_CURRENCY); balance.String() != "1000.50" {
+		t.Fatalf("balance of dave is %v", balance.String())
+	}
+	//a fraction that has no exact value in cents is refused rather than rounded
+	f.expectErrorCode(ERROR_TOO_PRECISE, "balances.USD", erin, "getUser", erin.email)
+
+	vase := f.addAsset(f.alice, "Vase", "100", time.Hour)
+	lamp := f.addAsset(f.alice, "Lamp", "100", time.Hour)
+	for assetId, price := range map[string]string{vase: "100", lamp: "201/2"} {
+		assetKey, _ := getCompositeKey(f.stub, COMPOSITE_KEY_ASSET, assetId)
+		price := price
+		rewriteStored(t, f.testLedger, assetKey, func(document map[string]interface{}) {
+			document["price"] = price
+		})
+	}
+	if price := f.getAsset(vase).Price.String(); price != "100.00" {
+		t.Fatalf("the price of the vase reads as %v", price)
+	}
+	if price := f.getAsset(lamp).Price.String(); price != "100.50" {
+		t.Fatalf("the price of the lamp reads as %v", price)
+	}
+
+	f.advance(90 * time.Minute)
+	f.expectErrorCode(ERROR_OUT_OF_RANGE, "bidAmount", dave, "placeBid", f.bidIn(dave, lamp, "100.25", ""), "-")
+	for assetId, amount := range map[string]string{vase: "400", lamp: "100.50"} {
+		if response := f.placeBid(dave, assetId, amount); response.Status != 200 {
+			t.Fatalf("bid failed : %v", response.Message)
+		}
+	}
+	f.advance(time.Hour)
+	if result := f.getBidResult(); result.Settled != 2 {
+		t.Fatalf("expected two settlements, got %+v", result)
+	}
+	f.expectBalance(dave, "500")
+	f.expectBalance(f.alice, "1500.50")
+
+	//settling wrote the amounts back at the scale of dollars
+	daveKey, _ := getCompositeKey(f.stub, USER_KEY, dave.email)
+	var stored map[string]interface{}
+	json.Unmarshal(f.stub.State[daveKey], &stored)
+	if fmt.Sprint(stored["balances"]) != "map[USD:500.00]" {
+		t.Fatalf("dave is stored as %v", stored)
+	}
+}
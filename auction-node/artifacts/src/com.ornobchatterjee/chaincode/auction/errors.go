@@ -0,0 +1,68 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"encoding/json"
+	"fmt"
+	"runtime"
+)
+
+// Error codes of the ChaincodeError envelope. Clients map them to their own
+// messages, so a code is never reused for a different condition.
+const (
+	ERROR_INVALID_JSON       = "INVALID_JSON"
+	ERROR_UNKNOWN_FIELD      = "UNKNOWN_FIELD"
+	ERROR_READ_ONLY          = "READ_ONLY"
+	ERROR_REQUIRED           = "REQUIRED"
+	ERROR_INVALID_FORMAT     = "INVALID_FORMAT"
+	ERROR_INVALID_EMAIL      = "INVALID_EMAIL"
+	ERROR_INVALID_CURRENCY   = "INVALID_CURRENCY"
+	ERROR_TOO_LONG           = "TOO_LONG"
+	ERROR_TOO_MANY           = "TOO_MANY"
+	ERROR_NOT_POSITIVE       = "NOT_POSITIVE"
+	ERROR_NEGATIVE           = "NEGATIVE"
+	ERROR_OUT_OF_RANGE       = "OUT_OF_RANGE"
+	ERROR_TOO_PRECISE        = "TOO_PRECISE"
+	ERROR_UNKNOWN_FUNCTION   = "UNKNOWN_FUNCTION"
+	ERROR_ARGUMENT_COUNT     = "ARGUMENT_COUNT"
+	ERROR_UNAUTHORIZED       = "UNAUTHORIZED"
+	ERROR_NOT_REGISTERED     = "NOT_REGISTERED"
+	ERROR_NOT_APPROVED       = "NOT_APPROVED"
+	ERROR_NOT_FOUND          = "NOT_FOUND"
+	ERROR_ALREADY_EXISTS     = "ALREADY_EXISTS"
+	ERROR_INVALID_STATE      = "INVALID_STATE"
+	ERROR_INSUFFICIENT_FUNDS = "INSUFFICIENT_FUNDS"
+	ERROR_CURRENCY_MISMATCH  = "CURRENCY_MISMATCH"
+	ERROR_SETTLEMENT_FAILED  = "SETTLEMENT_FAILED"
+	ERROR_INTERNAL           = "INTERNAL"
+)
+
+func newError(code string, field string, format string, a ...interface{}) *ChaincodeError {
+	return &ChaincodeError{code, field, fmt.Sprintf(format, a...)}
+}
+
+/**
+The response of a failed invoke, with the ChaincodeError envelope as its message. An error that is not a
+ChaincodeError is reported as INTERNAL and logged together with the place it was returned from.
+ */
+func errorResponse(err error) pb.Response {
+	chaincodeErr, ok := err.(*ChaincodeError)
+	if closureErr, isClosure := err.(*ClosureError); isClosure {
+		chaincodeErr, ok = newError(ERROR_SETTLEMENT_FAILED, "", "%v", closureErr.Error()), true
+	}
+	if !ok {
+		_, fn, line, _ := runtime.Caller(1)
+		Logger.Errorf("[error] %s:%d %v", fn, line, err)
+		chaincodeErr = newError(ERROR_INTERNAL, "", "%v", err.Error())
+	}
+	envelope, marshalErr := json.Marshal(chaincodeErr)
+	if marshalErr != nil {
+		return shim.Error(chaincodeErr.Message)
+	}
+	return shim.Error(string(envelope))
+}
+
+func unauthorized(message string) pb.Response {
+	return errorResponse(newError(ERROR_UNAUTHORIZED, "", "Unauthorized user. %v", message))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"encoding/json"
+)
+
+// Fabric keeps only the last event set by a transaction, so every transaction
+// sets a single EVENT_NAME event holding an EventEnvelope.
+const (
+	EVENT_NAME             = "AuctionEvents"
+	EVENT_ENVELOPE_VERSION = 1
+)
+
+const (
+	EVENT_ASSET_LISTED      = "AssetListed"
+	EVENT_BID_PLACED        = "BidPlaced"
+	EVENT_AUCTION_EXTENDED  = "AuctionExtended"
+	EVENT_AUCTION_CLOSED    = "AuctionClosed"
+	EVENT_ASSET_TRANSFERRED = "AssetTransferred"
+	EVENT_BALANCE_CHANGED   = "BalanceChanged"
+	EVENT_CLOSING_SOON      = "ClosingSoon"
+	EVENT_USER_APPROVED     = "UserApproved"
+)
+
+// The payload schema version of every event type.
+var eventVersions = map[string]int{
+	EVENT_ASSET_LISTED:      1,
+	EVENT_BID_PLACED:        1,
+	EVENT_AUCTION_EXTENDED:  1,
+	EVENT_AUCTION_CLOSED:    1,
+	EVENT_ASSET_TRANSFERRED: 1,
+	EVENT_BALANCE_CHANGED:   1,
+	EVENT_CLOSING_SOON:      1,
+	EVENT_USER_APPROVED:     1,
+}
+
+// EventBatch collects the events of one transaction until they are emitted.
+type EventBatch struct {
+	events []ChaincodeEvent
+}
+
+func (b *EventBatch) add(eventType string, payload interface{}) error {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	b.events = append(b.events, ChaincodeEvent{eventType, eventVersions[eventType], payloadBytes})
+	return nil
+}
+
+/**
+Set the envelope as the event of the transaction. Nothing is set when no event was raised.
+ */
+func (b *EventBatch) emit(stub shim.ChaincodeStubInterface) error {
+	if len(b.events) == 0 {
+		return nil
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+	envelope := EventEnvelope{EVENT_ENVELOPE_VERSION, stub.GetTxID(), txTime, b.events}
+	envelopeBytes, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	return stub.SetEvent(EVENT_NAME, envelopeBytes)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strconv"
+)
+
+var HUNDRED = big.NewRat(100, 1)
+
+func (t *AuctionChaincode) setFeeSchedule(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	org, _ := getMSPAttr(stub, MSP_ATTRIBUTE_ORG)
+	if org != "Org2" {
+		return unauthorized("Only Auction house users are allowed to invoke this function")
+	}
+
+	var schedule FeeSchedule
+	err := decodeInput(args[0], &schedule)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if err = validateFeeSchedule(&schedule); err != nil {
+		return errorResponse(err)
+	}
+
+	//the house account must be a registered user so that fees can be credited
+	if _, err = getUserByEmail(stub, schedule.HouseAccountEmail); err != nil {
+		return errorResponse(newError(ERROR_NOT_REGISTERED, "houseAccountEmail", "House account %v : %v", schedule.HouseAccountEmail, err.Error()))
+	}
+
+	schedule.DocType = reflect.TypeOf(schedule).Name()
+	scheduleBytes, err := json.Marshal(schedule)
+	if err != nil {
+		return errorResponse(err)
+	}
+	scheduleKey, _ := getCompositeKey(stub, FEE_SCHEDULE_KEY)
+	if err = stub.PutState(scheduleKey, []byte(scheduleBytes)); err != nil {
+		return errorResponse(err)
+	}
+	return invokeSuccess(stub, schedule, nil)
+}
+
+func (t *AuctionChaincode) getFeeSchedule(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	schedule, err := getFeeScheduleFromLedger(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if schedule == nil {
+		return errorResponse(newError(ERROR_NOT_FOUND, "", "Fee schedule is not configured"))
+	}
+	return querySuccess(schedule)
+}
+
+func validateFeeSchedule(schedule *FeeSchedule) error {
+	if len(schedule.HouseAccountEmail) == 0 {
+		return newError(ERROR_REQUIRED, "houseAccountEmail", "House account email is mandatory")
+	}
+	if err := checkEmail("houseAccountEmail", schedule.HouseAccountEmail); err != nil {
+		return err
+	}
+	if len(schedule.Brackets) == 0 {
+		if !isValidPct(schedule.BuyerPremiumPct) {
+			return newError(ERROR_OUT_OF_RANGE, "buyerPremiumPct", "Fee percentages must be between 0 and 100")
+		}
+		if !isValidPct(schedule.SellerCommissionPct) {
+			return newError(ERROR_OUT_OF_RANGE, "sellerCommissionPct", "Fee percentages must be between 0 and 100")
+		}
+		return nil
+	}
+
+	//brackets must start at zero and be strictly ascending so that every part of the hammer price falls in exactly one
+	var previous *Money
+	for i, bracket := range schedule.Brackets {
+		field := "brackets[" + strconv.Itoa(i) + "]"
+		if bracket.From == nil || bracket.From.Sign() < 0 {
+			return newError(ERROR_NEGATIVE, field+".from", "Bracket %v must have a non negative lower bound", i)
+		}
+		if i == 0 && bracket.From.Sign() != 0 {
+			return newError(ERROR_OUT_OF_RANGE, field+".from", "First bracket must start from 0")
+		}
+		if previous != nil && bracket.From.Cmp(previous) <= 0 {
+			return newError(ERROR_OUT_OF_RANGE, field+".from", "Brackets must be in ascending order")
+		}
+		if !isValidPct(bracket.BuyerPremiumPct) {
+			return newError(ERROR_OUT_OF_RANGE, field+".buyerPremiumPct", "Bracket %v fee percentages must be between 0 and 100", i)
+		}
+		if !isValidPct(bracket.SellerCommissionPct) {
+			return newError(ERROR_OUT_OF_RANGE, field+".sellerCommissionPct", "Bracket %v fee percentages must be between 0 and 100", i)
+		}
+		previous = bracket.From
+	}
+	return nil
+}
+
+func isValidPct(pct *big.Rat) bool {
+	return pct == nil || (pct.Sign() >= 0 && pct.Cmp(HUNDRED) <= 0)
+}
+
+/**
+Read the fee schedule from the ledger. Returns nil when the auction house has not configured one, in which case no fees are charged.
+ */
+func getFeeScheduleFromLedger(stub shim.ChaincodeStubInterface) (*FeeSchedule, error) {
+	scheduleKey, err := getCompositeKey(stub, FEE_SCHEDULE_KEY)
+	if err != nil {
+		return nil, err
+	}
+	scheduleBytes, err := stub.GetState(scheduleKey)
+	if err != nil {
+		return nil, err
+	}
+	if scheduleBytes == nil {
+		return nil, nil
+	}
+	var schedule FeeSchedule
+	if err = json.Unmarshal(scheduleBytes, &schedule); err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+/**
+Work out the buyer's premium and seller's commission for a hammer price in currency. A nil schedule charges nothing.
+Each fee is rounded to the minor unit of the currency with FEE_ROUNDING.
+ */
+func computeFees(schedule *FeeSchedule, hammerPrice *Money, currency string) *FeeBreakdown {
+	fees := &FeeBreakdown{
+		HammerPrice:      hammerPrice,
+		BuyerPremium:     zeroMoney(currency),
+		SellerCommission: zeroMoney(currency),
+	}
+	if schedule != nil {
+		scale := currencyScale(currency)
+		if len(schedule.Brackets) == 0 {
+			fees.BuyerPremium = roundMoney(percentOf(hammerPrice.rat(), schedule.BuyerPremiumPct), scale, FEE_ROUNDING)
+			fees.SellerCommission = roundMoney(percentOf(hammerPrice.rat(), schedule.SellerCommissionPct), scale, FEE_ROUNDING)
+		} else {
+			fees.BuyerPremium = roundMoney(tieredFee(hammerPrice, schedule.Brackets, func(b FeeBracket) *big.Rat { return b.BuyerPremiumPct }), scale, FEE_ROUNDING)
+			fees.SellerCommission = roundMoney(tieredFee(hammerPrice, schedule.Brackets, func(b FeeBracket) *big.Rat { return b.SellerCommissionPct }), scale, FEE_ROUNDING)
+		}
+		fees.HouseAccountEmail = schedule.HouseAccountEmail
+	}
+	fees.BuyerTotal = hammerPrice.Add(fees.BuyerPremium)
+	fees.SellerProceeds = hammerPrice.Sub(fees.SellerCommission)
+	return fees
+}
+
+/**
+Charge each slice of the hammer price at the rate of the bracket it falls in. The fee is exact, the caller rounds it.
+ */
+func tieredFee(hammerPrice *Money, brackets []FeeBracket, rate func(FeeBracket) *big.Rat) *big.Rat {
+	fee := new(big.Rat)
+	for i, bracket := range brackets {
+		if hammerPrice.Cmp(bracket.From) <= 0 {
+			break
+		}
+		upper := hammerPrice
+		if i+1 < len(brackets) && brackets[i+1].From.Cmp(hammerPrice) < 0 {
+			upper = brackets[i+1].From
+		}
+		fee.Add(fee, percentOf(upper.Sub(bracket.From).rat(), rate(bracket)))
+	}
+	return fee
+}
+
+func percentOf(amount *big.Rat, pct *big.Rat) *big.Rat {
+	if pct == nil {
+		return new(big.Rat)
+	}
+	result := new(big.Rat).Mul(amount, pct)
+	return result.Quo(result, HUNDRED)
+}
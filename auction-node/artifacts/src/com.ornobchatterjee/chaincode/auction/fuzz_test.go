@@ -0,0 +1,289 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+/**
+Fuzz targets for the invoke functions. Each target runs the function against a small ledger with users, a category,
+a fee schedule, an open auction with a bid and an ended one. The fuzzer picks the invoker, the arguments and how many
+of them are passed; whatever it picks, the chaincode must answer with a response rather than panic.
+
+	go test -run '^$' -fuzz FuzzPlaceBid -fuzztime 1m
+
+In the arguments ASSET stands for the id of the open auction and ENDED for the id of the ended one, so that the seeds
+reach past the lookup of the asset.
+ */
+type fuzzLedger struct {
+	*auctionFixture
+	identities []*testIdentity
+	open       string
+	ended      string
+}
+
+func newFuzzLedger(t *testing.T) *fuzzLedger {
+	f := newAuctionFixture(t)
+	f.mustInvoke(f.house, "addCategory", `{"categoryId":"art","name":"Art"}`)
+	f.mustInvoke(f.house, "setFeeSchedule", `{"buyerPremiumPct":"10","sellerCommissionPct":"5","houseAccountEmail":"house@example.com"}`)
+	open := f.addAsset(f.alice, "Vase", "100", 2*time.Hour)
+	ended := f.addAsset(f.alice, "Lamp", "100", 30*time.Minute)
+	for _, assetId := range []string{open, ended} {
+		if response := f.placeBid(f.bob, assetId, "150"); response.Status >= 400 {
+			t.Fatalf("bid failed : %v", response.Message)
+		}
+	}
+	f.mustInvoke(f.carol, "watchAsset", open)
+	f.advance(2 * time.Hour)
+	dave := newTestIdentity(t, "dave@example.com", "Org1")
+	return &fuzzLedger{f, []*testIdentity{f.alice, f.bob, f.house, dave}, open, ended}
+}
+
+// fuzzArgs is a seed: who invokes (alice, bob, house or the unregistered dave) and the arguments.
+type fuzzArgs struct {
+	who  uint8
+	args []string
+}
+
+func fuzzInvokeFunction(f *testing.F, function string, seeds ...fuzzArgs) {
+	for _, seed := range seeds {
+		args := append(seed.args, "", "", "")
+		f.Add(seed.who, args[0], args[1], args[2], uint8(len(seed.args)))
+	}
+	var ledger *fuzzLedger
+	f.Fuzz(func(t *testing.T, who uint8, a string, b string, c string, count uint8) {
+		if ledger == nil {
+			ledger = newFuzzLedger(t)
+		}
+		ledger.t = t
+		args := []string{a, b, c}[:count%4]
+		for i := range args {
+			args[i] = strings.Replace(args[i], "ASSET", ledger.open, -1)
+			args[i] = strings.Replace(args[i], "ENDED", ledger.ended, -1)
+		}
+		//every input starts from the same ledger
+		state, keys, history := ledger.snapshot()
+		defer func() {
+			ledger.stub.State, ledger.stub.Keys, ledger.stub.history = state, keys, history
+		}()
+		ledger.invoke(ledger.identities[int(who)%len(ledger.identities)], function, args...)
+	})
+}
+
+func FuzzAddUser(f *testing.F) {
+	fuzzInvokeFunction(f, "addUser",
+		fuzzArgs{3, []string{`{"userId":"dave"}`}},
+		fuzzArgs{3, []string{`{"userId":"dave","balance":"10"}`}},
+		fuzzArgs{3, []string{`{"userId":"dave","balance":null}`}},
+		fuzzArgs{3, []string{`{"userId":"dave","balance":"1/0"}`}},
+		fuzzArgs{3, []string{`{"userId":"dave","status":"approved","creditLimit":"10"}`}},
+		fuzzArgs{3, []string{`null`}},
+		fuzzArgs{0, []string{`{"userId":"alice"}`}},
+	)
+}
+
+func FuzzApproveUser(f *testing.F) {
+	fuzzInvokeFunction(f, "approveUser",
+		fuzzArgs{2, []string{`{"email":"alice@example.com","creditLimit":"500"}`}},
+		fuzzArgs{2, []string{`{"email":"dave@example.com","creditLimit":"0","reference":"KYC"}`}},
+		fuzzArgs{2, []string{`{"email":"bob@example.com","creditLimit":"-1"}`}},
+		fuzzArgs{0, []string{`{"email":"alice@example.com"}`}},
+	)
+}
+
+func FuzzAddAssetForBid(f *testing.F) {
+	fuzzInvokeFunction(f, "addAssetForBid",
+		fuzzArgs{0, []string{`{"name":"Clock","price":"10","category":"art","tags":["a"],"bidStart":"2018-10-01T13:00:00Z","bidEnd":"2018-10-01T14:00:00Z"}`}},
+		fuzzArgs{0, []string{`{}`}},
+		fuzzArgs{0, []string{`{"price":"10"}`}},
+		fuzzArgs{0, []string{`{"price":"10","bidStart":"2018-10-01T13:00:00Z"}`}},
+		fuzzArgs{0, []string{`{"price":"10","bidEnd":"2018-10-01T13:00:00Z"}`}},
+		fuzzArgs{0, []string{`{"price":null,"bidStart":null}`}},
+		fuzzArgs{0, []string{`null`}},
+	)
+}
+
+func FuzzPlaceBid(f *testing.F) {
+	fuzzInvokeFunction(f, "placeBid",
+		fuzzArgs{1, []string{`{"asset":{"assetId":"ASSET"},"bidAmount":"200"}`, "-"}},
+		fuzzArgs{1, []string{`{"asset":{"assetId":"ASSET"}}`, "-"}},
+		fuzzArgs{1, []string{`{"asset":{"assetId":"ASSET"},"bidAmount":null}`, "-"}},
+		fuzzArgs{1, []string{`{"asset":{"assetId":"ASSET","owner":null},"bidAmount":"200"}`, "-"}},
+		fuzzArgs{1, []string{`{"asset":null}`, "-"}},
+		fuzzArgs{1, []string{`null`, "-"}},
+		fuzzArgs{1, []string{`{"asset":{"assetId":"\u0000"},"bidAmount":"200"}`, "-"}},
+		fuzzArgs{1, []string{`{"asset":{"assetId":"ASSET"},"bidAmount":"200","currency":"EUR"}`, "-"}},
+		fuzzArgs{1, []string{`{"asset":{"assetId":"ASSET"},"bidAmount":"200","currency":"usd"}`, "-"}},
+		fuzzArgs{1, []string{`{"asset":{"assetId":"ASSET"},"bidAmount":"200.125"}`, "-"}},
+	)
+}
+
+func FuzzGetBidResult(f *testing.F) {
+	fuzzInvokeFunction(f, "getBidResult",
+		fuzzArgs{2, []string{"2018-10-01T11:00:00Z"}},
+		fuzzArgs{2, []string{"2018-10-01T11:00:00Z", "1"}},
+		fuzzArgs{2, []string{"2018-10-01T11:00:00Z", "1", "e30="}},
+		fuzzArgs{2, []string{"2018-10-01T11:00:00Z", "", "bnVsbA=="}},
+		fuzzArgs{2, []string{"2018-10-01T11:00:00Z", "-1"}},
+	)
+}
+
+func FuzzCloseAuction(f *testing.F) {
+	fuzzInvokeFunction(f, "closeAuction",
+		fuzzArgs{2, []string{"2018-10-01T11:00:00Z", "ENDED"}},
+		fuzzArgs{2, []string{"2018-10-01T11:00:00Z", "ASSET"}},
+		fuzzArgs{2, []string{"2018-10-01T11:00:00Z", "\u0000"}},
+	)
+}
+
+func FuzzGetUser(f *testing.F) {
+	fuzzInvokeFunction(f, "getUser",
+		fuzzArgs{0, nil},
+		fuzzArgs{0, []string{"bob@example.com"}},
+		fuzzArgs{3, nil},
+		fuzzArgs{0, []string{"\u0000"}},
+	)
+}
+
+func FuzzGetAssetsForUser(f *testing.F) {
+	fuzzInvokeFunction(f, "getAssetsForUser",
+		fuzzArgs{0, nil},
+		fuzzArgs{0, []string{"all"}},
+		fuzzArgs{3, []string{"all"}},
+	)
+}
+
+func FuzzSearchAssets(f *testing.F) {
+	fuzzInvokeFunction(f, "searchAssets",
+		fuzzArgs{0, []string{`{"filter":{"text":"vase","status":"open","asOf":"2018-10-01T10:30:00Z","currency":"USD"},"sortBy":"price","pageSize":5}`}},
+		fuzzArgs{0, []string{`{"filter":{"minPrice":"1/3","maxPrice":null,"tag":"A"}}`}},
+		fuzzArgs{0, []string{`{"filter":null,"bookmark":"ASSET"}`}},
+		fuzzArgs{0, []string{`null`}},
+	)
+}
+
+func FuzzAddCategory(f *testing.F) {
+	fuzzInvokeFunction(f, "addCategory",
+		fuzzArgs{2, []string{`{"categoryId":"cars","name":"Cars"}`}},
+		fuzzArgs{2, []string{`{"categoryId":"\u0000","name":"Cars"}`}},
+		fuzzArgs{2, []string{`null`}},
+	)
+}
+
+func FuzzGetCategories(f *testing.F) {
+	fuzzInvokeFunction(f, "getCategories", fuzzArgs{0, nil})
+}
+
+func FuzzGetAssetsByCategory(f *testing.F) {
+	fuzzInvokeFunction(f, "getAssetsByCategory",
+		fuzzArgs{0, []string{"art"}},
+		fuzzArgs{0, []string{"art", "1", "x"}},
+		fuzzArgs{0, []string{"\u0000", "-1"}},
+	)
+}
+
+func FuzzSetFeeSchedule(f *testing.F) {
+	fuzzInvokeFunction(f, "setFeeSchedule",
+		fuzzArgs{2, []string{`{"brackets":[{"from":"0","buyerPremiumPct":"20"},{"from":"1000","buyerPremiumPct":"10"}],"houseAccountEmail":"house@example.com"}`}},
+		fuzzArgs{2, []string{`{"brackets":[{"from":null}],"houseAccountEmail":"house@example.com"}`}},
+		fuzzArgs{2, []string{`{"buyerPremiumPct":"101","houseAccountEmail":"house@example.com"}`}},
+		fuzzArgs{2, []string{`null`}},
+	)
+}
+
+func FuzzGetFeeSchedule(f *testing.F) {
+	fuzzInvokeFunction(f, "getFeeSchedule", fuzzArgs{0, nil})
+}
+
+func FuzzGetSettlementsForAsset(f *testing.F) {
+	fuzzInvokeFunction(f, "getSettlementsForAsset", fuzzArgs{0, []string{"ENDED"}}, fuzzArgs{0, []string{""}})
+}
+
+func FuzzGetSettlementsForBuyer(f *testing.F) {
+	fuzzInvokeFunction(f, "getSettlementsForBuyer", fuzzArgs{1, nil}, fuzzArgs{2, []string{"bob@example.com"}}, fuzzArgs{0, []string{"bob@example.com"}})
+}
+
+func FuzzGetSettlementsForSeller(f *testing.F) {
+	fuzzInvokeFunction(f, "getSettlementsForSeller", fuzzArgs{0, nil}, fuzzArgs{2, []string{"alice@example.com"}}, fuzzArgs{3, nil})
+}
+
+func FuzzCheckConsistency(f *testing.F) {
+	fuzzInvokeFunction(f, "checkConsistency", fuzzArgs{2, nil}, fuzzArgs{0, nil})
+}
+
+func FuzzGetAssetProvenance(f *testing.F) {
+	fuzzInvokeFunction(f, "getAssetProvenance", fuzzArgs{0, []string{"ASSET"}}, fuzzArgs{0, []string{"missing"}})
+}
+
+func FuzzGetBidsForUser(f *testing.F) {
+	fuzzInvokeFunction(f, "getBidsForUser", fuzzArgs{1, nil}, fuzzArgs{3, nil}, fuzzArgs{1, []string{"EUR"}}, fuzzArgs{1, []string{"eur"}})
+}
+
+func FuzzWatchAsset(f *testing.F) {
+	fuzzInvokeFunction(f, "watchAsset", fuzzArgs{0, []string{"ASSET"}}, fuzzArgs{1, []string{"missing"}}, fuzzArgs{1, []string{""}})
+}
+
+func FuzzUnwatchAsset(f *testing.F) {
+	fuzzInvokeFunction(f, "unwatchAsset", fuzzArgs{0, []string{"ASSET"}}, fuzzArgs{3, []string{"ASSET"}})
+}
+
+func FuzzGetWatchedAssets(f *testing.F) {
+	fuzzInvokeFunction(f, "getWatchedAssets", fuzzArgs{0, nil}, fuzzArgs{3, nil})
+}
+
+func FuzzNotifyClosingSoon(f *testing.F) {
+	fuzzInvokeFunction(f, "notifyClosingSoon",
+		fuzzArgs{2, []string{"2018-10-01T10:30:00Z"}},
+		fuzzArgs{2, []string{"2018-10-01T10:30:00Z", "600"}},
+		fuzzArgs{2, []string{"2018-10-01T10:30:00Z", "-5"}},
+	)
+}
+
+func FuzzExtendAuction(f *testing.F) {
+	fuzzInvokeFunction(f, "extendAuction",
+		fuzzArgs{2, []string{"ASSET", "2018-10-02T09:00:00Z"}},
+		fuzzArgs{2, []string{"ENDED", "2018-10-02T09:00:00Z"}},
+		fuzzArgs{2, []string{"\u0000", "2018-10-02T09:00:00Z"}},
+	)
+}
+
+func FuzzDeposit(f *testing.F) {
+	fuzzInvokeFunction(f, "deposit",
+		fuzzArgs{2, []string{`{"email":"alice@example.com","amount":"50","reference":"wire"}`}},
+		fuzzArgs{2, []string{`{"email":"dave@example.com","amount":"50"}`}},
+		fuzzArgs{2, []string{`{"email":"alice@example.com","amount":"0.005"}`}},
+		fuzzArgs{2, []string{`{"email":"alice@example.com","amount":"500","currency":"JPY"}`}},
+		fuzzArgs{0, []string{`{"email":"alice@example.com","amount":"50"}`}},
+	)
+}
+
+func FuzzWithdraw(f *testing.F) {
+	fuzzInvokeFunction(f, "withdraw",
+		fuzzArgs{2, []string{`{"email":"alice@example.com","amount":"50"}`}},
+		fuzzArgs{2, []string{`{"email":"alice@example.com","amount":"1e9"}`}},
+	)
+}
+
+func FuzzGetStatement(f *testing.F) {
+	fuzzInvokeFunction(f, "getStatement",
+		fuzzArgs{0, nil},
+		fuzzArgs{2, []string{"bob@example.com", "2"}},
+		fuzzArgs{1, []string{"alice@example.com"}},
+		fuzzArgs{3, []string{"", "5", "\u0000"}},
+	)
+}
+
+func FuzzSetFxRates(f *testing.F) {
+	fuzzInvokeFunction(f, "setFxRates",
+		fuzzArgs{2, []string{`{"base":"USD","rates":{"EUR":"0.8","GBP":"0.75"}}`}},
+		fuzzArgs{2, []string{`{"base":"USD","rates":{"USD":"2"}}`}},
+		fuzzArgs{2, []string{`{"base":"USD","rates":{"EUR":"0"}}`}},
+		fuzzArgs{2, []string{`{"base":"USD","rates":{"EUR":null}}`}},
+		fuzzArgs{0, []string{`{"base":"USD","rates":{"EUR":"0.8"}}`}},
+	)
+}
+
+func FuzzGetFxRates(f *testing.F) {
+	fuzzInvokeFunction(f, "getFxRates", fuzzArgs{0, nil}, fuzzArgs{2, nil})
+}
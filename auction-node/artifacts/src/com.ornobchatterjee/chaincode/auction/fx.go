@@ -0,0 +1,141 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"sort"
+)
+
+const (
+	MAX_FX_RATES = 200
+)
+
+/**
+Replace the exchange rate table. args[0] is an FxRates with the base currency and the rate of every other currency.
+ */
+func (t *AuctionChaincode) setFxRates(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	org, _ := getMSPAttr(stub, MSP_ATTRIBUTE_ORG)
+	if org != "Org2" {
+		return unauthorized("Only Auction house users are allowed to invoke this function")
+	}
+
+	var rates FxRates
+	err := decodeInput(args[0], &rates)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if err = validateFxRates(&rates); err != nil {
+		return errorResponse(err)
+	}
+
+	rates.UpdatedBy, err = getMSPAttr(stub, MSP_ATTRIBUTE_EMAIL)
+	if err != nil {
+		return errorResponse(err)
+	}
+	rates.Timestamp, err = getTxTime(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	rates.DocType = reflect.TypeOf(rates).Name()
+	ratesBytes, err := json.Marshal(rates)
+	if err != nil {
+		return errorResponse(err)
+	}
+	ratesKey, _ := getCompositeKey(stub, FX_RATES_KEY)
+	if err = stub.PutState(ratesKey, ratesBytes); err != nil {
+		return errorResponse(err)
+	}
+	return invokeSuccess(stub, rates, nil)
+}
+
+func (t *AuctionChaincode) getFxRates(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	rates, err := getFxRatesFromLedger(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if rates == nil {
+		return errorResponse(newError(ERROR_NOT_FOUND, "", "Exchange rates are not configured"))
+	}
+	return querySuccess(rates)
+}
+
+func validateFxRates(rates *FxRates) error {
+	if len(rates.Base) == 0 {
+		return newError(ERROR_REQUIRED, "base", "Base currency is mandatory")
+	}
+	if err := checkCurrency("base", rates.Base); err != nil {
+		return err
+	}
+	if len(rates.Rates) == 0 {
+		return newError(ERROR_REQUIRED, "rates", "Exchange rates are mandatory")
+	}
+	if len(rates.Rates) > MAX_FX_RATES {
+		return newError(ERROR_TOO_MANY, "rates", "At most %v exchange rates are allowed", MAX_FX_RATES)
+	}
+	if len(rates.UpdatedBy) > 0 || rates.Timestamp != nil {
+		return newError(ERROR_READ_ONLY, "updatedBy", "Exchange rates are stamped by setFxRates")
+	}
+	currencies := make([]string, 0, len(rates.Rates))
+	for currency := range rates.Rates {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	for _, currency := range currencies {
+		field := "rates." + currency
+		if err := checkCurrency(field, currency); err != nil {
+			return err
+		}
+		if rates.Rates[currency] == nil {
+			return newError(ERROR_REQUIRED, field, "%v is mandatory", field)
+		}
+		if rates.Rates[currency].Sign() <= 0 {
+			return newError(ERROR_NOT_POSITIVE, field, "Exchange rates must be greater than zero")
+		}
+		if currency == rates.Base && rates.Rates[currency].Cmp(big.NewRat(1, 1)) != 0 {
+			return newError(ERROR_OUT_OF_RANGE, field, "The rate of the base currency must be 1")
+		}
+	}
+	return nil
+}
+
+func getFxRatesFromLedger(stub shim.ChaincodeStubInterface) (*FxRates, error) {
+	ratesKey, err := getCompositeKey(stub, FX_RATES_KEY)
+	if err != nil {
+		return nil, err
+	}
+	ratesBytes, err := stub.GetState(ratesKey)
+	if err != nil {
+		return nil, err
+	}
+	if ratesBytes == nil {
+		return nil, nil
+	}
+	var rates FxRates
+	if err = json.Unmarshal(ratesBytes, &rates); err != nil {
+		return nil, err
+	}
+	return &rates, nil
+}
+
+func (r *FxRates) rate(currency string) *big.Rat {
+	if currency == r.Base {
+		return big.NewRat(1, 1)
+	}
+	return r.Rates[currency]
+}
+
+/**
+Convert amount from one currency to another through the base currency, rounded to the minor unit of the target currency
+with FX_ROUNDING. Returns nil when either currency has no rate.
+ */
+func (r *FxRates) convert(amount *Money, from string, to string) *Money {
+	fromRate, toRate := r.rate(from), r.rate(to)
+	if amount == nil || fromRate == nil || toRate == nil {
+		return nil
+	}
+	converted := new(big.Rat).Quo(amount.rat(), fromRate)
+	return roundMoney(converted.Mul(converted, toRate), currencyScale(to), FX_ROUNDING)
+}
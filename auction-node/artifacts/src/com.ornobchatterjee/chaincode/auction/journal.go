@@ -0,0 +1,289 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// The types of journal entries. A settlement posts the hammer price and each
+// fee as an entry of its own on every party. A hold sets funds aside for a bid
+// that takes the lead and a release gives them back, neither changes the
+// balance.
+const (
+	JOURNAL_CREDIT            = "credit"
+	JOURNAL_DEPOSIT           = "deposit"
+	JOURNAL_WITHDRAWAL        = "withdrawal"
+	JOURNAL_PURCHASE          = "purchase"
+	JOURNAL_SALE              = "sale"
+	JOURNAL_BUYER_PREMIUM     = "buyerPremium"
+	JOURNAL_SELLER_COMMISSION = "sellerCommission"
+	JOURNAL_HOLD              = "hold"
+	JOURNAL_RELEASE           = "release"
+)
+
+// Journal numbers the entries of one transaction. A transaction cannot read
+// its own writes, so the sequence cannot be found on the ledger.
+type Journal struct {
+	entries []*JournalEntry
+}
+
+// UserCache holds the users one transaction reads and changes. A transaction
+// cannot read its own writes, so a user taking part in several settlements of
+// a sweep is read from the ledger once and written once, by flush.
+type UserCache struct {
+	users   map[string]*User
+	changed []string
+}
+
+/**
+Get a user, from the ledger the first time it is asked for.
+ */
+func (c *UserCache) get(stub shim.ChaincodeStubInterface, email string) (*User, error) {
+	if user, found := c.users[email]; found {
+		return user, nil
+	}
+	user, err := getUserByEmail(stub, email)
+	if err != nil {
+		return nil, err
+	}
+	if c.users == nil {
+		c.users = make(map[string]*User)
+	}
+	c.users[email] = user
+	return user, nil
+}
+
+/**
+Mark a user got from the cache as changed, so that flush stores it.
+ */
+func (c *UserCache) put(user *User) {
+	for _, email := range c.changed {
+		if email == user.Email {
+			return
+		}
+	}
+	c.changed = append(c.changed, user.Email)
+}
+
+/**
+Store every changed user, in the order they were first changed.
+ */
+func (c *UserCache) flush(stub shim.ChaincodeStubInterface) error {
+	for _, email := range c.changed {
+		if err := putUser(stub, c.users[email]); err != nil {
+			return fmt.Errorf("updating balance of %v failed : %v", email, err)
+		}
+	}
+	c.changed = nil
+	return nil
+}
+
+/**
+Add amount to the balance of user in currency and write the journal entry for it. The caller stores the user. Nothing is
+posted for a zero amount.
+ */
+func (j *Journal) post(stub shim.ChaincodeStubInterface, user *User, currency string, entryType string, amount *Money, assetId string, reference string) (*JournalEntry, error) {
+	if amount.Sign() == 0 {
+		return nil, nil
+	}
+	balance := user.balance(currency).Add(amount)
+	if user.Balances == nil {
+		user.Balances = make(map[string]*Money)
+	}
+	user.Balances[currency] = balance
+	return j.write(stub, &JournalEntry{
+		Email:     user.Email,
+		Type:      entryType,
+		Currency:  currency,
+		Amount:    amount,
+		Balance:   balance,
+		AssetId:   assetId,
+		Reference: reference,
+	})
+}
+
+/**
+Add amount to the funds of user held in currency for the leading bid on assetId and write the journal entry for it, a
+JOURNAL_HOLD or a JOURNAL_RELEASE. The caller stores the user. Nothing is posted for a zero amount.
+ */
+func (j *Journal) hold(stub shim.ChaincodeStubInterface, user *User, currency string, entryType string, amount *Money, assetId string) (*JournalEntry, error) {
+	if amount.Sign() == 0 {
+		return nil, nil
+	}
+	held := user.held(currency).Add(amount)
+	if user.Held == nil {
+		user.Held = make(map[string]*Money)
+	}
+	user.Held[currency] = held
+	return j.write(stub, &JournalEntry{
+		Email:    user.Email,
+		Type:     entryType,
+		Currency: currency,
+		Amount:   amount,
+		Balance:  user.balance(currency),
+		Held:     held,
+		AssetId:  assetId,
+	})
+}
+
+func (j *Journal) write(stub shim.ChaincodeStubInterface, entry *JournalEntry) (*JournalEntry, error) {
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return nil, err
+	}
+	entry.PostedBy, err = getMSPAttr(stub, MSP_ATTRIBUTE_EMAIL)
+	if err != nil {
+		return nil, err
+	}
+	entry.TxId = stub.GetTxID()
+	entry.Timestamp = txTime
+	entry.DocType = reflect.TypeOf(*entry).Name()
+
+	//journal keys sort by time, so the time is fixed width
+	entryKey, err := getCompositeKey(stub, COMPOSITE_KEY_JOURNAL, entry.Email, ledgerTime(*txTime), entry.TxId,
+		fmt.Sprintf("%04d", len(j.entries)))
+	if err != nil {
+		return nil, err
+	}
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	if err = stub.PutState(entryKey, entryBytes); err != nil {
+		return nil, err
+	}
+	j.entries = append(j.entries, entry)
+	return entry, nil
+}
+
+// journalPosting is one entry a transaction is about to post.
+type journalPosting struct {
+	email     string
+	entryType string
+	amount    *Money
+}
+
+func isTreasury(stub shim.ChaincodeStubInterface) bool {
+	org, _ := getMSPAttr(stub, MSP_ATTRIBUTE_ORG)
+	role, _ := getMSPAttr(stub, MSP_ATTRIBUTE_ROLE)
+	return org == "Org2" || role == ROLE_TREASURY
+}
+
+/**
+Credit a user with funds paid in. args[0] is a FundsTransfer.
+ */
+func (t *AuctionChaincode) deposit(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return t.transferFunds(stub, args[0], JOURNAL_DEPOSIT)
+}
+
+/**
+Debit a user with funds paid out. args[0] is a FundsTransfer. A balance cannot be withdrawn below zero.
+ */
+func (t *AuctionChaincode) withdraw(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return t.transferFunds(stub, args[0], JOURNAL_WITHDRAWAL)
+}
+
+func (t *AuctionChaincode) transferFunds(stub shim.ChaincodeStubInterface, transferJson string, entryType string) pb.Response {
+	if !isTreasury(stub) {
+		return unauthorized("Only Auction house and treasury users are allowed to invoke this function")
+	}
+
+	var transfer FundsTransfer
+	err := decodeInput(transferJson, &transfer)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if err = validateFundsTransfer(&transfer); err != nil {
+		return errorResponse(err)
+	}
+
+	user, err := getUserByEmail(stub, transfer.Email)
+	if err != nil {
+		return errorResponse(err)
+	}
+	amount := transfer.Amount
+	currency := currencyOf(transfer.Currency)
+	previousBalance := user.balance(currency)
+	if entryType == JOURNAL_WITHDRAWAL {
+		if previousBalance.Cmp(amount) < 0 {
+			return errorResponse(newError(ERROR_INSUFFICIENT_FUNDS, "amount", "User %v has balance %v %v and cannot withdraw %v",
+				user.Email, previousBalance, currency, amount))
+		}
+		amount = amount.Neg()
+	}
+
+	var journal Journal
+	entry, err := journal.post(stub, user, currency, entryType, amount, "", transfer.Reference)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if err = putUser(stub, user); err != nil {
+		return errorResponse(err)
+	}
+
+	var events EventBatch
+	if err = events.add(EVENT_BALANCE_CHANGED, BalanceChangedEvent{user.Email, currency, previousBalance, entry.Balance, entryType, ""}); err != nil {
+		return errorResponse(err)
+	}
+	return invokeSuccess(stub, entry, &events)
+}
+
+/**
+Page through the journal of a user, oldest entry first. args are an optional email, an optional page size and an optional
+bookmark. Only the auction house and treasury users can read the statement of another user.
+ */
+func (t *AuctionChaincode) getStatement(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	invokerEmail, err := getMSPAttr(stub, MSP_ATTRIBUTE_EMAIL)
+	if err != nil {
+		return errorResponse(err)
+	}
+	email := invokerEmail
+	if len(args) > 0 && len(args[0]) > 0 {
+		email = args[0]
+	}
+	if email != invokerEmail && !isTreasury(stub) {
+		return unauthorized("Only Auction house and treasury users can read the statement of another user")
+	}
+	if _, err = getUserByEmail(stub, email); err != nil {
+		return errorResponse(err)
+	}
+
+	size, bookmark := "", ""
+	if len(args) > 1 {
+		size = args[1]
+	}
+	if len(args) > 2 {
+		bookmark = args[2]
+	}
+	pageSize, err := parseCountArg("pageSize", size, DEFAULT_PAGE_SIZE, MAX_PAGE_SIZE,
+		fmt.Sprintf("Page size must be a number between 1 and %v", MAX_PAGE_SIZE))
+	if err != nil {
+		return errorResponse(err)
+	}
+	if err = checkLength("bookmark", bookmark, MAX_BOOKMARK_LENGTH); err != nil {
+		return errorResponse(err)
+	}
+
+	entriesIterator, metadata, err := stub.GetStateByPartialCompositeKeyWithPagination(COMPOSITE_KEY_JOURNAL, []string{email}, int32(pageSize), bookmark)
+	if err != nil {
+		return errorResponse(err)
+	}
+	defer entriesIterator.Close()
+
+	entries := make([]JournalEntry, 0)
+	for entriesIterator.HasNext() {
+		responseRange, err := entriesIterator.Next()
+		if err != nil {
+			return errorResponse(err)
+		}
+		var entry JournalEntry
+		if err = json.Unmarshal(responseRange.Value, &entry); err != nil {
+			return errorResponse(err)
+		}
+		entries = append(entries, entry)
+	}
+	return listSuccess(entries, metadata.GetBookmark())
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func (f *auctionFixture) getStatement(identity *testIdentity, args ...string) ([]JournalEntry, *ListResponse) {
+	f.t.Helper()
+	var entries []JournalEntry
+	list := decodeItems(f.t, f.mustInvoke(identity, "getStatement", args...), &entries)
+	return entries, list
+}
+
+func TestDepositAndWithdraw(t *testing.T) {
+	f := newAuctionFixture(t)
+	treasurer := newTestIdentityWithRole(t, "treasurer@example.com", "Org1", ROLE_TREASURY)
+	f.addUser(treasurer, "0")
+
+	f.expectErrorCode(ERROR_UNAUTHORIZED, "", f.alice, "deposit", `{"email":"alice@example.com","amount":"50"}`)
+	f.expectErrorCode(ERROR_UNAUTHORIZED, "", f.alice, "withdraw", `{"email":"alice@example.com","amount":"50"}`)
+	f.expectErrorCode(ERROR_REQUIRED, "amount", f.house, "deposit", `{"email":"alice@example.com"}`)
+	f.expectErrorCode(ERROR_NOT_POSITIVE, "amount", f.house, "deposit", `{"email":"alice@example.com","amount":"-5"}`)
+	f.expectErrorCode(ERROR_INVALID_EMAIL, "email", f.house, "deposit", `{"email":"alice","amount":"5"}`)
+	f.expectErrorCode(ERROR_NOT_REGISTERED, "", f.house, "deposit", `{"email":"nobody@example.com","amount":"5"}`)
+	f.expectErrorCode(ERROR_UNKNOWN_FIELD, "balance", f.house, "deposit", `{"email":"alice@example.com","amount":"5","balance":"5"}`)
+
+	var entry JournalEntry
+	decodeEntity(t, f.mustInvoke(f.house, "deposit", `{"email":"alice@example.com","amount":"250.50","reference":"wire 17"}`), &entry)
+	if entry.Type != JOURNAL_DEPOSIT || entry.Amount.Cmp(money(t, "250.50")) != 0 || entry.Balance.Cmp(money(t, "1250.50")) != 0 ||
+		entry.Reference != "wire 17" || entry.PostedBy != f.house.email {
+		t.Fatalf("deposit posted %+v", entry)
+	}
+	f.expectBalance(f.alice, "1250.50")
+
+	//a treasury user of another org can move funds as well
+	decodeEntity(t, f.mustInvoke(treasurer, "withdraw", `{"email":"alice@example.com","amount":"1000"}`), &entry)
+	if entry.Type != JOURNAL_WITHDRAWAL || entry.Amount.Cmp(money(t, "-1000")) != 0 || entry.Balance.Cmp(money(t, "250.50")) != 0 {
+		t.Fatalf("withdraw posted %+v", entry)
+	}
+	envelope := f.lastEvent()
+	if envelope == nil || len(envelope.Events) != 1 || envelope.Events[0].Type != EVENT_BALANCE_CHANGED {
+		t.Fatalf("withdraw raised %+v", envelope)
+	}
+	var balanceChanged BalanceChangedEvent
+	if err := json.Unmarshal(envelope.Events[0].Payload, &balanceChanged); err != nil {
+		t.Fatal(err)
+	}
+	if balanceChanged.Reason != JOURNAL_WITHDRAWAL || balanceChanged.Balance.Cmp(money(t, "250.50")) != 0 {
+		t.Fatalf("withdraw raised %+v", balanceChanged)
+	}
+
+	f.expectErrorCode(ERROR_INSUFFICIENT_FUNDS, "amount", f.house, "withdraw", `{"email":"alice@example.com","amount":"250.51"}`)
+	f.mustInvoke(f.house, "withdraw", `{"email":"alice@example.com","amount":"250.50"}`)
+	f.expectBalance(f.alice, "0")
+	f.expectConsistent()
+}
+
+func TestJournalOfSettlement(t *testing.T) {
+	f := newAuctionFixture(t)
+	f.mustInvoke(f.house, "setFeeSchedule", `{"buyerPremiumPct":"10","sellerCommissionPct":"5","houseAccountEmail":"house@example.com"}`)
+	assetId := f.addAsset(f.alice, "Vase", "100", time.Hour)
+	f.advance(90 * time.Minute)
+	f.placeBid(f.bob, assetId, "200")
+	f.advance(time.Hour)
+	f.getBidResult()
+
+	for _, want := range []struct {
+		identity *testIdentity
+		entries  [][3]string
+	}{
+		{f.bob, [][3]string{{JOURNAL_CREDIT, "1000", "1000"}, {JOURNAL_HOLD, "220", "1000"}, {JOURNAL_RELEASE, "-220", "1000"},
+			{JOURNAL_PURCHASE, "-200", "800"}, {JOURNAL_BUYER_PREMIUM, "-20", "780"}}},
+		{f.alice, [][3]string{{JOURNAL_CREDIT, "1000", "1000"}, {JOURNAL_SALE, "200", "1200"}, {JOURNAL_SELLER_COMMISSION, "-10", "1190"}}},
+		{f.house, [][3]string{{JOURNAL_CREDIT, "1000", "1000"}, {JOURNAL_BUYER_PREMIUM, "20", "1020"}, {JOURNAL_SELLER_COMMISSION, "10", "1030"}}},
+	} {
+		entries, _ := f.getStatement(want.identity)
+		if len(entries) != len(want.entries) {
+			t.Fatalf("statement of %v is %+v", want.identity.email, entries)
+		}
+		for i, entry := range entries {
+			if entry.Type != want.entries[i][0] || entry.Amount.Cmp(money(t, want.entries[i][1])) != 0 ||
+				entry.Balance.Cmp(money(t, want.entries[i][2])) != 0 {
+				t.Fatalf("entry %v of %v is %+v, want %v", i, want.identity.email, entry, want.entries[i])
+			}
+			if i > 0 && entry.AssetId != assetId {
+				t.Fatalf("entry %v of %v is for asset %v", i, want.identity.email, entry.AssetId)
+			}
+		}
+	}
+	f.expectConsistent()
+}
+
+func TestGetStatement(t *testing.T) {
+	f := newAuctionFixture(t)
+	for i := 1; i <= 4; i++ {
+		f.advance(time.Minute)
+		f.mustInvoke(f.house, "deposit", fmt.Sprintf(`{"email":"alice@example.com","amount":"%v"}`, i))
+	}
+
+	f.expectErrorCode(ERROR_UNAUTHORIZED, "", f.bob, "getStatement", f.alice.email)
+	f.expectErrorCode(ERROR_NOT_REGISTERED, "", f.house, "getStatement", "nobody@example.com")
+	f.expectErrorCode(ERROR_OUT_OF_RANGE, "pageSize", f.alice, "getStatement", "", "0")
+
+	//a user reads their own statement oldest entry first
+	entries, list := f.getStatement(f.alice, "", "3")
+	if list.Count != 3 || len(list.Bookmark) == 0 || entries[0].Type != JOURNAL_CREDIT || entries[2].Amount.Cmp(money(t, "2")) != 0 {
+		t.Fatalf("first page is %+v with %+v", list, entries)
+	}
+	entries, list = f.getStatement(f.house, f.alice.email, "3", list.Bookmark)
+	if list.Count != 2 || entries[1].Amount.Cmp(money(t, "4")) != 0 || entries[1].Balance.Cmp(money(t, "1010")) != 0 {
+		t.Fatalf("second page is %+v with %+v", list, entries)
+	}
+
+	//nothing was ever posted for a user who joined without funds
+	dave := newTestIdentity(t, "dave@example.com", "Org1")
+	f.addUser(dave, "0")
+	if entries, _ = f.getStatement(dave); len(entries) != 0 {
+		t.Fatalf("statement of a user without funds is %+v", entries)
+	}
+}
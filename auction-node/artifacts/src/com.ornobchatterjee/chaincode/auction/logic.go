@@ -6,67 +6,250 @@ import (
 	"encoding/json"
 	"fmt"
 	"time"
-	"math/big"
 	"reflect"
+	"sort"
+	"strings"
 )
 
+/**
+Settle the auctions that have ended. args are the current time, an optional page size and an optional bookmark.
+Fabric only allows the paginated query APIs in read only transactions, so the sweep pages through the assets itself
+using the bidEnd and key of the last processed asset as the bookmark.
+ */
 func (t *AuctionChaincode) getBidResult(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	org, _ := getMSPAttr(stub, MSP_ATTRIBUTE_ORG)
 	if org != "Org2" {
-		return shim.Error(fmt.Sprintf("Unauthorized user. Only Auction house users are allowed to invoke this function"))
+		return unauthorized("Only Auction house users are allowed to invoke this function")
 	}
 
 	t.Infof("[ getBidResult ] - Start")
 	//pass the time string so as to always get a deterministic result
 	currentTimeString := args[0]
 
-	currentTime, err := time.Parse(time.RFC3339, currentTimeString)
+	currentTime, err := parseTimeArg("currentTime", currentTimeString)
+	if err != nil {
+		return errorResponse(err)
+	}
 	t.Infof("[ getBidResult ] - Current Time %v", currentTime.String())
+
+	size := ""
+	if len(args) > 1 {
+		size = args[1]
+	}
+	pageSize, err := parseCountArg("pageSize", size, DEFAULT_BATCH_SIZE, MAX_BATCH_SIZE,
+		fmt.Sprintf("Page size must be a number between 1 and %v", MAX_BATCH_SIZE))
 	if err != nil {
-		return shim.Error(getErrorString(err))
+		return errorResponse(err)
 	}
+	var cursor *closedBidsCursor
+	if len(args) > 2 && len(args[2]) > 0 {
+		cursor, err = decodeClosedBidsCursor(args[2])
+		if err != nil {
+			return errorResponse(newError(ERROR_INVALID_FORMAT, "bookmark", "Invalid bookmark : %v", err.Error()))
+		}
+	}
+
 	//iterate over all assets that are not sold and having the bidEndTime in the past
 	//query couchdb
-	resultsIterator, err := stub.GetQueryResult(fmt.Sprint(QUERY_ALL_CLOSED_BIDS, currentTimeString))
+	query, err := getClosedBidsQuery(currentTime, cursor)
+	if err != nil {
+		return errorResponse(err)
+	}
+	resultsIterator, err := stub.GetQueryResult(query)
 	if err != nil {
-		return shim.Error(getErrorString(err))
+		return errorResponse(err)
 	}
 	defer resultsIterator.Close()
-	for resultsIterator.HasNext() {
+
+	var result BatchResult
+	var lastCursor closedBidsCursor
+	var events EventBatch
+	var journal Journal
+	var users UserCache
+	for result.Processed < pageSize && resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
 		if err != nil {
-			return shim.Error(getErrorString(err))
+			return errorResponse(err)
 		}
+		result.Processed++
 		currentAssetKey := queryResponse.Key
+		//the cursor keeps the stored bidEnd string, the query compares it as a string
+		if err = json.Unmarshal(queryResponse.Value, &lastCursor); err != nil {
+			return errorResponse(err)
+		}
+		lastCursor.Key = currentAssetKey
 		t.Infof("[ getBidResult ] - Current Asset Key for Bid Result %v", currentAssetKey)
 		assetByte, err := stub.GetState(currentAssetKey)
 
 		if err != nil {
-			return shim.Error(getErrorString(err))
+			return errorResponse(err)
 		}
 		var assetObj Asset
 		err = json.Unmarshal([]byte(assetByte), &assetObj)
 		if err != nil {
-			return shim.Error(getErrorString(err))
+			return errorResponse(err)
 		}
 
-		if (!assetObj.BidEnd.Before(currentTime)) || assetObj.IsSold {
+		if !isAuctionClosable(&assetObj, currentTime) {
 			continue
 		}
 		t.Infof("[ getBidResult ] - Current Asset Id for Bid Result %v", assetObj.AssetId)
 
-		t.declareWinnerForAsset(stub, &assetObj)
+		ownerEmail := assetObj.Owner.Email
+		settlement, err := t.declareWinnerForAsset(stub, &assetObj, &events, &journal, &users)
+		if closureErr, ok := err.(*ClosureError); ok {
+			//nothing was written for this asset, record why and carry on with the others
+			t.Warningf("[ getBidResult ] - %v", closureErr.Error())
+			if err = recordFailedClosure(stub, ownerEmail, closureErr); err != nil {
+				return errorResponse(err)
+			}
+			//keep the next sweeps from selecting the asset again and free the funds held for it
+			assetObj.ClosureFailed = true
+			if err = putAsset(stub, &assetObj); err != nil {
+				return errorResponse(err)
+			}
+			if err = releaseHolds(stub, &journal, &users, assetObj.AssetId); err != nil {
+				return errorResponse(err)
+			}
+			result.Failed++
+		} else if err != nil {
+			return errorResponse(fmt.Errorf("Settlement of asset %v aborted : %v", assetObj.AssetId, err.Error()))
+		} else if settlement != nil {
+			result.Settled++
+		}
+	}
+	if err = users.flush(stub); err != nil {
+		return errorResponse(err)
+	}
+
+	//a full page may have more assets behind it
+	if result.Processed == pageSize && resultsIterator.HasNext() {
+		result.Bookmark, err = encodeClosedBidsCursor(&lastCursor)
+		if err != nil {
+			return errorResponse(err)
+		}
+	}
+	t.Infof("[ getBidResult ] - processed %v settled %v failed %v", result.Processed, result.Settled, result.Failed)
+	//one envelope for all the auctions closed in this batch
+	return invokeSuccess(stub, result, &events)
+}
+
+/**
+Settle a single asset right away. args are the current time and the asset id.
+ */
+func (t *AuctionChaincode) closeAuction(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	org, _ := getMSPAttr(stub, MSP_ATTRIBUTE_ORG)
+	if org != "Org2" {
+		return unauthorized("Only Auction house users are allowed to invoke this function")
+	}
+
+	currentTime, err := parseTimeArg("currentTime", args[0])
+	if err != nil {
+		return errorResponse(err)
+	}
+	assetId := args[1]
+	if len(assetId) == 0 {
+		return errorResponse(newError(ERROR_REQUIRED, "assetId", "Asset ID is mandatory"))
+	}
+	t.Infof("[ closeAuction ] - asset %v at %v", assetId, currentTime.String())
+
+	assetObj, err := getAsset(stub, assetId)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if assetObj == nil {
+		return errorResponse(newError(ERROR_NOT_FOUND, "assetId", "Asset : %v is not found", assetId))
+	}
+	if assetObj.IsSold {
+		return errorResponse(newError(ERROR_INVALID_STATE, "", "Asset : %v is already sold", assetId))
+	}
+	if !isAuctionClosable(assetObj, currentTime) {
+		return errorResponse(newError(ERROR_INVALID_STATE, "", "Asset : %v bidding has not ended yet", assetId))
+	}
+
+	var events EventBatch
+	var journal Journal
+	var users UserCache
+	settlement, err := t.declareWinnerForAsset(stub, assetObj, &events, &journal, &users)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if settlement == nil {
+		return errorResponse(newError(ERROR_INVALID_STATE, "", "Asset : %v did not receive any bid", assetId))
+	}
+	if err = users.flush(stub); err != nil {
+		return errorResponse(err)
+	}
+	return invokeSuccess(stub, settlement, &events)
+}
+
+/**
+Push back the end of an auction. args are the asset id and the new end of bidding, which must be later than the
+current one.
+ */
+func (t *AuctionChaincode) extendAuction(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	org, _ := getMSPAttr(stub, MSP_ATTRIBUTE_ORG)
+	if org != "Org2" {
+		return unauthorized("Only Auction house users are allowed to invoke this function")
+	}
+
+	assetId := args[0]
+	if len(assetId) == 0 {
+		return errorResponse(newError(ERROR_REQUIRED, "assetId", "Asset ID is mandatory"))
+	}
+	bidEnd, err := parseTimeArg("bidEnd", args[1])
+	if err != nil {
+		return errorResponse(err)
 	}
+	bidEnd = bidEnd.UTC()
 
-	//filter the items which have completed the bidding cycle, over
-	return shim.Success(nil)
+	assetObj, err := getAsset(stub, assetId)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if assetObj == nil {
+		return errorResponse(newError(ERROR_NOT_FOUND, "assetId", "Asset : %v is not found", assetId))
+	}
+	if assetObj.IsSold {
+		return errorResponse(newError(ERROR_INVALID_STATE, "", "Asset : %v is already sold", assetId))
+	}
+	if assetObj.BidEnd != nil && !bidEnd.After(*assetObj.BidEnd) {
+		return errorResponse(newError(ERROR_INVALID_STATE, "bidEnd", "Asset : %v bidding already ends at %v", assetId, assetObj.BidEnd.String()))
+	}
+
+	previousBidEnd := assetObj.BidEnd
+	assetObj.BidEnd = &bidEnd
+	//the new end is worth another closing soon notice
+	assetObj.ClosingSoonNotified = false
+	//and another sweep when it ends
+	assetObj.ClosureFailed = false
+	if err = putAsset(stub, assetObj); err != nil {
+		return errorResponse(err)
+	}
+
+	watchers, err := getWatchers(stub, assetId)
+	if err != nil {
+		return errorResponse(err)
+	}
+	var events EventBatch
+	if err = events.add(EVENT_AUCTION_EXTENDED, AuctionExtendedEvent{assetId, previousBidEnd, assetObj.BidEnd, watchers}); err != nil {
+		return errorResponse(err)
+	}
+	return invokeSuccess(stub, assetObj, &events)
+}
+
+/**
+An auction can be closed once its bidding window is over, as long as the asset has not been sold yet.
+ */
+func isAuctionClosable(assetObj *Asset, currentTime time.Time) bool {
+	return assetObj.BidEnd != nil && assetObj.BidEnd.Before(currentTime) && !assetObj.IsSold
 }
 
 func (t *AuctionChaincode) placeBid(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
 	org, _ := getMSPAttr(stub, MSP_ATTRIBUTE_ORG)
 	if org != "Org1" {
-		return shim.Error(fmt.Sprintf("Unauthorized user. Only general users are allowed to invoke this function"))
+		return unauthorized("Only general users are allowed to invoke this function")
 	}
 
 	bidJsonString := args[0]
@@ -74,54 +257,51 @@ func (t *AuctionChaincode) placeBid(stub shim.ChaincodeStubInterface, args []str
 	var assetObj Asset
 	var err error
 
-	//check if user exists
+	//check if user exists and may trade
 	user, err := getUserByEmail(stub)
 	if err != nil {
-		return shim.Error(getErrorString(err))
+		return errorResponse(err)
 	}
-
-	err = json.Unmarshal([]byte(bidJsonString), &bidObj)
-	if err != nil {
-		return shim.Error(getErrorString(err))
+	if err = requireApproved(user); err != nil {
+		return errorResponse(err)
 	}
 
-	// asset exists
-	bidAssetOwnerEmail := bidObj.Asset.Owner.Email
-	bidAssetId := bidObj.Asset.AssetId
-
-	if len(bidAssetId) == 0 || len(bidAssetOwnerEmail) == 0 {
-		return shim.Error(fmt.Sprintf("Asset ID and owner email is mandatory"))
-	}
-	bidAssetKey, err := getCompositeKey(stub, COMPOSITE_KEY_OWNER_ASSET, bidAssetOwnerEmail, string(bidAssetId))
+	err = decodeInput(bidJsonString, &bidObj)
 	if err != nil {
-		return shim.Error(getErrorString(err))
+		return errorResponse(err)
 	}
 
-	foundAssetString, err := stub.GetState(bidAssetKey)
-	if foundAssetString == nil {
-		return shim.Error(fmt.Sprintf("Asset : %v is not found", bidAssetId))
-	}
-	if err != nil {
-		return shim.Error(getErrorString(err))
+	if err = validateBidInput(&bidObj); err != nil {
+		return errorResponse(err)
 	}
 
-	//unmarshal the bid
-	err = json.Unmarshal([]byte(foundAssetString), &assetObj)
+	// asset exists
+	bidAssetId := bidObj.Asset.AssetId
+	foundAsset, err := getAsset(stub, bidAssetId)
 	if err != nil {
-		return shim.Error(getErrorString(err))
+		return errorResponse(err)
+	}
+	if foundAsset == nil {
+		return errorResponse(newError(ERROR_NOT_FOUND, "assetId", "Asset : %v is not found", bidAssetId))
 	}
-	//t.Infof(fmt.Sprint("Found Asset String %v", foundAssetString))
+	assetObj = *foundAsset
 	// asset is not sold
 	if assetObj.IsSold {
-		return shim.Error(fmt.Sprintf("Asset : %v is already sold", bidAssetId))
+		return errorResponse(newError(ERROR_INVALID_STATE, "", "Asset : %v is already sold", bidAssetId))
 	}
 
 	if assetObj.Owner.Email == user.Email {
-		return shim.Error(fmt.Sprintf("Asset : %v is already owned by bidding user", bidAssetId))
+		return errorResponse(newError(ERROR_INVALID_STATE, "", "Asset : %v is already owned by bidding user", bidAssetId))
+	}
+	// bid is in the currency the asset is listed in
+	currency := currencyOf(assetObj.Currency)
+	if currencyOf(bidObj.Currency) != currency {
+		return errorResponse(newError(ERROR_CURRENCY_MISMATCH, "currency", "Asset : %v is listed in %v, not %v", bidAssetId, currency, currencyOf(bidObj.Currency)))
 	}
+	bidObj.Currency = currency
 	// bid amount is greater than or equal to the price of the asset
 	if assetObj.Price.Cmp(bidObj.BidAmount) > 0 {
-		return shim.Error(fmt.Sprintf("Asset : %v price is greater than bid price", bidAssetId))
+		return errorResponse(newError(ERROR_OUT_OF_RANGE, "bidAmount", "Asset : %v price is greater than bid price", bidAssetId))
 	}
 
 	//check if bidding time is within the limits
@@ -129,110 +309,230 @@ func (t *AuctionChaincode) placeBid(stub shim.ChaincodeStubInterface, args []str
 	bidEndTime := assetObj.BidEnd
 	bidTime := bidObj.BidTime
 	if bidStartTime != nil {
-		t.Infof(fmt.Sprint("bidStartTime: %v", bidStartTime.String()))
+		t.Infof("bidStartTime: %v", bidStartTime.String())
 	}
 
 	if bidEndTime != nil {
-		t.Infof(fmt.Sprint("bidEndTime %v", bidEndTime.String()))
+		t.Infof("bidEndTime %v", bidEndTime.String())
 	}
 
 	if bidTime != nil {
-		t.Infof(fmt.Sprint("bidTime: %v", bidTime.String()))
+		t.Infof("bidTime: %v", bidTime.String())
 	}
 	//TODO
 	//if !(bidTime.After(*bidStartTime) && bidTime.Before(*bidEndTime)) {
 	//	return shim.Error(fmt.Sprintf("Bid Time is not within the bounds of the start time and end time"))
 	//}
 
-	//check if user has sufficient balance to bid
-	if user.Balance.Cmp(bidObj.BidAmount) < 0 {
-		return shim.Error(fmt.Sprintf("User does not have sufficient amount to Bid"))
+	//check if user has sufficient balance to pay the bid and the buyer's premium on it
+	schedule, err := getFeeScheduleFromLedger(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	bidTotal := computeFees(schedule, bidObj.BidAmount, currency).BuyerTotal
+	if user.balance(currency).Cmp(bidTotal) < 0 {
+		return errorResponse(newError(ERROR_INSUFFICIENT_FUNDS, "bidAmount", "User does not have sufficient amount to Bid"))
+	}
+
+	//remember who led before this bid so that they can be told they were outbid
+	otherBid, otherLeader, _, err := getHighBid(stub, bidAssetId, user.Email)
+	if err != nil {
+		return errorResponse(err)
+	}
+	ownBidKey, _ := getCompositeKey(stub, COMPOSITE_KEY_BID_ASSET_BIDDER, bidAssetId, user.Email)
+	ownBidBytes, err := stub.GetState(ownBidKey)
+	if err != nil {
+		return errorResponse(err)
+	}
+	var ownBid Bid
+	if ownBidBytes != nil {
+		if err = json.Unmarshal(ownBidBytes, &ownBid); err != nil {
+			return errorResponse(err)
+		}
+	}
+	wasLeading := ownBid.BidAmount != nil && (otherBid == nil || outbids(ownBid.BidAmount, user.Email, otherBid, otherLeader))
+	isLeading := otherBid == nil || outbids(bidObj.BidAmount, user.Email, otherBid, otherLeader)
+
+	//funds are held for the bid that leads, a bid taking the lead has to fit in what the other leading bids leave
+	bidObj.Held = nil
+	if wasLeading {
+		bidObj.Held = ownBid.Held
+	}
+	if isLeading {
+		available := user.balance(currency).Sub(user.held(currency))
+		if bidObj.Held != nil {
+			available = available.Add(bidObj.Held)
+		}
+		if available.Cmp(bidTotal) < 0 {
+			return errorResponse(newError(ERROR_INSUFFICIENT_FUNDS, "bidAmount", "User has %v %v held for leading bids and cannot cover this bid",
+				user.held(currency).String(), currency))
+		}
+	}
+	users := UserCache{users: map[string]*User{user.Email: user}}
+	var journal Journal
+	var held *Money
+	if isLeading {
+		held = bidTotal
+	}
+	if err = setBidHold(stub, &journal, &users, bidAssetId, user.Email, &bidObj, held); err != nil {
+		return errorResponse(err)
+	}
+	//the lead changes hands, from the other leader or back to them when the bid was lowered
+	if otherBid != nil && wasLeading != isLeading {
+		otherBidKey, _ := getCompositeKey(stub, COMPOSITE_KEY_BID_ASSET_BIDDER, bidAssetId, otherLeader)
+		otherBidBytes, err := stub.GetState(otherBidKey)
+		if err != nil {
+			return errorResponse(err)
+		}
+		var leadingBid Bid
+		if err = json.Unmarshal(otherBidBytes, &leadingBid); err != nil {
+			return errorResponse(err)
+		}
+		var otherHeld *Money
+		if wasLeading {
+			otherHeld = computeFees(schedule, otherBid, currency).BuyerTotal
+		}
+		if err = setBidHold(stub, &journal, &users, bidAssetId, otherLeader, &leadingBid, otherHeld); err != nil {
+			return errorResponse(err)
+		}
+		otherBidBytes, err = json.Marshal(leadingBid)
+		if err != nil {
+			return errorResponse(err)
+		}
+		if err = stub.PutState(otherBidKey, otherBidBytes); err != nil {
+			return errorResponse(err)
+		}
+	}
+	if err = users.flush(stub); err != nil {
+		return errorResponse(err)
 	}
 
 	//place the bid
-	bidCompositeKey, _ := getCompositeKey(stub, COMPOSITE_KEY_BID_ASSET_BIDDER, bidAssetId, user.Email)
 	bidObj.DocType = reflect.TypeOf(bidObj).Name()
 	bidObj.Asset = &assetObj
 
-	bidBytes, err := json.MarshalIndent(bidObj, JSON_PREFIX, JSON_INDENT)
+	bidBytes, err := json.Marshal(bidObj)
 	if err != nil {
-		return shim.Error(getErrorString(err))
+		return errorResponse(err)
 	}
 
-	if err = stub.PutState(bidCompositeKey, []byte(bidBytes)); err != nil {
-		return shim.Error(getErrorString(err))
+	if err = stub.PutState(ownBidKey, []byte(bidBytes)); err != nil {
+		return errorResponse(err)
+	}
+	//reverse index so that a bidder can list the assets they are bidding on
+	bidderAssetKey, _ := getCompositeKey(stub, COMPOSITE_KEY_BIDDER_ASSET, user.Email, bidAssetId)
+	if err = stub.PutState(bidderAssetKey, []byte{0x00}); err != nil {
+		return errorResponse(err)
+	}
+
+	watchers, err := getWatchers(stub, bidAssetId)
+	if err != nil {
+		return errorResponse(err)
+	}
+	bidPlaced := BidPlacedEvent{
+		AssetId:   bidAssetId,
+		Bidder:    user.Email,
+		BidAmount: bidObj.BidAmount,
+		Currency:  currency,
+		IsLeading: isLeading,
+		Watchers:  watchers,
 	}
-	return shim.Success(nil)
+	if !wasLeading && otherBid != nil {
+		bidPlaced.PreviousLeader, bidPlaced.PreviousBid = otherLeader, otherBid
+	}
+	var events EventBatch
+	if err = events.add(EVENT_BID_PLACED, bidPlaced); err != nil {
+		return errorResponse(err)
+	}
+	return invokeSuccess(stub, bidObj, &events)
 }
 
 func (t *AuctionChaincode) addAssetForBid(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
 	org, _ := getMSPAttr(stub, MSP_ATTRIBUTE_ORG)
 	if org != "Org1" {
-		return shim.Error(fmt.Sprintf("Unauthorized user. Only general users are allowed to invoke this function"))
+		return unauthorized("Only general users are allowed to invoke this function")
 	}
 
 	assetJson := args[0]
-	currentTimeString := args[0]
 	var assetObj Asset
 	var err error
 
-	currentTime, err := time.Parse(time.RFC3339, currentTimeString)
+	currentTime, err := getTxTime(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
 
-	err = json.Unmarshal([]byte(assetJson), &assetObj)
+	err = decodeInput(assetJson, &assetObj)
 	if err != nil {
-		return shim.Error(getErrorString(err))
+		return errorResponse(err)
+	}
+	if err = validateAssetInput(&assetObj); err != nil {
+		return errorResponse(err)
 	}
 
-	//check if user exists
+	//check if user exists and may trade
 	user, err := getUserByEmail(stub)
 	if err != nil {
-		return shim.Error(getErrorString(err))
+		return errorResponse(err)
+	}
+	if err = requireApproved(user); err != nil {
+		return errorResponse(err)
 	}
 
-	//check if asset already exists with the given id for the same owner
-	ownerAssetCompositeKey, _ := getCompositeKey(stub, COMPOSITE_KEY_OWNER_ASSET, user.Email, assetObj.AssetId)
-	foundAssetString, err := stub.GetState(ownerAssetCompositeKey)
+	//asset ids are assigned here and identify the asset for its whole life, whoever owns it
+	assetObj.AssetId = newAssetId(stub)
+	foundAsset, err := getAsset(stub, assetObj.AssetId)
 	if err != nil {
-		return shim.Error(getErrorString(err))
-	}
-	if foundAssetString != nil {
-		return shim.Error(fmt.Sprintf("Asset with the same Id already belongs to the owner"))
+		return errorResponse(err)
 	}
-	var ZERO = new(big.Rat)
-	ZERO.SetString("0")
-	//check if the price of the item is greater than zero
-	if assetObj.Price.Cmp(ZERO) <= 0 {
-		return shim.Error(fmt.Sprintf("Asset : %v price cannot be zero or less than zero", assetObj.AssetId))
+	if foundAsset != nil {
+		return errorResponse(newError(ERROR_ALREADY_EXISTS, "", "Asset with the same Id already exists"))
 	}
 
 	bidStartTime := assetObj.BidStart
-	bidEndTime := assetObj.BidStart
-
-	t.Infof(fmt.Sprint("Current Time %v", currentTime.String()))
-	if bidEndTime.Before(*bidStartTime) {
-		return shim.Error(fmt.Sprintf("Incorrect Bid Duration"))
-	}
+	bidEndTime := assetObj.BidEnd
 
+	t.Infof("Current Time %v", currentTime.String())
 	//check if the bid duration is in the future
 	if !(currentTime.Before(*bidStartTime) && currentTime.Before(*bidEndTime)) {
-		return shim.Error(fmt.Sprintf("Bid Duration must be in the future"))
+		return errorResponse(newError(ERROR_OUT_OF_RANGE, "bidStart", "Bid Duration must be in the future"))
 	}
 
+	if err = validateAssetCategory(stub, &assetObj); err != nil {
+		return errorResponse(err)
+	}
+
+	//numeric copy of the price so that rich queries can filter and sort on it, never used for settlement
+	assetObj.PriceIndex = assetObj.Price.Float64()
+	assetObj.Currency = currencyOf(assetObj.Currency)
+
+	//keep the bidding window in UTC so that rich queries can compare the times as strings
+	utcBidStart, utcBidEnd := assetObj.BidStart.UTC(), assetObj.BidEnd.UTC()
+	assetObj.BidStart, assetObj.BidEnd = &utcBidStart, &utcBidEnd
+
 	//set the reference of the
 	assetObj.Owner = new(User)
 	assetObj.Owner.Email = user.Email
 	assetObj.IsSold = false
 	assetObj.DocType = reflect.TypeOf(assetObj).Name()
-	assetBytes, err := json.MarshalIndent(assetObj, JSON_PREFIX, JSON_INDENT)
-	if err != nil {
-		return shim.Error(getErrorString(err))
+	if err = putAsset(stub, &assetObj); err != nil {
+		return errorResponse(err)
+	}
+	if err = putOwnerIndex(stub, user.Email, assetObj.AssetId); err != nil {
+		return errorResponse(err)
 	}
-	if err = stub.PutState(ownerAssetCompositeKey, []byte(assetBytes)); err != nil {
-		return shim.Error(getErrorString(err))
+	if err = putCategoryIndex(stub, &assetObj); err != nil {
+		return errorResponse(err)
 	}
 
-	return shim.Success(nil)
+	var events EventBatch
+	assetListed := AssetListedEvent{assetObj.AssetId, assetObj.Name, user.Email, assetObj.Category, assetObj.Price, assetObj.Currency,
+		assetObj.BidStart, assetObj.BidEnd}
+	if err = events.add(EVENT_ASSET_LISTED, assetListed); err != nil {
+		return errorResponse(err)
+	}
+	return invokeSuccess(stub, assetObj, &events)
 }
 
 func (t *AuctionChaincode) addUser(stub shim.ChaincodeStubInterface, args []string) pb.Response {
@@ -242,79 +542,78 @@ func (t *AuctionChaincode) addUser(stub shim.ChaincodeStubInterface, args []stri
 
 	invokerEmail, err := getMSPAttr(stub, MSP_ATTRIBUTE_EMAIL)
 	if err != nil {
-		return shim.Error(getErrorString(err))
+		return errorResponse(err)
 	}
 
 	invokerEmailKey, _ := getCompositeKey(stub, USER_KEY, invokerEmail)
 	invokerString, err := stub.GetState(invokerEmailKey)
 	if err != nil {
-		return shim.Error(getErrorString(err))
+		return errorResponse(err)
 	}
 	//user already exists
 	if invokerString != nil {
-		return shim.Error(fmt.Sprintf("User with email %v already exists", invokerEmail))
+		return errorResponse(newError(ERROR_ALREADY_EXISTS, "", "User with email %v already exists", invokerEmail))
 	}
 
-	err = json.Unmarshal([]byte(userString), &user)
+	err = decodeInput(userString, &user)
 	if err != nil {
-		return shim.Error(getErrorString(err))
-	}
-
-	if len(user.UserId) == 0 {
-		return shim.Error(fmt.Sprintf("User Id is mandatory"))
+		return errorResponse(err)
 	}
 
-	if user.Balance == nil {
-		return shim.Error(fmt.Sprintf("User Balance is mandatory"))
+	if err = validateUserInput(&user); err != nil {
+		return errorResponse(err)
 	}
 	user.Email = invokerEmail
+	user.Status = USER_STATUS_PENDING
 	user.DocType = reflect.TypeOf(user).Name()
-	userBytes, err := json.MarshalIndent(user, JSON_PREFIX, JSON_INDENT)
+	userBytes, err := json.Marshal(user)
 	if err != nil {
-		return shim.Error(getErrorString(err))
+		return errorResponse(err)
 	}
 
 	if err = stub.PutState(invokerEmailKey, []byte(userBytes)); err != nil {
-		return shim.Error(getErrorString(err))
+		return errorResponse(err)
 	}
 
-	return shim.Success(nil)
+	return invokeSuccess(stub, user, nil)
 }
 
 /**
 Transfer the asset from original owner to new owner with the provided email
  */
 func (t *AuctionChaincode) transferAsset(stub shim.ChaincodeStubInterface, assetObj *Asset, newOwnerEmail string) (error) {
-	oldAssetKey, _ := getCompositeKey(stub, COMPOSITE_KEY_OWNER_ASSET, assetObj.Owner.Email, assetObj.AssetId)
-	err := stub.DelState(oldAssetKey)
+	oldIndexKey, err := getCompositeKey(stub, COMPOSITE_KEY_OWNER_ASSET, assetObj.Owner.Email, assetObj.AssetId)
 	if err != nil {
 		return err
 	}
-	assetObj.Owner.Email = newOwnerEmail
-	assetObj.IsSold = true
-	newAssetKey, _ := getCompositeKey(stub, COMPOSITE_KEY_OWNER_ASSET, newOwnerEmail, assetObj.AssetId)
-	newAssetBytes, err := json.MarshalIndent(assetObj, JSON_PREFIX, JSON_INDENT)
-	if err != nil {
+	if err = stub.DelState(oldIndexKey); err != nil {
 		return err
 	}
-	if err = stub.PutState(newAssetKey, []byte(newAssetBytes)); err != nil {
+	assetObj.Owner.Email = newOwnerEmail
+	assetObj.IsSold = true
+	if err = putAsset(stub, assetObj); err != nil {
 		return err
 	}
-	return nil
+	return putOwnerIndex(stub, newOwnerEmail, assetObj.AssetId)
 }
 
-func (t *AuctionChaincode) declareWinnerForAsset(stub shim.ChaincodeStubInterface, assetObj *Asset) (error) {
+/**
+Settle the auction of an asset. The asset goes to the highest bidder who can pay, bids of bidders who cannot are passed
+over. Everything that can make the settlement fail for a business reason is checked before anything is written and
+reported as a ClosureError. Any other error leaves the transaction half written, so the caller
+must abort the transaction. Returns nil when the asset did not receive any bid. The events of the settlement are added
+to events, which the caller emits, and the parties are read and changed through users, which the caller flushes.
+ */
+func (t *AuctionChaincode) declareWinnerForAsset(stub shim.ChaincodeStubInterface, assetObj *Asset, events *EventBatch, journal *Journal, users *UserCache) (*Settlement, error) {
 	t.Infof("[ declareWinnerForAsset ] - start for asset id %v", assetObj.AssetId)
 
 	assetId := assetObj.AssetId
 	availableBidsIterator, err := stub.GetStateByPartialCompositeKey(COMPOSITE_KEY_BID_ASSET_BIDDER, []string{assetId})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	var maxBid = new(big.Rat)
-	maxBid.SetString("0")
-	var maxBidderEmail string
+	var rankedBids []rankedBid
 	hasBids := availableBidsIterator.HasNext()
 
 	t.Infof("[ declareWinnerForAsset ] - hasBids %v", hasBids)
@@ -324,86 +623,179 @@ func (t *AuctionChaincode) declareWinnerForAsset(stub shim.ChaincodeStubInterfac
 		var currBidObj Bid
 		responseRange, err := availableBidsIterator.Next()
 		if err != nil {
-			return err
+			return nil, err
 		}
 		currentBidValBytes := responseRange.Value
 		currentBidKey := responseRange.Key
 		t.Infof("[ declareWinnerForAsset ] - currentBidKey %v", currentBidKey)
 
-		_, currentBidKeyParts, _ := stub.SplitCompositeKey(currentBidKey)
+		_, currentBidKeyParts, err := stub.SplitCompositeKey(currentBidKey)
+		if err != nil {
+			return nil, err
+		}
 		currentBidderEmail := currentBidKeyParts[1]
 
 		t.Infof("[ declareWinnerForAsset ] - currentBidderEmail %v", currentBidderEmail)
 
 		err = json.Unmarshal([]byte(currentBidValBytes), &currBidObj)
 		if err != nil {
-			return err
-		}
-		if currBidObj.BidAmount.Cmp(maxBid) > 0 {
-			maxBid = currBidObj.BidAmount
-			maxBidderEmail = currentBidderEmail
+			return nil, err
 		}
+		rankedBids = append(rankedBids, rankedBid{currentBidderEmail, currBidObj.BidAmount})
 	}
 
-	if hasBids {
-		t.Infof("[ declareWinnerForAsset ] - maxBidderEmail %v", maxBidderEmail)
-		t.Infof("[ declareWinnerForAsset ] - maxBid %v", maxBid.String())
-
-		user, err := getUserByEmail(stub, maxBidderEmail)
-		if err != nil {
-			return err
-		}
-		//deduct the balance
-		user.Balance.Sub(user.Balance, maxBid)
-		t.Infof("[ declareWinnerForAsset ] - userId %v has Balance %v ", user.UserId, user.Balance)
+	if !hasBids {
+		return nil, nil
+	}
+	bidderCount := len(rankedBids)
+	//highest bid first, equal bids in key order like getHighBid
+	sort.SliceStable(rankedBids, func(i, j int) bool {
+		return outbids(rankedBids[i].amount, rankedBids[i].email, rankedBids[j].amount, rankedBids[j].email)
+	})
 
-		maxBidderEmailKey, _ := getCompositeKey(stub, USER_KEY, maxBidderEmail)
+	schedule, err := getFeeScheduleFromLedger(stub)
+	if err != nil {
+		return nil, err
+	}
+	//placeBid only accepts bids in the currency of the asset, so all money moves in that currency
+	currency := currencyOf(assetObj.Currency)
 
-		userBytes, err := json.MarshalIndent(user, JSON_PREFIX, JSON_INDENT)
-		if err != nil {
-			return err
+	//the lot goes to the highest bidder who can pay the hammer price and the buyer's premium
+	var maxBidderEmail string
+	var winner *User
+	var fees *FeeBreakdown
+	var shortfalls []string
+	for _, bid := range rankedBids {
+		bidder, err := users.get(stub, bid.email)
+		if chaincodeErr, ok := err.(*ChaincodeError); ok && chaincodeErr.Code == ERROR_NOT_REGISTERED {
+			shortfalls = append(shortfalls, fmt.Sprintf("bidder %v is not registered", bid.email))
+			continue
+		} else if err != nil {
+			//the ledger could not be read, passing the bidder over would sell the lot to the wrong bidder
+			return nil, fmt.Errorf("loading bidder %v failed : %v", bid.email, err)
 		}
-		if err = stub.PutState(maxBidderEmailKey, []byte(userBytes)); err != nil {
-			return err
+		bidFees := computeFees(schedule, bid.amount, currency)
+		if bidder.balance(currency).Cmp(bidFees.BuyerTotal) < 0 {
+			shortfalls = append(shortfalls, fmt.Sprintf("bidder %v has balance %v %v but owes %v", bid.email, bidder.balance(currency).String(),
+				currency, bidFees.BuyerTotal.String()))
+			continue
 		}
-
-		//add the balance to the owner of the asset
-		originalOwnerEmail := assetObj.Owner.Email
-		originalOwner, err := getUserByEmail(stub, originalOwnerEmail)
-		if err != nil {
-			return err
+		maxBidderEmail, winner, fees = bid.email, bidder, bidFees
+		break
+	}
+	if winner == nil {
+		return nil, &ClosureError{assetId, "no bidder can pay, " + strings.Join(shortfalls, ", ")}
+	}
+	t.Infof("[ declareWinnerForAsset ] - maxBidderEmail %v", maxBidderEmail)
+	t.Infof("[ declareWinnerForAsset ] - maxBid %v", fees.HammerPrice.String())
+	t.Infof("[ declareWinnerForAsset ] - buyer premium %v seller commission %v", fees.BuyerPremium.String(), fees.SellerCommission.String())
+
+	//get every party once, keyed by email, so that a user taking part twice is not counted twice in the events
+	originalOwnerEmail := assetObj.Owner.Email
+	parties := map[string]*User{maxBidderEmail: winner}
+	previousBalances := map[string]*Money{maxBidderEmail: winner.balance(currency)}
+	reasons := map[string]string{maxBidderEmail: "purchase"}
+	partyEmails := []string{maxBidderEmail}
+	for i, email := range []string{originalOwnerEmail, fees.HouseAccountEmail} {
+		if len(email) == 0 || parties[email] != nil {
+			continue
 		}
-		originalOwner.Balance.Add(originalOwner.Balance, maxBid)
-		t.Infof("[ declareWinnerForAsset ] - userId %v has Balance %v ", originalOwner.UserId, originalOwner.Balance)
-
-		originalOwnerEmailKey, err := getCompositeKey(stub, USER_KEY, originalOwnerEmail)
-		originalOwnerBytes, err := json.MarshalIndent(originalOwner, JSON_PREFIX, JSON_INDENT)
-		if err != nil {
-			return err
+		party, err := users.get(stub, email)
+		if chaincodeErr, ok := err.(*ChaincodeError); ok && chaincodeErr.Code == ERROR_NOT_REGISTERED {
+			return nil, &ClosureError{assetId, fmt.Sprintf("user %v is not registered", email)}
+		} else if err != nil {
+			return nil, fmt.Errorf("loading user %v failed : %v", email, err)
 		}
-		if err = stub.PutState(originalOwnerEmailKey, []byte(originalOwnerBytes)); err != nil {
-			return err
+		parties[email] = party
+		previousBalances[email] = party.balance(currency)
+		reasons[email] = []string{"sale", "fees"}[i]
+		partyEmails = append(partyEmails, email)
+	}
+
+	//all checks passed, from here on any failure must abort the transaction
+	//the auction is over, what was held for the leading bid is given back before the winner pays
+	if err = releaseHolds(stub, journal, users, assetId); err != nil {
+		return nil, fmt.Errorf("releasing the funds held for asset %v failed : %v", assetId, err)
+	}
+	//the winner pays the hammer price and the buyer's premium, the owner of the asset receives the hammer price less the
+	//seller's commission and both fees are credited to the auction house account
+	postings := []journalPosting{
+		{maxBidderEmail, JOURNAL_PURCHASE, fees.HammerPrice.Neg()},
+		{maxBidderEmail, JOURNAL_BUYER_PREMIUM, fees.BuyerPremium.Neg()},
+		{originalOwnerEmail, JOURNAL_SALE, fees.HammerPrice},
+		{originalOwnerEmail, JOURNAL_SELLER_COMMISSION, fees.SellerCommission.Neg()},
+	}
+	if len(fees.HouseAccountEmail) > 0 {
+		postings = append(postings,
+			journalPosting{fees.HouseAccountEmail, JOURNAL_BUYER_PREMIUM, fees.BuyerPremium},
+			journalPosting{fees.HouseAccountEmail, JOURNAL_SELLER_COMMISSION, fees.SellerCommission})
+	}
+	for _, posting := range postings {
+		if _, err = journal.post(stub, parties[posting.email], currency, posting.entryType, posting.amount, assetId, ""); err != nil {
+			return nil, fmt.Errorf("posting %v of %v failed : %v", posting.entryType, posting.email, err)
+		}
+	}
+
+	for _, email := range partyEmails {
+		party := parties[email]
+		t.Infof("[ declareWinnerForAsset ] - userId %v has Balance %v %v", party.UserId, party.balance(currency), currency)
+		users.put(party)
+		balanceChanged := BalanceChangedEvent{email, currency, previousBalances[email], party.balance(currency), reasons[email], assetId}
+		if err = events.add(EVENT_BALANCE_CHANGED, balanceChanged); err != nil {
+			return nil, err
 		}
-		t.transferAsset(stub, assetObj, maxBidderEmail)
 	}
-	return nil
+
+	assetObj.SoldPrice = fees.HammerPrice
+	assetObj.ClosureFailed = false
+	if err = t.transferAsset(stub, assetObj, maxBidderEmail); err != nil {
+		return nil, fmt.Errorf("transferring asset %v to %v failed : %v", assetId, maxBidderEmail, err)
+	}
+	if err = events.add(EVENT_ASSET_TRANSFERRED, AssetTransferredEvent{assetId, originalOwnerEmail, maxBidderEmail, fees.HammerPrice, currency}); err != nil {
+		return nil, err
+	}
+
+	settlement := Settlement{
+		AssetId:      assetId,
+		AssetName:    assetObj.Name,
+		SellerEmail:  originalOwnerEmail,
+		WinnerEmail:  maxBidderEmail,
+		WinningBid:   fees.HammerPrice,
+		PriceCharged: fees.BuyerTotal,
+		Currency:     currency,
+		Fees:         fees,
+		BidderCount:  bidderCount,
+	}
+	if err = recordSettlement(stub, &settlement); err != nil {
+		return nil, fmt.Errorf("recording settlement of asset %v failed : %v", assetId, err)
+	}
+	if err = clearFailedClosure(stub, assetId, originalOwnerEmail); err != nil {
+		return nil, err
+	}
+	if err = events.add(EVENT_AUCTION_CLOSED, AuctionClosedEvent{assetId, originalOwnerEmail, maxBidderEmail, fees.HammerPrice, currency, bidderCount}); err != nil {
+		return nil, err
+	}
+	return &settlement, nil
 }
 
 func (t *AuctionChaincode) getAssetsForUser(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	mode := args[0]
+	var mode string
+	if len(args) > 0 {
+		mode = args[0]
+	}
 	user, err := getUserByEmail(stub);
 	if err != nil {
-		return shim.Error(getErrorString(err))
+		return errorResponse(err)
 	}
 	var availableAssetsIterator shim.StateQueryIteratorInterface
 	if mode == "all" {
-		availableAssetsIterator, err = stub.GetStateByPartialCompositeKey(COMPOSITE_KEY_OWNER_ASSET, []string{})
+		availableAssetsIterator, err = stub.GetStateByPartialCompositeKey(COMPOSITE_KEY_ASSET, []string{})
 	}else {
 		availableAssetsIterator, err = stub.GetStateByPartialCompositeKey(COMPOSITE_KEY_OWNER_ASSET, []string{user.Email})
 	}
 
 	if err != nil {
-		return shim.Error(getErrorString(err))
+		return errorResponse(err)
 	}
 
 	var assets = make([]Asset,0);
@@ -413,24 +805,30 @@ func (t *AuctionChaincode) getAssetsForUser(stub shim.ChaincodeStubInterface, ar
 		var currAssetObj Asset
 		responseRange, err := availableAssetsIterator.Next()
 		if err != nil {
-			return shim.Error(getErrorString(err))
+			return errorResponse(err)
 		}
 		currentAssetValBytes := responseRange.Value
-		currentBidKey := responseRange.Key
 
-		_, currentBidKeyParts, _ := stub.SplitCompositeKey(currentBidKey)
-		currentBidderEmail := currentBidKeyParts[1]
-
-		t.Infof("[ declareWinnerForAsset ] - currentBidderEmail %v", currentBidderEmail)
+		//the owner index only holds the key, the asset itself is stored under its id
+		if mode != "all" {
+			_, currentAssetKeyParts, err := stub.SplitCompositeKey(responseRange.Key)
+			if err != nil {
+				return errorResponse(err)
+			}
+			currentAssetKey, _ := getCompositeKey(stub, COMPOSITE_KEY_ASSET, currentAssetKeyParts[1])
+			currentAssetValBytes, err = stub.GetState(currentAssetKey)
+			if err != nil {
+				return errorResponse(err)
+			}
+		}
 
 		err = json.Unmarshal([]byte(currentAssetValBytes), &currAssetObj)
 		if err != nil {
-			return shim.Error(getErrorString(err))
+			return errorResponse(err)
 		}
 		assets = append(assets, currAssetObj)
 	}
-	assetsBytes,err := json.MarshalIndent(assets, JSON_PREFIX, JSON_INDENT)
-	return shim.Success(assetsBytes);
+	return listSuccess(assets, "")
 }
 
 func (t *AuctionChaincode) getUser(stub shim.ChaincodeStubInterface, args []string) pb.Response {
@@ -442,11 +840,7 @@ func (t *AuctionChaincode) getUser(stub shim.ChaincodeStubInterface, args []stri
 		user, err = getUserByEmail(stub);
 	}
 	if err != nil {
-		return shim.Error(getErrorString(err))
-	}
-	userBytes, err := json.MarshalIndent(&user, JSON_PREFIX, JSON_INDENT)
-	if err != nil {
-		return shim.Error(getErrorString(err))
+		return errorResponse(err)
 	}
-	return shim.Success(userBytes)
+	return querySuccess(user)
 }
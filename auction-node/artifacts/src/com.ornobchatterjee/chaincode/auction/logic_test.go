@@ -0,0 +1,653 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type auctionFixture struct {
+	*testLedger
+	alice *testIdentity
+	bob   *testIdentity
+	carol *testIdentity
+	house *testIdentity
+}
+
+// newAuctionFixture registers alice, bob and carol as general users and house
+// as an auction house user, each with a balance of 1000.
+func newAuctionFixture(t *testing.T) *auctionFixture {
+	f := &auctionFixture{
+		testLedger: newTestLedger(t),
+		alice:      newTestIdentity(t, "alice@example.com", "Org1"),
+		bob:        newTestIdentity(t, "bob@example.com", "Org1"),
+		carol:      newTestIdentity(t, "carol@example.com", "Org1"),
+		house:      newTestIdentity(t, "house@example.com", "Org2"),
+	}
+	for _, identity := range []*testIdentity{f.alice, f.bob, f.carol, f.house} {
+		f.addUser(identity, "1000")
+	}
+	return f
+}
+
+func (f *auctionFixture) expectBalance(identity *testIdentity, want string) {
+	f.t.Helper()
+	if balance := f.getUser(identity, identity.email).balance(DEFAULT_CURRENCY); balance.Cmp(money(f.t, want)) != 0 {
+		f.t.Fatalf("balance of %v is %v, want %v", identity.email, balance.String(), want)
+	}
+}
+
+func (f *auctionFixture) expectConsistent() {
+	f.t.Helper()
+	var report ConsistencyReport
+	if err := json.Unmarshal(f.mustInvoke(f.house, "checkConsistency"), &report); err != nil {
+		f.t.Fatal(err)
+	}
+	if len(report.Violations) > 0 {
+		f.t.Fatalf("ledger is inconsistent : %v", strings.Join(report.Violations, "; "))
+	}
+}
+
+func (f *auctionFixture) getBidResult(args ...string) BatchResult {
+	f.t.Helper()
+	var result BatchResult
+	args = append([]string{f.now.Format(time.RFC3339)}, args...)
+	decodeEntity(f.t, f.mustInvoke(f.house, "getBidResult", args...), &result)
+	return result
+}
+
+func TestAddUser(t *testing.T) {
+	l := newTestLedger(t)
+	alice := newTestIdentity(t, "alice@example.com", "Org1")
+
+	l.expectError("Incomplete JSON document", alice, "addUser", `{"userId":`)
+	l.expectError("User Id is mandatory", alice, "addUser", `{"phone":"12"}`)
+	l.expectError("User Balance cannot be set", alice, "addUser", `{"userId":"alice","balances":{"USD":"10"}}`)
+
+	l.mustInvoke(alice, "addUser", `{"userId":"alice","email":"mallory@example.com"}`)
+	user := l.getUser(alice, alice.email)
+	if user.Email != alice.email {
+		t.Fatalf("user registered as %v, want the email of the certificate %v", user.Email, alice.email)
+	}
+	if user.UserId != "alice" || len(user.Balances) != 0 || user.Status != USER_STATUS_PENDING || user.DocType != "User" {
+		t.Fatalf("unexpected user %+v", user)
+	}
+
+	l.expectError("User with email alice@example.com already exists", alice, "addUser", `{"userId":"alice2"}`)
+}
+
+func TestGetUser(t *testing.T) {
+	f := newAuctionFixture(t)
+
+	var own User
+	if err := json.Unmarshal(f.mustInvoke(f.alice, "getUser"), &own); err != nil {
+		t.Fatal(err)
+	}
+	if own.Email != f.alice.email {
+		t.Fatalf("getUser without arguments returned %v, want the invoker %v", own.Email, f.alice.email)
+	}
+	if other := f.getUser(f.alice, f.bob.email); other.Email != f.bob.email {
+		t.Fatalf("getUser(%v) returned %v", f.bob.email, other.Email)
+	}
+
+	f.expectError("user not registered", f.alice, "getUser", "nobody@example.com")
+	f.expectError("user not registered", newTestIdentity(t, "dave@example.com", "Org1"), "getUser")
+}
+
+func TestAddAssetForBid(t *testing.T) {
+	f := newAuctionFixture(t)
+	f.mustInvoke(f.house, "addCategory", `{"categoryId":"art","name":"Art"}`)
+	window := func(start time.Duration, end time.Duration) string {
+		return fmt.Sprintf(`"bidStart":%q,"bidEnd":%q`, f.now.Add(start).Format(time.RFC3339), f.now.Add(end).Format(time.RFC3339))
+	}
+
+	tests := []struct {
+		name     string
+		identity *testIdentity
+		asset    string
+		want     string
+	}{
+		{"auction house user", f.house, `{"name":"Vase","price":"10",` + window(time.Hour, 2*time.Hour) + `}`, "Only general users"},
+		{"malformed json", f.alice, `{"name":`, "Incomplete JSON document"},
+		{"unregistered seller", newTestIdentity(t, "dave@example.com", "Org1"), `{"name":"Vase","price":"10",` + window(time.Hour, 2*time.Hour) + `}`, "user not registered"},
+		{"no price", f.alice, `{"name":"Vase",` + window(time.Hour, 2*time.Hour) + `}`, "Asset price is mandatory"},
+		{"no bid end", f.alice, `{"name":"Vase","price":"10","bidStart":"2018-10-01T10:00:00Z"}`, "Bid end is mandatory"},
+		{"zero price", f.alice, `{"name":"Vase","price":"0",` + window(time.Hour, 2*time.Hour) + `}`, "price cannot be zero or less than zero"},
+		{"negative price", f.alice, `{"name":"Vase","price":"-1",` + window(time.Hour, 2*time.Hour) + `}`, "price cannot be zero or less than zero"},
+		{"end before start", f.alice, `{"name":"Vase","price":"10",` + window(2*time.Hour, time.Hour) + `}`, "Incorrect Bid Duration"},
+		{"started already", f.alice, `{"name":"Vase","price":"10",` + window(-time.Hour, time.Hour) + `}`, "Bid Duration must be in the future"},
+		{"unknown category", f.alice, `{"name":"Vase","price":"10","category":"cars",` + window(time.Hour, 2*time.Hour) + `}`, "Category cars is not defined"},
+		{"too many tags", f.alice, `{"name":"Vase","price":"10","tags":["1","2","3","4","5","6","7","8","9","10","11"],` + window(time.Hour, 2*time.Hour) + `}`, "at most 10 tags"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f.t = t
+			f.expectError(test.want, test.identity, "addAssetForBid", test.asset)
+		})
+	}
+	f.t = t
+
+	payload := f.mustInvoke(f.alice, "addAssetForBid", `{"name":"Vase","price":"10","category":"art","tags":[" Blue ","blue","Ming"],`+window(time.Hour, 2*time.Hour)+`}`)
+	var asset Asset
+	response := decodeEntity(t, payload, &asset)
+	if len(response.TxId) == 0 || len(response.Events) != 1 || response.Events[0].Type != EVENT_ASSET_LISTED {
+		t.Fatalf("invoke response is %+v", response)
+	}
+	if len(asset.AssetId) == 0 {
+		t.Fatalf("asset id %q was not assigned by the chaincode", asset.AssetId)
+	}
+	if asset.Owner.Email != f.alice.email || asset.IsSold || asset.PriceIndex != 10 {
+		t.Fatalf("unexpected asset %+v", asset)
+	}
+	if strings.Join(asset.Tags, ",") != "blue,ming" {
+		t.Fatalf("tags are %v, want [blue ming]", asset.Tags)
+	}
+	if stored := f.getAsset(asset.AssetId); stored == nil || stored.Name != "Vase" {
+		t.Fatalf("asset %v is not stored", asset.AssetId)
+	}
+
+	envelope := f.lastEvent()
+	if envelope == nil || len(envelope.Events) != 1 || envelope.Events[0].Type != EVENT_ASSET_LISTED {
+		t.Fatalf("expected one %v event, got %+v", EVENT_ASSET_LISTED, envelope)
+	}
+	f.expectConsistent()
+}
+
+func TestPlaceBid(t *testing.T) {
+	f := newAuctionFixture(t)
+	assetId := f.addAsset(f.alice, "Vase", "100", time.Hour)
+	bid := func(assetId string, amount string) string {
+		return fmt.Sprintf(`{"asset":{"assetId":%q},"bidAmount":%q}`, assetId, amount)
+	}
+
+	tests := []struct {
+		name     string
+		identity *testIdentity
+		bid      string
+		want     string
+	}{
+		{"auction house user", f.house, bid(assetId, "150"), "Only general users"},
+		{"unregistered bidder", newTestIdentity(t, "dave@example.com", "Org1"), bid(assetId, "150"), "user not registered"},
+		{"malformed json", f.bob, `{"asset":`, "Incomplete JSON document"},
+		{"no asset", f.bob, `{"bidAmount":"150"}`, "Asset ID is mandatory"},
+		{"no asset id", f.bob, `{"asset":{},"bidAmount":"150"}`, "Asset ID is mandatory"},
+		{"no amount", f.bob, `{"asset":{"assetId":"` + assetId + `"}}`, "Bid amount is mandatory"},
+		{"unknown asset", f.bob, bid("missing", "150"), "Asset : missing is not found"},
+		{"own asset", f.alice, bid(assetId, "150"), "is already owned by bidding user"},
+		{"below price", f.bob, bid(assetId, "99.99"), "price is greater than bid price"},
+		{"above balance", f.bob, bid(assetId, "1000.01"), "does not have sufficient amount to Bid"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f.t = t
+			f.expectError(test.want, test.identity, "placeBid", test.bid, "-")
+		})
+	}
+	f.t = t
+
+	if response := f.placeBid(f.bob, assetId, "150"); response.Status != 200 {
+		t.Fatalf("bid failed : %v", response.Message)
+	}
+	bidPlaced := f.bidPlacedEvent()
+	if !bidPlaced.IsLeading || len(bidPlaced.PreviousLeader) > 0 {
+		t.Fatalf("first bid should lead without a previous leader, got %+v", bidPlaced)
+	}
+
+	if response := f.placeBid(f.carol, assetId, "200"); response.Status != 200 {
+		t.Fatalf("bid failed : %v", response.Message)
+	}
+	bidPlaced = f.bidPlacedEvent()
+	if !bidPlaced.IsLeading || bidPlaced.PreviousLeader != f.bob.email || bidPlaced.PreviousBid.Cmp(money(t, "150")) != 0 {
+		t.Fatalf("carol should have outbid bob, got %+v", bidPlaced)
+	}
+
+	//raising a bid that already leads does not outbid anybody
+	if response := f.placeBid(f.carol, assetId, "250"); response.Status != 200 {
+		t.Fatalf("bid failed : %v", response.Message)
+	}
+	bidPlaced = f.bidPlacedEvent()
+	if !bidPlaced.IsLeading || len(bidPlaced.PreviousLeader) > 0 {
+		t.Fatalf("carol raised her own lead, got %+v", bidPlaced)
+	}
+
+	//bob matches carol but an equal bid keeps the earlier key in the lead
+	if response := f.placeBid(f.bob, assetId, "250"); response.Status != 200 {
+		t.Fatalf("bid failed : %v", response.Message)
+	}
+	if bidPlaced = f.bidPlacedEvent(); !bidPlaced.IsLeading {
+		t.Fatalf("bob sorts before carol and should lead on an equal bid, got %+v", bidPlaced)
+	}
+
+	f.advance(3 * time.Hour)
+	if result := f.getBidResult(); result.Settled != 1 {
+		t.Fatalf("expected one settlement, got %+v", result)
+	}
+	f.expectError("is already sold", f.carol, "placeBid", bid(assetId, "300"), "-")
+}
+
+func (f *auctionFixture) bidPlacedEvent() *BidPlacedEvent {
+	f.t.Helper()
+	envelope := f.lastEvent()
+	if envelope == nil || len(envelope.Events) != 1 || envelope.Events[0].Type != EVENT_BID_PLACED {
+		f.t.Fatalf("expected one %v event, got %+v", EVENT_BID_PLACED, envelope)
+	}
+	var bidPlaced BidPlacedEvent
+	if err := json.Unmarshal(envelope.Events[0].Payload, &bidPlaced); err != nil {
+		f.t.Fatal(err)
+	}
+	return &bidPlaced
+}
+
+func TestPlaceBidCountsOtherLeadingBids(t *testing.T) {
+	f := newAuctionFixture(t)
+	f.mustInvoke(f.house, "setFeeSchedule", `{"buyerPremiumPct":"10","sellerCommissionPct":"5","houseAccountEmail":"house@example.com"}`)
+	vase := f.addAsset(f.alice, "Vase", "100", time.Hour)
+	lamp := f.addAsset(f.alice, "Lamp", "100", time.Hour)
+	kite := f.addAsset(f.alice, "Kite", "100", time.Hour)
+	f.advance(90 * time.Minute)
+	placeBid := func(bidder *testIdentity, assetId string, amount string) {
+		t.Helper()
+		if response := f.placeBid(bidder, assetId, amount); response.Status != 200 {
+			t.Fatalf("bid of %v on %v failed : %v", amount, assetId, response.Message)
+		}
+	}
+
+	//leading on the vase holds 660.00 of the 1000 of bob
+	placeBid(f.bob, vase, "600")
+	f.expectErrorCode(ERROR_INSUFFICIENT_FUNDS, "bidAmount", f.bob, "placeBid", fmt.Sprintf(`{"asset":{"assetId":%q},"bidAmount":"400"}`, lamp), "-")
+	placeBid(f.bob, lamp, "300")
+	//a higher bid replaces the bid on the same asset, it is not added to it
+	f.expectErrorCode(ERROR_INSUFFICIENT_FUNDS, "bidAmount", f.bob, "placeBid", fmt.Sprintf(`{"asset":{"assetId":%q},"bidAmount":"610"}`, vase), "-")
+	placeBid(f.bob, vase, "605")
+
+	//once outbid, the funds are free for other auctions
+	f.expectErrorCode(ERROR_INSUFFICIENT_FUNDS, "bidAmount", f.bob, "placeBid", fmt.Sprintf(`{"asset":{"assetId":%q},"bidAmount":"500"}`, kite), "-")
+	placeBid(f.carol, vase, "700")
+	placeBid(f.bob, kite, "500")
+
+	f.advance(time.Hour)
+	if result := f.getBidResult(); result.Settled != 3 || result.Failed != 0 {
+		t.Fatalf("expected three settlements, got %+v", result)
+	}
+	f.expectBalance(f.bob, "120")
+	f.expectConsistent()
+}
+
+func TestPlaceBidHoldsFundsOfTheLeadingBid(t *testing.T) {
+	f := newAuctionFixture(t)
+	f.mustInvoke(f.house, "setFeeSchedule", `{"buyerPremiumPct":"10","sellerCommissionPct":"5","houseAccountEmail":"house@example.com"}`)
+	vase := f.addAsset(f.alice, "Vase", "100", time.Hour)
+	lamp := f.addAsset(f.alice, "Lamp", "100", time.Hour)
+	f.advance(90 * time.Minute)
+	expectHeld := func(identity *testIdentity, want string) {
+		t.Helper()
+		if held := f.getUser(identity, identity.email).held(DEFAULT_CURRENCY); held.Cmp(money(t, want)) != 0 {
+			t.Fatalf("%v has %v held, want %v", identity.email, held.String(), want)
+		}
+	}
+	placeBid := func(bidder *testIdentity, assetId string, amount string) {
+		t.Helper()
+		if response := f.placeBid(bidder, assetId, amount); response.Status != 200 {
+			t.Fatalf("bid of %v on %v failed : %v", amount, assetId, response.Message)
+		}
+	}
+
+	placeBid(f.bob, vase, "200")
+	expectHeld(f.bob, "220")
+	//a bid that does not lead holds nothing
+	placeBid(f.carol, vase, "150")
+	expectHeld(f.carol, "0")
+	//raising the lead holds the new total in place of the old one
+	placeBid(f.bob, vase, "300")
+	expectHeld(f.bob, "330")
+	//the outbid leader gets their funds back
+	placeBid(f.carol, vase, "400")
+	expectHeld(f.bob, "0")
+	expectHeld(f.carol, "440")
+	//lowering a bid below the next one hands the lead and the hold back
+	placeBid(f.carol, vase, "250")
+	expectHeld(f.carol, "0")
+	expectHeld(f.bob, "330")
+	entries, _ := f.getStatement(f.bob)
+	var types []string
+	for _, entry := range entries {
+		types = append(types, entry.Type)
+	}
+	if strings.Join(types, " ") != "credit hold release hold release hold" {
+		t.Fatalf("statement of bob is %v", types)
+	}
+
+	//the lamp needs 330 of carol and 110 of bob, bob has 330 of his 1000 held
+	f.mustInvoke(f.house, "withdraw", `{"email":"bob@example.com","amount":"600"}`)
+	f.expectErrorCode(ERROR_INSUFFICIENT_FUNDS, "bidAmount", f.bob, "placeBid", f.bidIn(f.bob, lamp, "100", ""), "-")
+	placeBid(f.carol, lamp, "300")
+	f.expectConsistent()
+
+	//settling releases the hold of the winner before they pay
+	f.advance(time.Hour)
+	if result := f.getBidResult(); result.Settled != 2 {
+		t.Fatalf("expected two settlements, got %+v", result)
+	}
+	expectHeld(f.bob, "0")
+	expectHeld(f.carol, "0")
+	f.expectBalance(f.bob, "70")
+	f.expectBalance(f.carol, "670")
+	f.expectConsistent()
+}
+
+func TestGetBidResult(t *testing.T) {
+	f := newAuctionFixture(t)
+	f.mustInvoke(f.house, "setFeeSchedule", `{"buyerPremiumPct":"10","sellerCommissionPct":"5","houseAccountEmail":"house@example.com"}`)
+
+	sold := f.addAsset(f.alice, "Vase", "100", time.Hour)
+	unsold := f.addAsset(f.alice, "Lamp", "100", time.Hour)
+	later := f.addAsset(f.bob, "Clock", "100", 5*time.Hour)
+	for _, bid := range []struct {
+		bidder  *testIdentity
+		assetId string
+		amount  string
+	}{{f.bob, sold, "200"}, {f.carol, sold, "300"}, {f.carol, later, "100"}} {
+		if response := f.placeBid(bid.bidder, bid.assetId, bid.amount); response.Status != 200 {
+			t.Fatalf("bid failed : %v", response.Message)
+		}
+	}
+
+	f.expectError("Only Auction house users", f.alice, "getBidResult", f.now.Format(time.RFC3339))
+	f.expectError("cannot parse", f.house, "getBidResult", "yesterday")
+	f.expectError("Page size must be a number between 1 and 1000", f.house, "getBidResult", f.now.Format(time.RFC3339), "0")
+	f.expectError("Page size must be a number between 1 and 1000", f.house, "getBidResult", f.now.Format(time.RFC3339), "1001")
+	f.expectError("Invalid bookmark", f.house, "getBidResult", f.now.Format(time.RFC3339), "", "%%%")
+
+	//nothing has ended yet
+	if result := f.getBidResult(); result.Processed != 0 {
+		t.Fatalf("expected nothing to close, got %+v", result)
+	}
+
+	f.advance(3 * time.Hour)
+	if result := f.getBidResult(); result.Processed != 2 || result.Settled != 1 || result.Failed != 0 || len(result.Bookmark) > 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	envelope := f.lastEvent()
+
+	//300 hammer price, 30 premium to carol, 15 commission from alice
+	f.expectBalance(f.carol, "670")
+	f.expectBalance(f.alice, "1285")
+	f.expectBalance(f.bob, "1000")
+	f.expectBalance(f.house, "1045")
+	if asset := f.getAsset(sold); !asset.IsSold || asset.Owner.Email != f.carol.email || asset.SoldPrice.Cmp(money(t, "300")) != 0 {
+		t.Fatalf("asset was not transferred to carol : %+v", asset)
+	}
+	if asset := f.getAsset(unsold); asset.IsSold || asset.Owner.Email != f.alice.email {
+		t.Fatalf("an asset without bids must stay with its owner : %+v", asset)
+	}
+
+	var types []string
+	for _, event := range envelope.Events {
+		types = append(types, event.Type)
+	}
+	want := []string{EVENT_BALANCE_CHANGED, EVENT_BALANCE_CHANGED, EVENT_BALANCE_CHANGED, EVENT_ASSET_TRANSFERRED, EVENT_AUCTION_CLOSED}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Fatalf("events are %v, want %v", types, want)
+	}
+
+	var settlements []Settlement
+	decodeItems(t, f.mustInvoke(f.alice, "getSettlementsForAsset", sold), &settlements)
+	if len(settlements) != 1 || settlements[0].WinnerEmail != f.carol.email || settlements[0].BidderCount != 2 {
+		t.Fatalf("unexpected settlements %+v", settlements)
+	}
+	f.expectConsistent()
+
+	//the same sweep again settles nothing twice
+	if result := f.getBidResult(); result.Settled != 0 {
+		t.Fatalf("sold assets were settled again : %+v", result)
+	}
+}
+
+func TestGetBidResultSettlesLotsOfTheSameUsers(t *testing.T) {
+	f := newAuctionFixture(t)
+	f.mustInvoke(f.house, "setFeeSchedule", `{"buyerPremiumPct":"10","sellerCommissionPct":"5","houseAccountEmail":"house@example.com"}`)
+	vase := f.addAsset(f.alice, "Vase", "100", time.Hour)
+	lamp := f.addAsset(f.alice, "Lamp", "100", time.Hour)
+	f.advance(90 * time.Minute)
+	for _, assetId := range []string{vase, lamp} {
+		if response := f.placeBid(f.bob, assetId, "100"); response.Status != 200 {
+			t.Fatalf("bid failed : %v", response.Message)
+		}
+	}
+
+	//both lots are settled in one transaction, which does not read the balances the first one wrote
+	f.advance(time.Hour)
+	if result := f.getBidResult(); result.Settled != 2 || result.Failed != 0 {
+		t.Fatalf("expected two settlements, got %+v", result)
+	}
+	f.expectBalance(f.bob, "780")
+	f.expectBalance(f.alice, "1190")
+	f.expectBalance(f.house, "1030")
+	f.expectConsistent()
+}
+
+func TestGetBidResultRecordsFailedClosure(t *testing.T) {
+	f := newAuctionFixture(t)
+	assetId := f.addAsset(f.alice, "Vase", "600", time.Hour)
+	if response := f.placeBid(f.bob, assetId, "600"); response.Status != 200 {
+		t.Fatalf("bid failed : %v", response.Message)
+	}
+	//bob can no longer pay the 600
+	f.mustInvoke(f.house, "withdraw", `{"email":"bob@example.com","amount":"700"}`)
+
+	f.advance(3 * time.Hour)
+	if result := f.getBidResult(); result.Settled != 0 || result.Failed != 1 {
+		t.Fatalf("expected one failure, got %+v", result)
+	}
+	if asset := f.getAsset(assetId); asset.IsSold || asset.Owner.Email != f.alice.email || !asset.ClosureFailed {
+		t.Fatalf("a failed closure must only mark the asset : %+v", asset)
+	}
+	failureKey, _ := getCompositeKey(f.stub, COMPOSITE_KEY_FAILED_CLOSURE, assetId, f.alice.email)
+	var failure FailedClosure
+	if err := json.Unmarshal(f.stub.State[failureKey], &failure); err != nil {
+		t.Fatalf("failed closure of %v is not recorded : %v", assetId, err)
+	}
+	if !strings.Contains(failure.Reason, "no bidder can pay, bidder bob@example.com has balance 300.00 USD but owes 600.00") {
+		t.Fatalf("unexpected reason %q", failure.Reason)
+	}
+	f.expectBalance(f.bob, "300")
+	//the funds held for the lot are given back, nothing is left to settle it
+	if held := f.getUser(f.bob, f.bob.email).held(DEFAULT_CURRENCY); held.Sign() != 0 {
+		t.Fatalf("bob still has %v held", held.String())
+	}
+	f.expectConsistent()
+
+	//the marked asset is left out of later sweeps
+	if result := f.getBidResult(); result.Processed != 0 {
+		t.Fatalf("a failed lot is selected again : %+v", result)
+	}
+
+	//once bob can pay the auction house closes it by hand
+	f.mustInvoke(f.house, "deposit", `{"email":"bob@example.com","amount":"400"}`)
+	f.mustInvoke(f.house, "closeAuction", f.now.Format(time.RFC3339), assetId)
+	if asset := f.getAsset(assetId); !asset.IsSold || asset.Owner.Email != f.bob.email || asset.ClosureFailed {
+		t.Fatalf("asset was not transferred to bob : %+v", asset)
+	}
+	if f.stub.State[failureKey] != nil {
+		t.Fatal("the failed closure is still recorded")
+	}
+	f.expectBalance(f.bob, "100")
+	f.expectConsistent()
+}
+
+func TestGetBidResultPassesOverBiddersWhoCannotPay(t *testing.T) {
+	f := newAuctionFixture(t)
+	assetId := f.addAsset(f.alice, "Vase", "400", time.Hour)
+	for _, bid := range []struct {
+		bidder *testIdentity
+		amount string
+	}{{f.bob, "600"}, {f.carol, "500"}} {
+		if response := f.placeBid(bid.bidder, assetId, bid.amount); response.Status != 200 {
+			t.Fatalf("bid failed : %v", response.Message)
+		}
+	}
+	f.mustInvoke(f.house, "withdraw", `{"email":"bob@example.com","amount":"700"}`)
+
+	f.advance(3 * time.Hour)
+	if result := f.getBidResult(); result.Settled != 1 || result.Failed != 0 {
+		t.Fatalf("expected one settlement, got %+v", result)
+	}
+	var settlements []Settlement
+	decodeItems(t, f.mustInvoke(f.alice, "getSettlementsForAsset", assetId), &settlements)
+	if len(settlements) != 1 || settlements[0].WinnerEmail != f.carol.email || settlements[0].WinningBid.String() != "500.00" ||
+		settlements[0].BidderCount != 2 {
+		t.Fatalf("the lot did not go to the next bidder : %+v", settlements)
+	}
+	f.expectBalance(f.bob, "300")
+	f.expectBalance(f.carol, "500")
+	f.expectConsistent()
+}
+
+func TestGetBidResultAbortsWhenABidderCannotBeRead(t *testing.T) {
+	f := newAuctionFixture(t)
+	assetId := f.addAsset(f.alice, "Vase", "400", time.Hour)
+	for _, bid := range []struct {
+		bidder *testIdentity
+		amount string
+	}{{f.bob, "600"}, {f.carol, "500"}} {
+		if response := f.placeBid(bid.bidder, assetId, bid.amount); response.Status != 200 {
+			t.Fatalf("bid failed : %v", response.Message)
+		}
+	}
+	bobKey, _ := getCompositeKey(f.stub, USER_KEY, f.bob.email)
+	putStored(t, f.testLedger, bobKey, `{"userId":`)
+
+	//a user that cannot be read is not a bidder who cannot pay, the lot must not go to carol
+	f.advance(3 * time.Hour)
+	f.expectError("loading bidder bob@example.com failed", f.house, "getBidResult", f.now.Format(time.RFC3339))
+	if asset := f.getAsset(assetId); asset.IsSold || asset.ClosureFailed {
+		t.Fatalf("the sweep changed the asset : %+v", asset)
+	}
+	f.expectBalance(f.carol, "1000")
+}
+
+func TestGetBidResultPages(t *testing.T) {
+	f := newAuctionFixture(t)
+	var assetIds []string
+	for i := 0; i < 5; i++ {
+		assetId := f.addAsset(f.alice, fmt.Sprintf("Lot %v", i), "10", time.Duration(i+1)*time.Minute)
+		if response := f.placeBid(f.bob, assetId, "10"); response.Status != 200 {
+			t.Fatalf("bid failed : %v", response.Message)
+		}
+		assetIds = append(assetIds, assetId)
+	}
+
+	f.advance(2 * time.Hour)
+	var bookmark string
+	var pages, settled int
+	for {
+		result := f.getBidResult("2", bookmark)
+		pages++
+		settled += result.Settled
+		if len(result.Bookmark) == 0 {
+			break
+		}
+		bookmark = result.Bookmark
+	}
+	if pages != 3 || settled != 5 {
+		t.Fatalf("expected 5 settlements over 3 pages, got %v over %v", settled, pages)
+	}
+	for _, assetId := range assetIds {
+		if asset := f.getAsset(assetId); asset.Owner.Email != f.bob.email {
+			t.Fatalf("asset %v was not settled", assetId)
+		}
+	}
+}
+
+func TestCloseAuction(t *testing.T) {
+	f := newAuctionFixture(t)
+	assetId := f.addAsset(f.alice, "Vase", "100", time.Hour)
+	noBids := f.addAsset(f.alice, "Lamp", "100", time.Hour)
+	if response := f.placeBid(f.bob, assetId, "100"); response.Status != 200 {
+		t.Fatalf("bid failed : %v", response.Message)
+	}
+	now := func() string { return f.now.Format(time.RFC3339) }
+
+	f.expectError("Only Auction house users", f.alice, "closeAuction", now(), assetId)
+	f.expectError("cannot parse", f.house, "closeAuction", "soon", assetId)
+	f.expectError("Asset ID is mandatory", f.house, "closeAuction", now(), "")
+	f.expectError("Asset : missing is not found", f.house, "closeAuction", now(), "missing")
+	f.expectError("bidding has not ended yet", f.house, "closeAuction", now(), assetId)
+
+	f.advance(3 * time.Hour)
+	f.expectError("did not receive any bid", f.house, "closeAuction", now(), noBids)
+	f.mustInvoke(f.house, "closeAuction", now(), assetId)
+	if asset := f.getAsset(assetId); asset.Owner.Email != f.bob.email {
+		t.Fatalf("asset was not transferred to bob : %+v", asset)
+	}
+	f.expectError("is already sold", f.house, "closeAuction", now(), assetId)
+	f.expectConsistent()
+}
+
+func TestExtendAuction(t *testing.T) {
+	f := newAuctionFixture(t)
+	assetId := f.addAsset(f.alice, "Vase", "100", time.Hour)
+	bidEnd := *f.getAsset(assetId).BidEnd
+
+	f.expectError("Only Auction house users", f.alice, "extendAuction", assetId, bidEnd.Add(time.Hour).Format(time.RFC3339))
+	f.expectError("Asset ID is mandatory", f.house, "extendAuction", "", bidEnd.Add(time.Hour).Format(time.RFC3339))
+	f.expectError("cannot parse", f.house, "extendAuction", assetId, "later")
+	f.expectError("Asset : missing is not found", f.house, "extendAuction", "missing", bidEnd.Add(time.Hour).Format(time.RFC3339))
+	f.expectError("bidding already ends at", f.house, "extendAuction", assetId, bidEnd.Format(time.RFC3339))
+
+	f.mustInvoke(f.house, "extendAuction", assetId, bidEnd.Add(time.Hour).Format(time.RFC3339))
+	if extended := f.getAsset(assetId).BidEnd; !extended.Equal(bidEnd.Add(time.Hour)) {
+		t.Fatalf("bid end is %v, want %v", extended, bidEnd.Add(time.Hour))
+	}
+	if envelope := f.lastEvent(); envelope == nil || envelope.Events[0].Type != EVENT_AUCTION_EXTENDED {
+		t.Fatalf("expected an %v event, got %+v", EVENT_AUCTION_EXTENDED, envelope)
+	}
+}
+
+func TestGetAssetsForUser(t *testing.T) {
+	f := newAuctionFixture(t)
+	vase := f.addAsset(f.alice, "Vase", "100", time.Hour)
+	f.addAsset(f.bob, "Lamp", "100", time.Hour)
+	assetIds := func(identity *testIdentity, args ...string) []string {
+		var assets []Asset
+		decodeItems(t, f.mustInvoke(identity, "getAssetsForUser", args...), &assets)
+		var ids []string
+		for _, asset := range assets {
+			ids = append(ids, asset.AssetId)
+		}
+		return ids
+	}
+
+	if ids := assetIds(f.alice, "all"); len(ids) != 2 {
+		t.Fatalf("all assets are %v, want 2", ids)
+	}
+	if ids := assetIds(f.alice); len(ids) != 1 || ids[0] != vase {
+		t.Fatalf("alice owns %v, want [%v]", ids, vase)
+	}
+	if ids := assetIds(f.carol, "mine"); len(ids) != 0 {
+		t.Fatalf("carol owns %v, want none", ids)
+	}
+	f.expectError("user not registered", newTestIdentity(t, "dave@example.com", "Org1"), "getAssetsForUser", "all")
+
+	if response := f.placeBid(f.carol, vase, "100"); response.Status != 200 {
+		t.Fatalf("bid failed : %v", response.Message)
+	}
+	f.advance(3 * time.Hour)
+	f.getBidResult()
+	if ids := assetIds(f.carol); len(ids) != 1 || ids[0] != vase {
+		t.Fatalf("carol owns %v after winning, want [%v]", ids, vase)
+	}
+	if ids := assetIds(f.alice); len(ids) != 0 {
+		t.Fatalf("alice still owns %v after selling", ids)
+	}
+}
+
+func TestInvokeRejectsUnknownFunctionAndArgumentCount(t *testing.T) {
+	l := newTestLedger(t)
+	alice := newTestIdentity(t, "alice@example.com", "Org1")
+	l.expectError("unknown invoke function", alice, "deleteEverything")
+	l.expectError("incorrect number of arguments", alice, "addUser")
+	l.expectError("incorrect number of arguments", alice, "placeBid", "{}")
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
-	"fmt"
 )
 
 func (t *AuctionChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
@@ -20,18 +19,43 @@ func (t *AuctionChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response
 		nrArgsMin int
 		nrArgsMax int
 	}{
-		"addUser":          {t.addUser, 1, 1},
-		"addAssetForBid":   {t.addAssetForBid, 1, 1},
-		"placeBid":         {t.placeBid, 2, 2},
-		"getBidResult":     {t.getBidResult, 1, 1},
-		"getUser":          {t.getUser, 0, 1},
-		"getAssetsForUser": {t.getAssetsForUser, 0, 1},
+		"addUser":                 {t.addUser, 1, 1},
+		"approveUser":             {t.approveUser, 1, 1},
+		"addAssetForBid":          {t.addAssetForBid, 1, 1},
+		"placeBid":                {t.placeBid, 2, 2},
+		"getBidResult":            {t.getBidResult, 1, 3},
+		"closeAuction":            {t.closeAuction, 2, 2},
+		"getUser":                 {t.getUser, 0, 1},
+		"getAssetsForUser":        {t.getAssetsForUser, 0, 1},
+		"searchAssets":            {t.searchAssets, 1, 1},
+		"addCategory":             {t.addCategory, 1, 1},
+		"getCategories":           {t.getCategories, 0, 0},
+		"getAssetsByCategory":     {t.getAssetsByCategory, 1, 3},
+		"setFeeSchedule":          {t.setFeeSchedule, 1, 1},
+		"getFeeSchedule":          {t.getFeeSchedule, 0, 0},
+		"setFxRates":              {t.setFxRates, 1, 1},
+		"getFxRates":              {t.getFxRates, 0, 0},
+		"getSettlementsForAsset":  {t.getSettlementsForAsset, 1, 1},
+		"getSettlementsForBuyer":  {t.getSettlementsForBuyer, 0, 1},
+		"getSettlementsForSeller": {t.getSettlementsForSeller, 0, 1},
+		"checkConsistency":        {t.checkConsistency, 0, 0},
+		"getAssetProvenance":      {t.getAssetProvenance, 1, 1},
+		"getBidsForUser":          {t.getBidsForUser, 0, 1},
+		"watchAsset":              {t.watchAsset, 1, 1},
+		"unwatchAsset":            {t.unwatchAsset, 1, 1},
+		"getWatchedAssets":        {t.getWatchedAssets, 0, 0},
+		"notifyClosingSoon":       {t.notifyClosingSoon, 1, 2},
+		"extendAuction":           {t.extendAuction, 2, 2},
+		"deposit":                 {t.deposit, 1, 1},
+		"withdraw":                {t.withdraw, 1, 1},
+		"getStatement":            {t.getStatement, 0, 3},
+		"migrateLedger":           {t.migrateLedger, 0, 1},
 	}
 
 	if fn, ok := invokeFunctions[function]; !ok {
-		return shim.Error("unknown invoke function")
+		return errorResponse(newError(ERROR_UNKNOWN_FUNCTION, "", "unknown invoke function"))
 	} else if fn.nrArgsMin > len(args) || fn.nrArgsMax < len(args) {
-		return shim.Error(fmt.Sprintf("incorrect number of arguments; expected between %v & %v, found %v ", fn.nrArgsMin, fn.nrArgsMax, len(args)))
+		return errorResponse(newError(ERROR_ARGUMENT_COUNT, "", "incorrect number of arguments; expected between %v & %v, found %v ", fn.nrArgsMin, fn.nrArgsMax, len(args)))
 	} else {
 		return fn.function(stub, args)
 	}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+/**
+Rewrite the assets stored by earlier versions of the chaincode in the current layout. Assets stored under the owner~asset
+key move to their own asset~id key, which keeps an owner~asset index entry, and every asset gets bidStart and bidEnd in
+LEDGER_TIME_FORMAT, the priceIndex, the currency and every flag the queries select on. args[0] is an optional page
+size, at most that many assets are rewritten per transaction. Assets already in the current layout are left alone, so
+the auction house calls it after upgrading the chaincode and again until the result is done.
+ */
+func (t *AuctionChaincode) migrateLedger(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if !isAdmin(stub) {
+		return unauthorized("Only Auction house and admin users are allowed to invoke this function")
+	}
+	size := ""
+	if len(args) > 0 {
+		size = args[0]
+	}
+	pageSize, err := parseCountArg("pageSize", size, DEFAULT_BATCH_SIZE, MAX_BATCH_SIZE,
+		fmt.Sprintf("Page size must be a number between 1 and %v", MAX_BATCH_SIZE))
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	result := MigrationResult{Done: true}
+	if err = t.moveOwnerKeyedAssets(stub, pageSize, &result); err != nil {
+		return errorResponse(err)
+	}
+	if result.Done {
+		if err = t.rewriteAssets(stub, pageSize, &result); err != nil {
+			return errorResponse(err)
+		}
+	}
+	return invokeSuccess(stub, result, nil)
+}
+
+/**
+Before assets had an id key the whole asset was stored under owner~asset, where only the index entry is kept now.
+ */
+func (t *AuctionChaincode) moveOwnerKeyedAssets(stub shim.ChaincodeStubInterface, pageSize int, result *MigrationResult) error {
+	indexIterator, err := stub.GetStateByPartialCompositeKey(COMPOSITE_KEY_OWNER_ASSET, []string{})
+	if err != nil {
+		return err
+	}
+	defer indexIterator.Close()
+	for indexIterator.HasNext() {
+		responseRange, err := indexIterator.Next()
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(responseRange.Value, []byte{0x00}) {
+			continue
+		}
+		if result.Migrated == pageSize {
+			result.Done = false
+			return nil
+		}
+		//owner~asset is {owner}{asset}
+		_, keyParts, err := stub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return err
+		}
+		var assetObj Asset
+		if err = json.Unmarshal(responseRange.Value, &assetObj); err != nil {
+			return fmt.Errorf("asset %v cannot be read : %v", responseRange.Key, err.Error())
+		}
+		//the owner was stored with their balance of the time, the asset only keeps the email now
+		assetObj.AssetId = keyParts[1]
+		assetObj.Owner = &User{Email: keyParts[0]}
+		setMigratedFields(&assetObj)
+		t.Infof("[ migrateLedger ] - moving asset %v of %v", assetObj.AssetId, keyParts[0])
+		if err = putAsset(stub, &assetObj); err != nil {
+			return err
+		}
+		if err = putOwnerIndex(stub, keyParts[0], assetObj.AssetId); err != nil {
+			return err
+		}
+		result.Migrated++
+	}
+	return nil
+}
+
+func (t *AuctionChaincode) rewriteAssets(stub shim.ChaincodeStubInterface, pageSize int, result *MigrationResult) error {
+	assetsIterator, err := stub.GetStateByPartialCompositeKey(COMPOSITE_KEY_ASSET, []string{})
+	if err != nil {
+		return err
+	}
+	defer assetsIterator.Close()
+	for assetsIterator.HasNext() {
+		responseRange, err := assetsIterator.Next()
+		if err != nil {
+			return err
+		}
+		var assetObj Asset
+		if err = json.Unmarshal(responseRange.Value, &assetObj); err != nil {
+			return fmt.Errorf("asset %v cannot be read : %v", responseRange.Key, err.Error())
+		}
+		setMigratedFields(&assetObj)
+		assetBytes, err := json.Marshal(assetObj)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(assetBytes, responseRange.Value) {
+			continue
+		}
+		if result.Migrated == pageSize {
+			result.Done = false
+			return nil
+		}
+		t.Infof("[ migrateLedger ] - rewriting asset %v", assetObj.AssetId)
+		if err = stub.PutState(responseRange.Key, assetBytes); err != nil {
+			return err
+		}
+		result.Migrated++
+	}
+	return nil
+}
+
+/**
+Fill in the fields earlier versions did not store. Without a priceIndex and a currency the price filters and the price
+sort of searchAssets leave the asset out.
+ */
+func setMigratedFields(assetObj *Asset) {
+	assetObj.DocType = reflect.TypeOf(*assetObj).Name()
+	assetObj.Currency = currencyOf(assetObj.Currency)
+	if assetObj.Price != nil {
+		assetObj.PriceIndex = assetObj.Price.Float64()
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+/**
+Edit the document stored under key in place, to lay out the ledger the way an earlier version of the chaincode left it.
+ */
+func rewriteStored(t *testing.T, l *testLedger, key string, edit func(document map[string]interface{})) {
+	t.Helper()
+	var document map[string]interface{}
+	if err := json.Unmarshal(l.stub.State[key], &document); err != nil {
+		t.Fatalf("%v : %v", key, err)
+	}
+	edit(document)
+	documentBytes, err := json.Marshal(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.stub.State[key] = documentBytes
+}
+
+/**
+Store a document the way an earlier version of the chaincode wrote it, outside of any invoke.
+ */
+func putStored(t *testing.T, l *testLedger, key string, document string) {
+	t.Helper()
+	l.stub.MockTransactionStart("earlier")
+	defer l.stub.MockTransactionEnd("earlier")
+	if err := l.stub.PutState(key, []byte(document)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClosedBidsCompareAtSubSecondPrecision(t *testing.T) {
+	f := newAuctionFixture(t)
+	assetId := f.addAsset(f.alice, "Vase", "100", time.Hour)
+	f.advance(90 * time.Minute)
+	if response := f.placeBid(f.bob, assetId, "100"); response.Status != 200 {
+		t.Fatalf("bid failed : %v", response.Message)
+	}
+
+	//half a second after the auction ended at 11:00:00
+	sweepTime := time.Date(2018, 10, 1, 11, 0, 0, 500000000, time.UTC)
+	var result BatchResult
+	decodeEntity(t, f.mustInvoke(f.house, "getBidResult", sweepTime.Format(time.RFC3339Nano)), &result)
+	if result.Processed != 1 || result.Settled != 1 {
+		t.Fatalf("an auction that ended half a second ago is not closed : %+v", result)
+	}
+	assetKey, _ := getCompositeKey(f.stub, COMPOSITE_KEY_ASSET, assetId)
+	var stored map[string]interface{}
+	json.Unmarshal(f.stub.State[assetKey], &stored)
+	if stored["bidEnd"] != "2018-10-01T11:00:00.000000000Z" {
+		t.Fatalf("bidEnd is stored as %v", stored["bidEnd"])
+	}
+}
+
+func TestMigrateLedger(t *testing.T) {
+	f := newAuctionFixture(t)
+	sold := f.addAsset(f.alice, "Vase", "100", time.Hour)
+	unsold := f.addAsset(f.alice, "Lamp", "100", time.Hour)
+	f.advance(90 * time.Minute)
+	if response := f.placeBid(f.bob, sold, "100"); response.Status != 200 {
+		t.Fatalf("bid failed : %v", response.Message)
+	}
+	//earlier versions kept the offset of the seller and left out the flags that were false
+	for _, assetId := range []string{sold, unsold} {
+		assetKey, _ := getCompositeKey(f.stub, COMPOSITE_KEY_ASSET, assetId)
+		rewriteStored(t, f.testLedger, assetKey, func(document map[string]interface{}) {
+			document["bidStart"] = "2018-10-01T15:30:00+05:30"
+			document["bidEnd"] = "2018-10-01T16:30:00+05:30"
+			delete(document, "isSold")
+			delete(document, "closingSoonNotified")
+			delete(document, "closureFailed")
+			delete(document, "priceIndex")
+			delete(document, "currency")
+		})
+	}
+
+	f.advance(3 * time.Hour)
+	if result := f.getBidResult(); result.Processed != 0 {
+		t.Fatalf("the sweep found assets in the earlier layout : %+v", result)
+	}
+
+	f.expectErrorCode(ERROR_UNAUTHORIZED, "", f.alice, "migrateLedger")
+	for i, want := range []MigrationResult{{1, false}, {1, true}, {0, true}} {
+		var result MigrationResult
+		decodeEntity(t, f.mustInvoke(f.house, "migrateLedger", "1"), &result)
+		if result != want {
+			t.Fatalf("migration %v is %+v, want %+v", i+1, result, want)
+		}
+	}
+	if asset := f.getAsset(unsold); asset.BidEnd.Location() != time.UTC || asset.BidEnd.Hour() != 11 || asset.IsSold ||
+		asset.PriceIndex != 100 || asset.Currency != DEFAULT_CURRENCY {
+		t.Fatalf("asset was not migrated : %+v", asset)
+	}
+
+	if result := f.getBidResult(); result.Processed != 2 || result.Settled != 1 {
+		t.Fatalf("the sweep after the migration is %+v", result)
+	}
+	if asset := f.getAsset(sold); !asset.IsSold || asset.Owner.Email != f.bob.email {
+		t.Fatalf("asset was not transferred to bob : %+v", asset)
+	}
+	f.expectConsistent()
+}
+
+func TestMigrateOwnerKeyedAssets(t *testing.T) {
+	f := newAuctionFixture(t)
+	//before assets had an id key the asset, with a copy of its owner, was stored under owner~asset
+	unsoldKey, _ := getCompositeKey(f.stub, COMPOSITE_KEY_OWNER_ASSET, f.alice.email, "legacy1")
+	putStored(t, f.testLedger, unsoldKey, `{
+    "assetId": "legacy1",
+    "owner": {
+        "userId": "alice",
+        "email": "alice@example.com",
+        "balance": "1000",
+        "docType": "User"
+    },
+    "name": "Old vase",
+    "price": "100",
+    "bidStart": "2018-10-01T15:30:00+05:30",
+    "bidEnd": "2018-10-01T16:30:00+05:30",
+    "docType": "Asset"
+}`)
+	laterKey, _ := getCompositeKey(f.stub, COMPOSITE_KEY_OWNER_ASSET, f.bob.email, "legacy2")
+	putStored(t, f.testLedger, laterKey, `{"assetId":"legacy2","owner":{"email":"bob@example.com"},"name":"Old lamp","price":"50",`+
+		`"bidStart":"2018-10-02T10:00:00Z","bidEnd":"2018-10-02T11:00:00Z","docType":"Asset"}`)
+
+	var result MigrationResult
+	decodeEntity(t, f.mustInvoke(f.admin, "migrateLedger"), &result)
+	if result != (MigrationResult{2, true}) {
+		t.Fatalf("migration is %+v", result)
+	}
+	decodeEntity(t, f.mustInvoke(f.admin, "migrateLedger"), &result)
+	if result != (MigrationResult{0, true}) {
+		t.Fatalf("second migration is %+v", result)
+	}
+	for _, key := range []string{unsoldKey, laterKey} {
+		if value := f.stub.State[key]; len(value) != 1 || value[0] != 0x00 {
+			t.Fatalf("owner index %q holds %q", key, value)
+		}
+	}
+
+	var assets []Asset
+	decodeItems(t, f.mustInvoke(f.alice, "getAssetsForUser"), &assets)
+	if len(assets) != 1 || assets[0].AssetId != "legacy1" || assets[0].Owner.Email != f.alice.email || assets[0].IsSold ||
+		!assets[0].BidEnd.Equal(time.Date(2018, 10, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Fatalf("alice owns %+v", assets)
+	}
+	decodeItems(t, f.mustInvoke(f.alice, "getAssetsForUser", "all"), &assets)
+	if len(assets) != 2 || assets[1].AssetId != "legacy2" || assets[1].Owner.Email != f.bob.email {
+		t.Fatalf("all assets are %+v", assets)
+	}
+
+	//the migrated asset is auctioned like any other
+	f.advance(90 * time.Minute)
+	if response := f.placeBid(f.carol, "legacy1", "120"); response.Status != 200 {
+		t.Fatalf("bid failed : %v", response.Message)
+	}
+	f.advance(2 * time.Hour)
+	if result := f.getBidResult(); result.Processed != 1 || result.Settled != 1 {
+		t.Fatalf("the sweep after the migration is %+v", result)
+	}
+	if asset := f.getAsset("legacy1"); !asset.IsSold || asset.Owner.Email != f.carol.email {
+		t.Fatalf("asset was not transferred to carol : %+v", asset)
+	}
+	f.expectBalance(f.alice, "1120")
+	f.expectConsistent()
+}
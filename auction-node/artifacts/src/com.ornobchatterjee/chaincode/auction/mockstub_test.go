@@ -0,0 +1,690 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"container/list"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The extension fabric-ca puts the attributes of an enrollment in, see
+// github.com/hyperledger/fabric/common/attrmgr
+var attributesOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+// testIdentity is an enrolled user whose certificate carries the email and org
+// attributes the chaincode authorizes with.
+type testIdentity struct {
+	email      string
+	org        string
+	serialized []byte
+}
+
+func newTestIdentity(t testing.TB, email string, org string) *testIdentity {
+	return newTestIdentityWithRole(t, email, org, "")
+}
+
+// newTestIdentityWithRole also sets the role attribute when role is not empty.
+func newTestIdentityWithRole(t testing.TB, email string, org string, role string) *testIdentity {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs := map[string]string{"email": email, "org": org}
+	if len(role) > 0 {
+		attrs["role"] = role
+	}
+	attributes, err := json.Marshal(map[string]interface{}{"attrs": attrs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		Subject:         pkix.Name{CommonName: email},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{{Id: attributesOID, Value: attributes}},
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mspId := org + "MSP"
+	serialized, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   mspId,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testIdentity{email, org, serialized}
+}
+
+// testStub fills in the parts of shim.MockStub the chaincode relies on: the
+// creator certificate, rich queries, pagination, key history and events. Like
+// a peer, it keeps the writes of a transaction until the transaction ends, so
+// reads and queries only see the state committed before it.
+type testStub struct {
+	*shim.MockStub
+	creator []byte
+	args    []string
+	event   *pb.ChaincodeEvent
+	history map[string][]*queryresult.KeyModification
+	pending []pendingWrite
+}
+
+// pendingWrite is a write of the running transaction.
+type pendingWrite struct {
+	key      string
+	value    []byte
+	isDelete bool
+}
+
+func newTestStub(cc shim.Chaincode) *testStub {
+	return &testStub{MockStub: shim.NewMockStub(name, cc), history: make(map[string][]*queryresult.KeyModification)}
+}
+
+func (s *testStub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+func (s *testStub) GetFunctionAndParameters() (string, []string) {
+	if len(s.args) == 0 {
+		return "", nil
+	}
+	return s.args[0], s.args[1:]
+}
+
+func (s *testStub) GetStringArgs() []string {
+	return s.args
+}
+
+func (s *testStub) GetArgs() [][]byte {
+	args := make([][]byte, len(s.args))
+	for i, arg := range s.args {
+		args[i] = []byte(arg)
+	}
+	return args
+}
+
+// Like a peer, only the last event set by a transaction is kept.
+func (s *testStub) SetEvent(name string, payload []byte) error {
+	s.event = &pb.ChaincodeEvent{EventName: name, Payload: payload}
+	return nil
+}
+
+func (s *testStub) PutState(key string, value []byte) error {
+	if len(key) == 0 {
+		return fmt.Errorf("key must not be an empty string")
+	}
+	s.pending = append(s.pending, pendingWrite{key: key, value: value})
+	return nil
+}
+
+func (s *testStub) DelState(key string) error {
+	s.pending = append(s.pending, pendingWrite{key: key, isDelete: true})
+	return nil
+}
+
+/**
+Commit the writes of the transaction, in the order they were made.
+ */
+func (s *testStub) MockTransactionEnd(uuid string) {
+	for _, write := range s.pending {
+		var err error
+		if write.isDelete {
+			err = s.MockStub.DelState(write.key)
+		} else {
+			err = s.MockStub.PutState(write.key, write.value)
+		}
+		if err != nil {
+			panic(err)
+		}
+		s.history[write.key] = append(s.history[write.key], &queryresult.KeyModification{TxId: s.TxID, Value: write.value,
+			Timestamp: s.TxTimestamp, IsDelete: write.isDelete})
+	}
+	s.pending = nil
+	s.MockStub.MockTransactionEnd(uuid)
+}
+
+func (s *testStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &historyIterator{modifications: s.history[key]}, nil
+}
+
+func (s *testStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	results, err := s.runQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return &kvIterator{results: results}, nil
+}
+
+func (s *testStub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	results, err := s.runQuery(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	return paginate(results, pageSize, bookmark)
+}
+
+func (s *testStub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	iterator, err := s.MockStub.GetStateByPartialCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer iterator.Close()
+	var results []*queryresult.KV
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		results = append(results, kv)
+	}
+	return paginate(results, pageSize, bookmark)
+}
+
+// The bookmark of a page is the key of its last result.
+func paginate(results []*queryresult.KV, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	start := 0
+	if len(bookmark) > 0 {
+		for start < len(results) && results[start].Key != bookmark {
+			start++
+		}
+		start++
+	}
+	if start > len(results) {
+		start = len(results)
+	}
+	end := start + int(pageSize)
+	if end > len(results) {
+		end = len(results)
+	}
+	page := results[start:end]
+	metadata := &pb.QueryResponseMetadata{FetchedRecordsCount: int32(len(page))}
+	if len(page) > 0 {
+		metadata.Bookmark = page[len(page)-1].Key
+	}
+	return &kvIterator{results: page}, metadata, nil
+}
+
+/**
+Evaluate a CouchDB query over the world state. Only what the chaincode uses is supported: field conditions with the
+comparison operators, $exists, $regex, $elemMatch, $or and $and, and sort.
+ */
+func (s *testStub) runQuery(query string) ([]*queryresult.KV, error) {
+	var parsed struct {
+		Selector map[string]interface{} `json:"selector"`
+		Sort     []map[string]string    `json:"sort"`
+	}
+	if err := json.Unmarshal([]byte(query), &parsed); err != nil {
+		return nil, err
+	}
+	type document struct {
+		kv   *queryresult.KV
+		body map[string]interface{}
+	}
+	var documents []document
+	for element := s.Keys.Front(); element != nil; element = element.Next() {
+		key := element.Value.(string)
+		var body map[string]interface{}
+		if err := json.Unmarshal(s.State[key], &body); err != nil {
+			//index entries and other values that are not JSON documents
+			continue
+		}
+		body["_id"] = key
+		matched, err := matchSelector(body, parsed.Selector)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			documents = append(documents, document{&queryresult.KV{Key: key, Value: s.State[key]}, body})
+		}
+	}
+	sort.SliceStable(documents, func(i, j int) bool {
+		for _, field := range parsed.Sort {
+			for name, direction := range field {
+				left, _ := lookupField(documents[i].body, name)
+				right, _ := lookupField(documents[j].body, name)
+				if cmp := collate(left, right); cmp != 0 {
+					return (cmp < 0) == (direction != "desc")
+				}
+			}
+		}
+		return documents[i].kv.Key < documents[j].kv.Key
+	})
+	results := make([]*queryresult.KV, len(documents))
+	for i, document := range documents {
+		results[i] = document.kv
+	}
+	return results, nil
+}
+
+func matchSelector(body map[string]interface{}, selector map[string]interface{}) (bool, error) {
+	for field, condition := range selector {
+		switch field {
+		case "$or", "$and":
+			clauses, ok := condition.([]interface{})
+			if !ok {
+				return false, fmt.Errorf("%v needs an array", field)
+			}
+			matchedAny := false
+			for _, clause := range clauses {
+				clauseSelector, ok := clause.(map[string]interface{})
+				if !ok {
+					return false, fmt.Errorf("%v needs an array of selectors", field)
+				}
+				matched, err := matchSelector(body, clauseSelector)
+				if err != nil {
+					return false, err
+				}
+				if field == "$and" && !matched {
+					return false, nil
+				}
+				matchedAny = matchedAny || matched
+			}
+			if field == "$or" && !matchedAny {
+				return false, nil
+			}
+		default:
+			value, found := lookupField(body, field)
+			matched, err := matchCondition(value, found, condition)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// As in CouchDB, a missing field only matches {"$exists": false}.
+func matchCondition(value interface{}, found bool, condition interface{}) (bool, error) {
+	operators, ok := condition.(map[string]interface{})
+	if !ok || !isOperatorMap(operators) {
+		return found && collate(value, condition) == 0, nil
+	}
+	for operator, argument := range operators {
+		if operator == "$exists" {
+			if found != (argument == true) {
+				return false, nil
+			}
+			continue
+		}
+		if !found {
+			return false, nil
+		}
+		var matched bool
+		switch operator {
+		case "$eq":
+			matched = collate(value, argument) == 0
+		case "$ne":
+			matched = collate(value, argument) != 0
+		case "$lt":
+			matched = collate(value, argument) < 0
+		case "$lte":
+			matched = collate(value, argument) <= 0
+		case "$gt":
+			matched = collate(value, argument) > 0
+		case "$gte":
+			matched = collate(value, argument) >= 0
+		case "$regex":
+			text, isString := value.(string)
+			pattern, err := regexp.Compile(fmt.Sprint(argument))
+			if err != nil {
+				return false, err
+			}
+			matched = isString && pattern.MatchString(text)
+		case "$elemMatch":
+			elements, isArray := value.([]interface{})
+			for _, element := range elements {
+				if elementMatched, err := matchCondition(element, true, argument); err != nil {
+					return false, err
+				} else if elementMatched {
+					matched = isArray
+					break
+				}
+			}
+		default:
+			return false, fmt.Errorf("operator %v is not supported by the test stub", operator)
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func isOperatorMap(operators map[string]interface{}) bool {
+	for key := range operators {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return len(operators) > 0
+}
+
+func lookupField(body map[string]interface{}, field string) (interface{}, bool) {
+	var value interface{} = body
+	for _, part := range strings.Split(field, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[part]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// collate orders JSON values the way CouchDB does across types: null, false,
+// true, numbers, strings, arrays, objects. Strings compare by bytes.
+func collate(left interface{}, right interface{}) int {
+	rank := func(value interface{}) int {
+		switch value := value.(type) {
+		case nil:
+			return 0
+		case bool:
+			if value {
+				return 2
+			}
+			return 1
+		case float64:
+			return 3
+		case string:
+			return 4
+		case []interface{}:
+			return 5
+		}
+		return 6
+	}
+	if leftRank, rightRank := rank(left), rank(right); leftRank != rightRank {
+		return leftRank - rightRank
+	}
+	switch left := left.(type) {
+	case float64:
+		right := right.(float64)
+		if left < right {
+			return -1
+		} else if left > right {
+			return 1
+		}
+	case string:
+		return strings.Compare(left, right.(string))
+	case []interface{}, map[string]interface{}:
+		leftBytes, _ := json.Marshal(left)
+		rightBytes, _ := json.Marshal(right)
+		return strings.Compare(string(leftBytes), string(rightBytes))
+	}
+	return 0
+}
+
+type kvIterator struct {
+	results []*queryresult.KV
+	next    int
+}
+
+func (i *kvIterator) HasNext() bool {
+	return i.next < len(i.results)
+}
+
+func (i *kvIterator) Next() (*queryresult.KV, error) {
+	if !i.HasNext() {
+		return nil, fmt.Errorf("iterator is exhausted")
+	}
+	i.next++
+	return i.results[i.next-1], nil
+}
+
+func (i *kvIterator) Close() error {
+	return nil
+}
+
+type historyIterator struct {
+	modifications []*queryresult.KeyModification
+	next          int
+}
+
+func (i *historyIterator) HasNext() bool {
+	return i.next < len(i.modifications)
+}
+
+func (i *historyIterator) Next() (*queryresult.KeyModification, error) {
+	if !i.HasNext() {
+		return nil, fmt.Errorf("iterator is exhausted")
+	}
+	i.next++
+	return i.modifications[i.next-1], nil
+}
+
+func (i *historyIterator) Close() error {
+	return nil
+}
+
+// testLedger runs transactions against the chaincode at a clock the test
+// controls. Like a peer, it throws away the writes of a failed transaction.
+// The admin approves the users the tests register.
+type testLedger struct {
+	t     testing.TB
+	cc    *AuctionChaincode
+	stub  *testStub
+	now   time.Time
+	txSeq int
+	admin *testIdentity
+}
+
+func newTestLedger(t testing.TB) *testLedger {
+	cc := New(shim.NewLogger(name))
+	cc.SetLevel(shim.LogWarning)
+	return &testLedger{t: t, cc: cc, stub: newTestStub(cc), now: time.Date(2018, 10, 1, 9, 0, 0, 0, time.UTC),
+		admin: newTestIdentityWithRole(t, "admin@example.com", "Org1", ROLE_ADMIN)}
+}
+
+func (l *testLedger) invoke(identity *testIdentity, function string, args ...string) pb.Response {
+	l.txSeq++
+	txId := fmt.Sprintf("tx%06d", l.txSeq)
+
+	l.stub.MockTransactionStart(txId)
+	l.stub.TxTimestamp = &timestamp.Timestamp{Seconds: l.now.Unix(), Nanos: int32(l.now.Nanosecond())}
+	l.stub.creator = identity.serialized
+	l.stub.args = append([]string{function}, args...)
+	l.stub.event = nil
+	response := l.cc.Invoke(l.stub)
+	if response.Status >= shim.ERRORTHRESHOLD {
+		l.stub.pending, l.stub.event = nil, nil
+	}
+	l.stub.MockTransactionEnd(txId)
+	return response
+}
+
+func (l *testLedger) snapshot() (map[string][]byte, *list.List, map[string][]*queryresult.KeyModification) {
+	state := make(map[string][]byte, len(l.stub.State))
+	for key, value := range l.stub.State {
+		state[key] = value
+	}
+	keys := list.New()
+	for element := l.stub.Keys.Front(); element != nil; element = element.Next() {
+		keys.PushBack(element.Value)
+	}
+	history := make(map[string][]*queryresult.KeyModification, len(l.stub.history))
+	for key, modifications := range l.stub.history {
+		history[key] = append([]*queryresult.KeyModification(nil), modifications...)
+	}
+	return state, keys, history
+}
+
+// mustInvoke fails the test unless the transaction succeeds, and returns its payload.
+func (l *testLedger) mustInvoke(identity *testIdentity, function string, args ...string) []byte {
+	l.t.Helper()
+	response := l.invoke(identity, function, args...)
+	if response.Status >= shim.ERRORTHRESHOLD {
+		l.t.Fatalf("%v(%v) failed : %v", function, strings.Join(args, ", "), response.Message)
+	}
+	return response.Payload
+}
+
+// expectError fails the test unless the transaction fails with a message containing want.
+func (l *testLedger) expectError(want string, identity *testIdentity, function string, args ...string) {
+	l.t.Helper()
+	response := l.invoke(identity, function, args...)
+	if response.Status < shim.ERRORTHRESHOLD {
+		l.t.Fatalf("%v(%v) succeeded, want error %q", function, strings.Join(args, ", "), want)
+	}
+	if !strings.Contains(response.Message, want) {
+		l.t.Fatalf("%v(%v) failed with %q, want %q", function, strings.Join(args, ", "), response.Message, want)
+	}
+}
+
+// expectErrorCode checks the code and field of the error envelope rather than the message.
+func (l *testLedger) expectErrorCode(code string, field string, identity *testIdentity, function string, args ...string) {
+	l.t.Helper()
+	response := l.invoke(identity, function, args...)
+	if response.Status < shim.ERRORTHRESHOLD {
+		l.t.Fatalf("%v(%v) succeeded, want error %v", function, strings.Join(args, ", "), code)
+	}
+	var envelope ChaincodeError
+	if err := json.Unmarshal([]byte(response.Message), &envelope); err != nil {
+		l.t.Fatalf("%v(%v) failed with %q, not an error envelope : %v", function, strings.Join(args, ", "), response.Message, err)
+	}
+	if envelope.Code != code || envelope.Field != field {
+		l.t.Fatalf("%v(%v) failed with %v on %q (%v), want %v on %q", function, strings.Join(args, ", "), envelope.Code,
+			envelope.Field, envelope.Message, code, field)
+	}
+}
+
+func (l *testLedger) advance(d time.Duration) {
+	l.now = l.now.Add(d)
+}
+
+/**
+Register the user and approve them with balance as their credit limit.
+ */
+func (l *testLedger) addUser(identity *testIdentity, balance string) {
+	l.t.Helper()
+	l.mustInvoke(identity, "addUser", fmt.Sprintf(`{"userId":%q}`, identity.email))
+	l.approveUser(identity.email, balance)
+}
+
+func (l *testLedger) approveUser(email string, creditLimit string) {
+	l.t.Helper()
+	l.mustInvoke(l.admin, "approveUser", fmt.Sprintf(`{"email":%q,"creditLimit":%q}`, email, creditLimit))
+}
+
+/**
+List an asset whose bidding opens in an hour and runs for duration. Returns the generated asset id.
+ */
+func (l *testLedger) addAsset(seller *testIdentity, name string, price string, duration time.Duration) string {
+	l.t.Helper()
+	bidStart := l.now.Add(time.Hour)
+	bidEnd := bidStart.Add(duration)
+	assetJson := fmt.Sprintf(`{"name":%q,"price":%q,"bidStart":%q,"bidEnd":%q}`, name, price,
+		bidStart.Format(time.RFC3339), bidEnd.Format(time.RFC3339))
+	var asset Asset
+	decodeEntity(l.t, l.mustInvoke(seller, "addAssetForBid", assetJson), &asset)
+	return asset.AssetId
+}
+
+func (l *testLedger) placeBid(bidder *testIdentity, assetId string, amount string) pb.Response {
+	bidJson := fmt.Sprintf(`{"asset":{"assetId":%q},"bidAmount":%q,"bidTime":%q}`, assetId, amount, l.now.Format(time.RFC3339))
+	return l.invoke(bidder, "placeBid", bidJson, "-")
+}
+
+func (l *testLedger) getUser(identity *testIdentity, email string) *User {
+	l.t.Helper()
+	var user User
+	if err := json.Unmarshal(l.mustInvoke(identity, "getUser", email), &user); err != nil {
+		l.t.Fatal(err)
+	}
+	return &user
+}
+
+func (l *testLedger) getAsset(assetId string) *Asset {
+	l.t.Helper()
+	asset, err := getAsset(l.stub, assetId)
+	if err != nil {
+		l.t.Fatal(err)
+	}
+	return asset
+}
+
+func (l *testLedger) lastEvent() *EventEnvelope {
+	l.t.Helper()
+	if l.stub.event == nil {
+		return nil
+	}
+	var envelope EventEnvelope
+	if err := json.Unmarshal(l.stub.event.Payload, &envelope); err != nil {
+		l.t.Fatal(err)
+	}
+	return &envelope
+}
+
+// decodeEntity unwraps the InvokeResponse of an invoke, decoding its entity into entity.
+func decodeEntity(t testing.TB, payload []byte, entity interface{}) *InvokeResponse {
+	t.Helper()
+	var response struct {
+		InvokeResponse
+		Entity json.RawMessage `json:"entity"`
+	}
+	if err := json.Unmarshal(payload, &response); err != nil {
+		t.Fatalf("payload %s is not an invoke response : %v", payload, err)
+	}
+	if response.Status != RESPONSE_STATUS_OK {
+		t.Fatalf("invoke response status is %q", response.Status)
+	}
+	if entity != nil {
+		if err := json.Unmarshal(response.Entity, entity); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(response.Entity) > 0 {
+		response.InvokeResponse.Entity = response.Entity
+	}
+	return &response.InvokeResponse
+}
+
+// decodeItems unwraps the ListResponse of a query, decoding its items into items.
+func decodeItems(t testing.TB, payload []byte, items interface{}) *ListResponse {
+	t.Helper()
+	var response struct {
+		ListResponse
+		Items json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(payload, &response); err != nil {
+		t.Fatalf("payload %s is not a list response : %v", payload, err)
+	}
+	if err := json.Unmarshal(response.Items, items); err != nil {
+		t.Fatal(err)
+	}
+	if count := reflect.ValueOf(items).Elem().Len(); count != response.Count {
+		t.Fatalf("list response has %v items but a count of %v", count, response.Count)
+	}
+	response.ListResponse.Items = response.Items
+	return &response.ListResponse
+}
+
+func money(t testing.TB, value string) *Money {
+	amount, err := parseMoney(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return amount
+}
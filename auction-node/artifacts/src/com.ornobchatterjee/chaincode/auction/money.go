@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// Every currency has two decimal places unless it is listed here with the
+// number of decimal places of its minor unit (ISO 4217).
+const (
+	DEFAULT_CURRENCY_SCALE = 2
+)
+
+var currencyScales = map[string]int{
+	"BHD": 3, "CLP": 0, "IQD": 3, "ISK": 0, "JOD": 3, "JPY": 0,
+	"KRW": 0, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3, "VND": 0,
+}
+
+// RoundingMode says which way an amount between two minor units goes.
+type RoundingMode int
+
+const (
+	// ROUND_HALF_UP rounds halves away from zero.
+	ROUND_HALF_UP RoundingMode = iota
+	// ROUND_HALF_EVEN rounds halves to the even minor unit.
+	ROUND_HALF_EVEN
+)
+
+// Fees are worked out exactly and rounded once, on the total rather than per
+// bracket, half-up to the minor unit of the currency. Converted amounts are
+// only shown to users and round half-even so that they carry no bias.
+const (
+	FEE_ROUNDING = ROUND_HALF_UP
+	FX_ROUNDING  = ROUND_HALF_EVEN
+)
+
+var moneyPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// Amounts were stored as big.Rat before Money, which wrote any amount that is
+// not a whole number as a fraction such as 25/2.
+var ratPattern = regexp.MustCompile(`^-?[0-9]+/[0-9]+$`)
+
+// Money is a decimal amount of units * 10^-scale. Amounts on the ledger are
+// kept at the scale of their currency and encode as a JSON string with exactly
+// that many decimal places, e.g. "12.50" for dollars and "1250" for yen.
+type Money struct {
+	units *big.Int
+	scale int
+}
+
+func currencyScale(currency string) int {
+	if scale, ok := currencyScales[currencyOf(currency)]; ok {
+		return scale
+	}
+	return DEFAULT_CURRENCY_SCALE
+}
+
+// zeroMoney is zero at the scale of currency.
+func zeroMoney(currency string) *Money {
+	return &Money{new(big.Int), currencyScale(currency)}
+}
+
+/**
+Parse a plain decimal such as 12.50 or -3. Fractions, exponents and a leading + are not amounts.
+ */
+func parseMoney(value string) (*Money, error) {
+	if !moneyPattern.MatchString(value) {
+		return nil, fmt.Errorf("%q is not a decimal amount", value)
+	}
+	scale := 0
+	if point := strings.IndexByte(value, '.'); point >= 0 {
+		scale = len(value) - point - 1
+		value = value[:point] + value[point+1:]
+	}
+	units, _ := new(big.Int).SetString(value, 10)
+	return &Money{units, scale}, nil
+}
+
+/**
+Round an exact amount to scale decimal places.
+ */
+func roundMoney(amount *big.Rat, scale int, mode RoundingMode) *Money {
+	numerator := new(big.Int).Mul(amount.Num(), pow10(scale))
+	units, remainder := new(big.Int).QuoRem(numerator, amount.Denom(), new(big.Int))
+	//compare twice the remainder with the denominator to tell below, at and above the half
+	half := new(big.Int).Abs(remainder)
+	half.Mul(half, big.NewInt(2))
+	switch half.Cmp(amount.Denom()) {
+	case 1:
+		units.Add(units, big.NewInt(int64(amount.Sign())))
+	case 0:
+		if mode == ROUND_HALF_UP || units.Bit(0) == 1 {
+			units.Add(units, big.NewInt(int64(amount.Sign())))
+		}
+	}
+	return &Money{units, scale}
+}
+
+func pow10(exponent int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)
+}
+
+func (m *Money) String() string {
+	if m == nil {
+		return "<nil>"
+	}
+	digits := new(big.Int).Abs(m.units).String()
+	if m.scale > 0 {
+		if len(digits) <= m.scale {
+			digits = strings.Repeat("0", m.scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-m.scale] + "." + digits[len(digits)-m.scale:]
+	}
+	if m.units.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+func (m *Money) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+/**
+Read an amount. Fractions stored by earlier versions of the chaincode are read exactly at the fewest decimal places
+they need; the caller moves them to the scale of their currency. Clients are held to plain decimals by decodeInput.
+ */
+func (m *Money) UnmarshalText(text []byte) error {
+	parse := parseMoney
+	if ratPattern.Match(text) {
+		parse = parseFraction
+	}
+	parsed, err := parse(string(text))
+	if err != nil {
+		return err
+	}
+	*m = *parsed
+	return nil
+}
+
+/**
+Parse a fraction such as 25/2 that has an exact decimal value. 1/3 has none and is refused.
+ */
+func parseFraction(value string) (*Money, error) {
+	fraction, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a decimal amount", value)
+	}
+	//the denominator of a decimal has no prime factors but 2 and 5
+	denominator := new(big.Int).Set(fraction.Denom())
+	scale := 0
+	for _, factor := range []int64{2, 5} {
+		count := 0
+		for remainder := new(big.Int); ; count++ {
+			quotient, _ := new(big.Int).QuoRem(denominator, big.NewInt(factor), remainder)
+			if remainder.Sign() != 0 {
+				break
+			}
+			denominator = quotient
+		}
+		if count > scale {
+			scale = count
+		}
+	}
+	if denominator.Cmp(big.NewInt(1)) != 0 {
+		return nil, fmt.Errorf("%q is not a decimal amount", value)
+	}
+	units := new(big.Int).Mul(fraction.Num(), pow10(scale))
+	return &Money{units.Quo(units, fraction.Denom()), scale}, nil
+}
+
+func (m *Money) Sign() int {
+	return m.units.Sign()
+}
+
+func (m *Money) Cmp(other *Money) int {
+	a, b := align(m, other)
+	return a.Cmp(b)
+}
+
+func (m *Money) Add(other *Money) *Money {
+	a, b := align(m, other)
+	return &Money{a.Add(a, b), maxScale(m, other)}
+}
+
+func (m *Money) Sub(other *Money) *Money {
+	a, b := align(m, other)
+	return &Money{a.Sub(a, b), maxScale(m, other)}
+}
+
+func (m *Money) Neg() *Money {
+	return &Money{new(big.Int).Neg(m.units), m.scale}
+}
+
+// rat is the exact value of the amount, for multiplying by rates.
+func (m *Money) rat() *big.Rat {
+	return new(big.Rat).SetFrac(m.units, pow10(m.scale))
+}
+
+// Float64 is the nearest float, for the price index CouchDB sorts on.
+func (m *Money) Float64() float64 {
+	value, _ := m.rat().Float64()
+	return value
+}
+
+// fitsScale is whether the amount has no fraction finer than scale decimal places.
+func (m *Money) fitsScale(scale int) bool {
+	if m.scale <= scale {
+		return true
+	}
+	return new(big.Int).Rem(m.units, pow10(m.scale-scale)).Sign() == 0
+}
+
+// setScale moves the amount to scale decimal places, which must not drop any digit other than a trailing zero.
+func (m *Money) setScale(scale int) {
+	if scale >= m.scale {
+		m.units = new(big.Int).Mul(m.units, pow10(scale-m.scale))
+	} else {
+		m.units = new(big.Int).Quo(m.units, pow10(m.scale-scale))
+	}
+	m.scale = scale
+}
+
+// align returns the units of both amounts at the larger of their scales.
+func align(a *Money, b *Money) (*big.Int, *big.Int) {
+	scale := maxScale(a, b)
+	return new(big.Int).Mul(a.units, pow10(scale-a.scale)), new(big.Int).Mul(b.units, pow10(scale-b.scale))
+}
+
+func maxScale(a *Money, b *Money) int {
+	if a.scale > b.scale {
+		return a.scale
+	}
+	return b.scale
+}
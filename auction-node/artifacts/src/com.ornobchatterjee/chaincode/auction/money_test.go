@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestParseMoney(t *testing.T) {
+	for _, value := range []string{"0", "12", "12.5", "12.50", "-0.05", "007"} {
+		if _, err := parseMoney(value); err != nil {
+			t.Errorf("%v does not parse : %v", value, err)
+		}
+	}
+	for _, value := range []string{"", "1/3", "1e3", "+1", ".5", "5.", "1,000", " 1", "0x10", "NaN"} {
+		if amount, err := parseMoney(value); err == nil {
+			t.Errorf("%v parses as %v", value, amount)
+		}
+	}
+}
+
+func TestParseFraction(t *testing.T) {
+	for _, c := range []struct {
+		value string
+		want  string
+	}{
+		{"25/2", "12.5"},
+		{"1000/1", "1000"},
+		{"-1/20", "-0.05"},
+		{"2001/8", "250.125"},
+		{"30/4", "7.5"},
+	} {
+		var amount Money
+		if err := amount.UnmarshalText([]byte(c.value)); err != nil || amount.String() != c.want {
+			t.Errorf("%v reads as %v, want %v : %v", c.value, amount.String(), c.want, err)
+		}
+	}
+	for _, value := range []string{"1/3", "1/0", "7/6", "1/-2"} {
+		var amount Money
+		if err := amount.UnmarshalText([]byte(value)); err == nil {
+			t.Errorf("%v reads as %v", value, amount.String())
+		}
+	}
+}
+
+func TestMoneyEncoding(t *testing.T) {
+	for _, c := range []struct {
+		value    string
+		currency string
+		want     string
+	}{
+		{"12.5", "USD", "12.50"},
+		{"12.500", "", "12.50"},
+		{"1250", "JPY", "1250"},
+		{"1250.0", "JPY", "1250"},
+		{"0.5", "KWD", "0.500"},
+		{"-0.05", "EUR", "-0.05"},
+	} {
+		amount := money(t, c.value)
+		if err := checkAmount("amount", amount, c.currency); err != nil {
+			t.Fatal(err)
+		}
+		encoded, _ := json.Marshal(amount)
+		if string(encoded) != `"`+c.want+`"` {
+			t.Errorf("%v %v encodes as %s, want %q", c.value, c.currency, encoded, c.want)
+		}
+		var decoded Money
+		if err := json.Unmarshal(encoded, &decoded); err != nil || decoded.String() != c.want {
+			t.Errorf("%s decodes as %v : %v", encoded, decoded.String(), err)
+		}
+	}
+	if err := checkAmount("amount", money(t, "0.001"), "USD"); err == nil {
+		t.Error("a tenth of a cent is accepted")
+	}
+	if err := json.Unmarshal([]byte(`12.5`), new(Money)); err == nil {
+		t.Error("an amount as a JSON number is accepted")
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	//amounts stored before scales existed have none, they still add up with amounts that do
+	sum := money(t, "100").Add(money(t, "-0.25"))
+	if sum.String() != "99.75" || sum.Cmp(money(t, "99.750")) != 0 {
+		t.Errorf("100 - 0.25 is %v", sum)
+	}
+	if difference := money(t, "1.5").Sub(money(t, "2")); difference.String() != "-0.5" || difference.Sign() >= 0 {
+		t.Errorf("1.5 - 2 is %v", difference)
+	}
+	if money(t, "3").Neg().Cmp(money(t, "-3.00")) != 0 {
+		t.Error("-3 is not -3.00")
+	}
+}
+
+func TestRoundMoney(t *testing.T) {
+	for _, c := range []struct {
+		amount *big.Rat
+		scale  int
+		mode   RoundingMode
+		want   string
+	}{
+		{big.NewRat(125, 1000), 2, ROUND_HALF_UP, "0.13"},
+		{big.NewRat(125, 1000), 2, ROUND_HALF_EVEN, "0.12"},
+		{big.NewRat(135, 1000), 2, ROUND_HALF_EVEN, "0.14"},
+		{big.NewRat(-125, 1000), 2, ROUND_HALF_UP, "-0.13"},
+		{big.NewRat(-125, 1000), 2, ROUND_HALF_EVEN, "-0.12"},
+		{big.NewRat(1, 3), 2, ROUND_HALF_UP, "0.33"},
+		{big.NewRat(2, 3), 2, ROUND_HALF_UP, "0.67"},
+		{big.NewRat(1005, 8), 0, ROUND_HALF_UP, "126"},
+		{big.NewRat(5, 2), 0, ROUND_HALF_EVEN, "2"},
+	} {
+		if got := roundMoney(c.amount, c.scale, c.mode).String(); got != c.want {
+			t.Errorf("%v to %v places in mode %v is %v, want %v", c.amount.RatString(), c.scale, c.mode, got, c.want)
+		}
+	}
+}
+
+func TestFeesRoundToTheMinorUnit(t *testing.T) {
+	f := newAuctionFixture(t)
+	f.mustInvoke(f.house, "setFeeSchedule", `{"buyerPremiumPct":"12.5","sellerCommissionPct":"0.1","houseAccountEmail":"house@example.com"}`)
+	assetId := f.addAssetIn(f.alice, "Bowl", "1000", "JPY", time.Hour)
+	if asset := f.getAsset(assetId); asset.Price.String() != "1000" {
+		t.Fatalf("yen price is stored as %v", asset.Price)
+	}
+	f.mustInvoke(f.house, "deposit", `{"email":"bob@example.com","amount":"2000","currency":"JPY"}`)
+	f.advance(90 * time.Minute)
+	f.mustInvoke(f.bob, "placeBid", f.bidIn(f.bob, assetId, "1005", "JPY"), "-")
+	f.advance(time.Hour)
+	f.getBidResult()
+
+	//12.5% of 1005 is 125.625 and rounds up to 126, 0.1% is 1.005 and rounds down to 1
+	var settlements []Settlement
+	decodeItems(t, f.mustInvoke(f.house, "getSettlementsForAsset", assetId), &settlements)
+	if len(settlements) != 1 {
+		t.Fatalf("settlements are %+v", settlements)
+	}
+	fees := settlements[0].Fees
+	if fees.BuyerPremium.String() != "126" || fees.SellerCommission.String() != "1" || settlements[0].PriceCharged.String() != "1131" {
+		t.Fatalf("fees are %+v", fees)
+	}
+	if balance := f.getUser(f.house, f.alice.email).balance("JPY"); balance.String() != "1004" {
+		t.Fatalf("seller has %v yen", balance)
+	}
+	f.expectConsistent()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func isAdmin(stub shim.ChaincodeStubInterface) bool {
+	org, _ := getMSPAttr(stub, MSP_ATTRIBUTE_ORG)
+	role, _ := getMSPAttr(stub, MSP_ATTRIBUTE_ROLE)
+	return org == "Org2" || role == ROLE_ADMIN
+}
+
+/**
+Fail unless the user has been approved.
+ */
+func requireApproved(user *User) error {
+	if user.Status == USER_STATUS_PENDING {
+		return newError(ERROR_NOT_APPROVED, "", "User %v is awaiting approval", user.Email)
+	}
+	return nil
+}
+
+/**
+Approve a pending user. args[0] is a UserApproval. The credit limit, if any, is paid into the balance of the user and
+recorded as a credit entry of their journal.
+ */
+func (t *AuctionChaincode) approveUser(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if !isAdmin(stub) {
+		return unauthorized("Only Auction house and admin users are allowed to invoke this function")
+	}
+
+	var approval UserApproval
+	err := decodeInput(args[0], &approval)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if err = validateUserApproval(&approval); err != nil {
+		return errorResponse(err)
+	}
+
+	user, err := getUserByEmail(stub, approval.Email)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if user.Status != USER_STATUS_PENDING {
+		return errorResponse(newError(ERROR_INVALID_STATE, "", "User %v is already approved", user.Email))
+	}
+	approvedBy, err := getMSPAttr(stub, MSP_ATTRIBUTE_EMAIL)
+	if err != nil {
+		return errorResponse(err)
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	user.Status = USER_STATUS_APPROVED
+	user.ApprovedBy = approvedBy
+	user.ApprovedAt = txTime
+
+	var events EventBatch
+	currency := currencyOf(approval.Currency)
+	if approval.CreditLimit != nil && approval.CreditLimit.Sign() > 0 {
+		user.CreditLimits = map[string]*Money{currency: approval.CreditLimit}
+		previousBalance := user.balance(currency)
+		var journal Journal
+		entry, err := journal.post(stub, user, currency, JOURNAL_CREDIT, approval.CreditLimit, "", approval.Reference)
+		if err != nil {
+			return errorResponse(err)
+		}
+		if err = events.add(EVENT_BALANCE_CHANGED, BalanceChangedEvent{user.Email, currency, previousBalance, entry.Balance, JOURNAL_CREDIT, ""}); err != nil {
+			return errorResponse(err)
+		}
+	}
+	if err = putUser(stub, user); err != nil {
+		return errorResponse(err)
+	}
+
+	if err = events.add(EVENT_USER_APPROVED, UserApprovedEvent{user.Email, approval.CreditLimit, currency, approvedBy}); err != nil {
+		return errorResponse(err)
+	}
+	return invokeSuccess(stub, user, &events)
+}
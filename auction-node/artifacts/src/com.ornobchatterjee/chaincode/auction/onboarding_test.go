@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApproveUser(t *testing.T) {
+	f := newAuctionFixture(t)
+	dave := newTestIdentity(t, "dave@example.com", "Org1")
+	f.mustInvoke(dave, "addUser", `{"userId":"dave"}`)
+	assetId := f.addAsset(f.alice, "Vase", "100", time.Hour)
+	f.advance(90 * time.Minute)
+
+	//a pending user can neither bid nor list
+	f.expectErrorCode(ERROR_NOT_APPROVED, "", dave, "placeBid", `{"asset":{"assetId":"`+assetId+`"},"bidAmount":"100"}`, "-")
+	f.expectErrorCode(ERROR_NOT_APPROVED, "", dave, "addAssetForBid", `{"name":"Lamp","price":"10","bidStart":"`+
+		f.now.Add(time.Hour).Format(time.RFC3339)+`","bidEnd":"`+f.now.Add(2*time.Hour).Format(time.RFC3339)+`"}`)
+
+	f.expectErrorCode(ERROR_UNAUTHORIZED, "", f.alice, "approveUser", `{"email":"dave@example.com"}`)
+	f.expectErrorCode(ERROR_UNAUTHORIZED, "", dave, "approveUser", `{"email":"dave@example.com","creditLimit":"500"}`)
+	f.expectErrorCode(ERROR_NEGATIVE, "creditLimit", f.house, "approveUser", `{"email":"dave@example.com","creditLimit":"-1"}`)
+	f.expectErrorCode(ERROR_NOT_REGISTERED, "", f.house, "approveUser", `{"email":"erin@example.com"}`)
+	f.expectErrorCode(ERROR_INVALID_STATE, "", f.house, "approveUser", `{"email":"alice@example.com"}`)
+
+	var user User
+	response := decodeEntity(t, f.mustInvoke(f.house, "approveUser", `{"email":"dave@example.com","creditLimit":"500","reference":"KYC 42"}`), &user)
+	if user.Status != USER_STATUS_APPROVED || user.ApprovedBy != f.house.email || user.ApprovedAt == nil ||
+		user.CreditLimits[DEFAULT_CURRENCY].Cmp(money(t, "500")) != 0 || user.balance(DEFAULT_CURRENCY).Cmp(money(t, "500")) != 0 {
+		t.Fatalf("approveUser returned %+v", user)
+	}
+	if len(response.Events) != 2 || response.Events[0].Type != EVENT_BALANCE_CHANGED || response.Events[1].Type != EVENT_USER_APPROVED {
+		t.Fatalf("approveUser raised %+v", response.Events)
+	}
+	f.expectErrorCode(ERROR_INVALID_STATE, "", f.house, "approveUser", `{"email":"dave@example.com","creditLimit":"500"}`)
+
+	//the credit is the funding record of the user
+	entries, _ := f.getStatement(dave)
+	if len(entries) != 1 || entries[0].Type != JOURNAL_CREDIT || entries[0].Amount.Cmp(money(t, "500")) != 0 ||
+		entries[0].Reference != "KYC 42" || entries[0].PostedBy != f.house.email {
+		t.Fatalf("statement of dave is %+v", entries)
+	}
+	if response := f.placeBid(dave, assetId, "100"); response.Status != 200 {
+		t.Fatalf("bid of an approved user failed : %v", response.Message)
+	}
+	f.expectConsistent()
+}
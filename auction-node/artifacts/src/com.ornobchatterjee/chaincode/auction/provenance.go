@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"encoding/json"
+	"time"
+)
+
+/**
+List the owners of an asset from the history of its key, in commit order. args[0] is the asset id.
+ */
+func (t *AuctionChaincode) getAssetProvenance(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	assetId := args[0]
+	if len(assetId) == 0 {
+		return errorResponse(newError(ERROR_REQUIRED, "assetId", "Asset ID is mandatory"))
+	}
+	assetKey, err := getCompositeKey(stub, COMPOSITE_KEY_ASSET, assetId)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	historyIterator, err := stub.GetHistoryForKey(assetKey)
+	if err != nil {
+		return errorResponse(err)
+	}
+	defer historyIterator.Close()
+
+	//a peer returns the history in commit order, the proposal timestamps are set by the clients and cannot order it
+	var provenance = make([]ProvenanceEntry, 0)
+	found := false
+	for historyIterator.HasNext() {
+		keyModification, err := historyIterator.Next()
+		if err != nil {
+			return errorResponse(err)
+		}
+		if keyModification.IsDelete {
+			continue
+		}
+		found = true
+		var assetObj Asset
+		if err = json.Unmarshal(keyModification.Value, &assetObj); err != nil {
+			return errorResponse(err)
+		}
+		if assetObj.Owner == nil {
+			continue
+		}
+		if len(provenance) > 0 && provenance[len(provenance)-1].OwnerEmail == assetObj.Owner.Email {
+			continue
+		}
+		entry := ProvenanceEntry{OwnerEmail: assetObj.Owner.Email, TxId: keyModification.TxId}
+		if keyModification.Timestamp != nil {
+			timestamp := time.Unix(keyModification.Timestamp.Seconds, int64(keyModification.Timestamp.Nanos)).UTC()
+			entry.Timestamp = &timestamp
+		}
+		if len(provenance) > 0 {
+			entry.SalePrice = assetObj.SoldPrice
+			entry.Currency = currencyOf(assetObj.Currency)
+		}
+		provenance = append(provenance, entry)
+	}
+	if !found {
+		return errorResponse(newError(ERROR_NOT_FOUND, "assetId", "Asset : %v is not found", assetId))
+	}
+
+	return listSuccess(provenance, "")
+}
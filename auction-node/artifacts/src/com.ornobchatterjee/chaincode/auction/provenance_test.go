@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"testing"
+	"time"
+)
+
+func TestGetAssetProvenance(t *testing.T) {
+	f := newAuctionFixture(t)
+	assetId := f.addAsset(f.alice, "Vase", "100", time.Hour)
+	//rewrites of the asset that keep its owner add no entry
+	f.mustInvoke(f.house, "extendAuction", assetId, f.now.Add(3*time.Hour).Format(time.RFC3339))
+	f.advance(90 * time.Minute)
+	if response := f.placeBid(f.bob, assetId, "150"); response.Status != 200 {
+		t.Fatalf("bid failed : %v", response.Message)
+	}
+	f.advance(3 * time.Hour)
+	f.getBidResult()
+
+	f.expectErrorCode(ERROR_REQUIRED, "assetId", f.carol, "getAssetProvenance", "")
+	f.expectErrorCode(ERROR_NOT_FOUND, "assetId", f.carol, "getAssetProvenance", "nothing")
+
+	var provenance []ProvenanceEntry
+	decodeItems(t, f.mustInvoke(f.carol, "getAssetProvenance", assetId), &provenance)
+	if len(provenance) != 2 {
+		t.Fatalf("the provenance is %+v", provenance)
+	}
+	listed, sold := provenance[0], provenance[1]
+	if listed.OwnerEmail != f.alice.email || listed.SalePrice != nil || listed.Timestamp == nil ||
+		!listed.Timestamp.Equal(time.Date(2018, 10, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Fatalf("the first owner is %+v", listed)
+	}
+	if sold.OwnerEmail != f.bob.email || sold.SalePrice.String() != "150.00" || sold.Currency != DEFAULT_CURRENCY ||
+		len(sold.TxId) == 0 || !sold.Timestamp.After(*listed.Timestamp) {
+		t.Fatalf("the buyer is %+v", sold)
+	}
+
+	//the timestamp of a transaction is set by the client, a backdated one does not move the sale before the listing
+	assetKey, _ := getCompositeKey(f.stub, COMPOSITE_KEY_ASSET, assetId)
+	history := f.stub.history[assetKey]
+	backdated := *history[len(history)-1]
+	backdated.Timestamp = &timestamp.Timestamp{Seconds: time.Date(2018, 9, 1, 0, 0, 0, 0, time.UTC).Unix()}
+	history[len(history)-1] = &backdated
+	decodeItems(t, f.mustInvoke(f.carol, "getAssetProvenance", assetId), &provenance)
+	if len(provenance) != 2 || provenance[0].OwnerEmail != f.alice.email || provenance[1].OwnerEmail != f.bob.email {
+		t.Fatalf("a backdated sale reorders the provenance to %+v", provenance)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"encoding/json"
+	"reflect"
+)
+
+const (
+	RESPONSE_STATUS_OK = "OK"
+)
+
+/**
+The response of a successful invoke, an InvokeResponse with the entity the transaction created or updated and the events
+it raised. The events are emitted here, so an invoke hands its EventBatch over rather than emitting it itself. Both
+entity and events may be nil.
+ */
+func invokeSuccess(stub shim.ChaincodeStubInterface, entity interface{}, events *EventBatch) pb.Response {
+	raised := make([]ChaincodeEvent, 0)
+	if events != nil {
+		if err := events.emit(stub); err != nil {
+			return errorResponse(err)
+		}
+		raised = append(raised, events.events...)
+	}
+	responseBytes, err := json.Marshal(InvokeResponse{RESPONSE_STATUS_OK, stub.GetTxID(), entity, raised})
+	if err != nil {
+		return errorResponse(err)
+	}
+	return shim.Success(responseBytes)
+}
+
+/**
+The response of a query for a list, a ListResponse. items must be a slice, bookmark is empty when the list is complete.
+ */
+func listSuccess(items interface{}, bookmark string) pb.Response {
+	value := reflect.ValueOf(items)
+	if value.IsNil() {
+		//an empty list, not null
+		items = reflect.MakeSlice(value.Type(), 0, 0).Interface()
+	}
+	responseBytes, err := json.Marshal(ListResponse{items, bookmark, value.Len()})
+	if err != nil {
+		return errorResponse(err)
+	}
+	return shim.Success(responseBytes)
+}
+
+/**
+The response of a query for a single document, which is the document itself.
+ */
+func querySuccess(entity interface{}) pb.Response {
+	entityBytes, err := json.Marshal(entity)
+	if err != nil {
+		return errorResponse(err)
+	}
+	return shim.Success(entityBytes)
+}
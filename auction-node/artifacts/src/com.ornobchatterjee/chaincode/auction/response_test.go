@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestInvokeResponse(t *testing.T) {
+	f := newAuctionFixture(t)
+
+	var category Category
+	response := decodeEntity(t, f.mustInvoke(f.house, "addCategory", `{"categoryId":"art","name":"Art"}`), &category)
+	if len(response.TxId) == 0 || category.CategoryId != "art" {
+		t.Fatalf("addCategory returned %+v with %+v", response, category)
+	}
+	//no event raised is an empty list, not null
+	if payload := f.mustInvoke(f.house, "addCategory", `{"categoryId":"cars","name":"Cars"}`); !bytes.Contains(payload, []byte(`"events":[]`)) {
+		t.Fatalf("addCategory returned %s", payload)
+	}
+
+	assetId := f.addAsset(f.alice, "Vase", "100", time.Hour)
+	f.advance(90 * time.Minute)
+	var bid Bid
+	response = decodeEntity(t, f.placeBid(f.bob, assetId, "150").Payload, &bid)
+	if bid.BidAmount.Cmp(money(t, "150")) != 0 || bid.Asset.AssetId != assetId {
+		t.Fatalf("placeBid returned %+v", bid)
+	}
+	//the events in the response are the ones in the event of the transaction
+	if event := f.lastEvent(); len(response.Events) != 1 || !bytes.Equal(response.Events[0].Payload, event.Events[0].Payload) {
+		t.Fatalf("placeBid returned events %+v, the transaction raised %+v", response.Events, event.Events)
+	}
+
+	//nothing is left to return after a delete
+	f.mustInvoke(f.carol, "watchAsset", assetId)
+	if response = decodeEntity(t, f.mustInvoke(f.carol, "unwatchAsset", assetId), nil); response.Entity != nil {
+		t.Fatalf("unwatchAsset returned %+v", response)
+	}
+}
+
+func TestListResponse(t *testing.T) {
+	f := newAuctionFixture(t)
+	for _, name := range []string{"Vase", "Lamp", "Clock"} {
+		f.addAsset(f.alice, name, "100", time.Hour)
+	}
+
+	var assets []Asset
+	list := decodeItems(t, f.mustInvoke(f.bob, "searchAssets", `{"sortBy":"name","pageSize":2}`), &assets)
+	if list.Count != 2 || len(list.Bookmark) == 0 || assets[0].Name != "Clock" || assets[1].Name != "Lamp" {
+		t.Fatalf("first page is %+v with %v", list, assets)
+	}
+	search, _ := json.Marshal(AssetSearch{SortBy: "name", PageSize: 2, Bookmark: list.Bookmark})
+	list = decodeItems(t, f.mustInvoke(f.bob, "searchAssets", string(search)), &assets)
+	if list.Count != 1 || assets[0].Name != "Vase" {
+		t.Fatalf("second page is %+v with %v", list, assets)
+	}
+
+	//an empty list is an empty array
+	if payload := f.mustInvoke(f.bob, "getWatchedAssets"); !bytes.Contains(payload, []byte(`"items":[]`)) {
+		t.Fatalf("getWatchedAssets returned %s", payload)
+	}
+}
+
+func TestStoredStateIsCompact(t *testing.T) {
+	f := newAuctionFixture(t)
+	assetId := f.addAsset(f.alice, "Vase", "100", time.Hour)
+	f.advance(90 * time.Minute)
+	f.placeBid(f.bob, assetId, "150")
+	f.advance(time.Hour)
+	f.getBidResult()
+
+	for key, value := range f.stub.State {
+		var compacted bytes.Buffer
+		if json.Compact(&compacted, value) != nil {
+			//index entries are not documents
+			continue
+		}
+		if !bytes.Equal(compacted.Bytes(), value) {
+			t.Fatalf("state of %q is not compact : %s", key, value)
+		}
+	}
+}
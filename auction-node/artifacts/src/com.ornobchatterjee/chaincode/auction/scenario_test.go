@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+/**
+Scenario runner. Every scenario is a JSON file that registers users, lists assets, places bids at given times and
+sweeps or closes the auctions, all against the chaincode in-process on the test stub. The report of settlements, final
+balances and owners is compared with the outcome the scenario expects. The runner only exists as this test:
+
+	go test -run TestScenarios -v
+	go test -run TestScenarios -v -args -scenario path/to/scenario.json -report /tmp/report.json
+
+See testdata/scenarios for the format.
+ */
+var (
+	scenarioPath = flag.String("scenario", filepath.Join("testdata", "scenarios"), "scenario file, or directory of scenario files")
+	reportPath   = flag.String("report", "", "file to write the scenario reports to as JSON")
+)
+
+type Scenario struct {
+	Name string `json:"name"`
+	//the clock starts here, every time in the scenario is an offset from it such as "90m"
+	Start       *time.Time      `json:"start,omitempty"`
+	UsersFile   string          `json:"usersFile,omitempty"`
+	Users       []ScenarioUser  `json:"users,omitempty"`
+	FeeSchedule json.RawMessage `json:"feeSchedule,omitempty"`
+	Categories  []Category      `json:"categories,omitempty"`
+	Steps       []ScenarioStep  `json:"steps"`
+	Expect      *ScenarioReport `json:"expect,omitempty"`
+}
+
+// ScenarioUser is an entry of users.json.
+type ScenarioUser struct {
+	UserId  string `json:"userId"`
+	Email   string `json:"email"`
+	Balance string `json:"balance"`
+	Phone   string `json:"phone,omitempty"`
+	Org     string `json:"org"`
+}
+
+// ScenarioStep is one transaction. Action is one of addAsset, bid, sweep,
+// close, extend or invoke. Assets are named by Ref, the chaincode assigns the ids.
+type ScenarioStep struct {
+	At          string          `json:"at,omitempty"`
+	As          string          `json:"as"`
+	Action      string          `json:"action"`
+	Ref         string          `json:"ref,omitempty"`
+	Asset       json.RawMessage `json:"asset,omitempty"`
+	Amount      string          `json:"amount,omitempty"`
+	PageSize    int             `json:"pageSize,omitempty"`
+	BidEnd      string          `json:"bidEnd,omitempty"`
+	Function    string          `json:"function,omitempty"`
+	Args        []string        `json:"args,omitempty"`
+	ExpectError string          `json:"expectError,omitempty"`
+}
+
+type ScenarioReport struct {
+	Name        string               `json:"name,omitempty"`
+	Settlements []ScenarioSettlement `json:"settlements"`
+	Balances    map[string]*Money    `json:"balances"`
+	Owners      map[string]string    `json:"owners"`
+}
+
+type ScenarioSettlement struct {
+	Asset        string `json:"asset"`
+	Seller       string `json:"seller,omitempty"`
+	Winner       string `json:"winner"`
+	WinningBid   *Money `json:"winningBid"`
+	PriceCharged *Money `json:"priceCharged,omitempty"`
+}
+
+func TestScenarios(t *testing.T) {
+	files := []string{*scenarioPath}
+	if info, err := os.Stat(*scenarioPath); err != nil {
+		t.Fatal(err)
+	} else if info.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(*scenarioPath, "*.json")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var reports []*ScenarioReport
+	for _, file := range files {
+		t.Run(strings.TrimSuffix(filepath.Base(file), ".json"), func(t *testing.T) {
+			scenario, err := loadScenario(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			report := runScenario(t, scenario)
+			reports = append(reports, report)
+			reportBytes, _ := json.MarshalIndent(report, "", "    ")
+			t.Logf("%s", reportBytes)
+			if scenario.Expect != nil {
+				compareScenarioReport(t, scenario.Expect, report)
+			}
+		})
+	}
+
+	if len(*reportPath) > 0 {
+		reportsBytes, err := json.MarshalIndent(reports, "", "    ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(*reportPath, reportsBytes, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+/**
+Read a scenario and the users file it refers to. The users file is relative to the scenario.
+ */
+func loadScenario(file string) (*Scenario, error) {
+	scenarioBytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var scenario Scenario
+	if err = json.Unmarshal(scenarioBytes, &scenario); err != nil {
+		return nil, fmt.Errorf("%v : %v", file, err)
+	}
+	if len(scenario.UsersFile) > 0 {
+		usersBytes, err := ioutil.ReadFile(filepath.Join(filepath.Dir(file), scenario.UsersFile))
+		if err != nil {
+			return nil, err
+		}
+		var users struct {
+			Users []ScenarioUser `json:"users"`
+		}
+		if err = json.Unmarshal(usersBytes, &users); err != nil {
+			return nil, fmt.Errorf("%v : %v", scenario.UsersFile, err)
+		}
+		scenario.Users = append(users.Users, scenario.Users...)
+	}
+	if len(scenario.Name) == 0 {
+		scenario.Name = strings.TrimSuffix(filepath.Base(file), ".json")
+	}
+	return &scenario, nil
+}
+
+func runScenario(t *testing.T, scenario *Scenario) *ScenarioReport {
+	l := newTestLedger(t)
+	if scenario.Start != nil {
+		l.now = scenario.Start.UTC()
+	}
+	start := l.now
+	offset := func(at string) time.Time {
+		if len(at) == 0 {
+			return l.now
+		}
+		d, err := time.ParseDuration(at)
+		if err != nil {
+			t.Fatalf("time %q is not an offset such as 90m : %v", at, err)
+		}
+		return start.Add(d)
+	}
+
+	identities := make(map[string]*testIdentity)
+	var house *testIdentity
+	for _, user := range scenario.Users {
+		identity := newTestIdentity(t, user.Email, user.Org)
+		identities[user.Email] = identity
+		if house == nil && user.Org == "Org2" {
+			house = identity
+		}
+		userBytes, _ := json.Marshal(map[string]string{"userId": user.UserId, "phone": user.Phone})
+		l.mustInvoke(identity, "addUser", string(userBytes))
+		l.approveUser(user.Email, user.Balance)
+	}
+	if house == nil {
+		t.Fatal("the scenario needs an auction house user of Org2")
+	}
+	if len(scenario.FeeSchedule) > 0 {
+		l.mustInvoke(house, "setFeeSchedule", string(scenario.FeeSchedule))
+	}
+	for _, category := range scenario.Categories {
+		categoryBytes, _ := json.Marshal(category)
+		l.mustInvoke(house, "addCategory", string(categoryBytes))
+	}
+
+	assetIds := make(map[string]string)
+	var refs []string
+	assetId := func(ref string) string {
+		if id, ok := assetIds[ref]; ok {
+			return id
+		}
+		//let the chaincode report the unknown asset
+		return ref
+	}
+	for i, step := range scenario.Steps {
+		at := offset(step.At)
+		if at.Before(l.now) {
+			t.Fatalf("step %v is at %v, before the step ahead of it", i+1, step.At)
+		}
+		l.now = at
+		identity, ok := identities[step.As]
+		if !ok {
+			t.Fatalf("step %v is run by %q who is not a user of the scenario", i+1, step.As)
+		}
+
+		var function string
+		var args []string
+		switch step.Action {
+		case "addAsset":
+			var asset map[string]interface{}
+			if err := json.Unmarshal(step.Asset, &asset); err != nil {
+				t.Fatalf("step %v : %v", i+1, err)
+			}
+			for _, field := range []string{"bidStart", "bidEnd"} {
+				if value, ok := asset[field].(string); ok {
+					asset[field] = offset(value).Format(time.RFC3339)
+				}
+			}
+			assetBytes, _ := json.Marshal(asset)
+			function, args = "addAssetForBid", []string{string(assetBytes)}
+		case "bid":
+			bidBytes, _ := json.Marshal(map[string]interface{}{
+				"asset":     map[string]string{"assetId": assetId(step.Ref)},
+				"bidAmount": step.Amount,
+				"bidTime":   l.now.Format(time.RFC3339),
+			})
+			function, args = "placeBid", []string{string(bidBytes), "-"}
+		case "sweep":
+			runScenarioSweep(t, l, identity, step, i+1)
+			continue
+		case "close":
+			function, args = "closeAuction", []string{l.now.Format(time.RFC3339), assetId(step.Ref)}
+		case "extend":
+			function, args = "extendAuction", []string{assetId(step.Ref), offset(step.BidEnd).Format(time.RFC3339)}
+		case "invoke":
+			function, args = step.Function, step.Args
+		default:
+			t.Fatalf("step %v has unknown action %q", i+1, step.Action)
+		}
+
+		response := l.invoke(identity, function, args...)
+		if !checkScenarioResponse(t, i+1, step, response.Status < 400, response.Message) {
+			continue
+		}
+		if step.Action == "addAsset" && response.Status < 400 {
+			var asset Asset
+			decodeEntity(t, response.Payload, &asset)
+			assetIds[step.Ref] = asset.AssetId
+			refs = append(refs, step.Ref)
+		}
+	}
+
+	report := &ScenarioReport{Name: scenario.Name, Settlements: make([]ScenarioSettlement, 0), Balances: make(map[string]*Money), Owners: make(map[string]string)}
+	for _, ref := range refs {
+		var settlements []Settlement
+		decodeItems(t, l.mustInvoke(house, "getSettlementsForAsset", assetIds[ref]), &settlements)
+		for _, settlement := range settlements {
+			report.Settlements = append(report.Settlements, ScenarioSettlement{ref, settlement.SellerEmail, settlement.WinnerEmail,
+				settlement.WinningBid, settlement.PriceCharged})
+		}
+		report.Owners[ref] = l.getAsset(assetIds[ref]).Owner.Email
+	}
+	for _, user := range scenario.Users {
+		report.Balances[user.Email] = l.getUser(house, user.Email).balance(DEFAULT_CURRENCY)
+	}
+	return report
+}
+
+/**
+Settle everything that has ended, page by page, the way the scheduler does.
+ */
+func runScenarioSweep(t *testing.T, l *testLedger, identity *testIdentity, step ScenarioStep, stepNumber int) {
+	pageSize := ""
+	if step.PageSize > 0 {
+		pageSize = fmt.Sprintf("%d", step.PageSize)
+	}
+	bookmark := ""
+	for {
+		response := l.invoke(identity, "getBidResult", l.now.Format(time.RFC3339), pageSize, bookmark)
+		if !checkScenarioResponse(t, stepNumber, step, response.Status < 400, response.Message) || response.Status >= 400 {
+			return
+		}
+		var result BatchResult
+		decodeEntity(t, response.Payload, &result)
+		if len(result.Bookmark) == 0 {
+			return
+		}
+		bookmark = result.Bookmark
+	}
+}
+
+// checkScenarioResponse reports a step whose outcome is not the expected one and returns whether it was.
+func checkScenarioResponse(t *testing.T, stepNumber int, step ScenarioStep, succeeded bool, message string) bool {
+	t.Helper()
+	switch {
+	case succeeded && len(step.ExpectError) > 0:
+		t.Errorf("step %v (%v as %v) succeeded, want error %q", stepNumber, step.Action, step.As, step.ExpectError)
+	case !succeeded && len(step.ExpectError) == 0:
+		t.Errorf("step %v (%v as %v) failed : %v", stepNumber, step.Action, step.As, message)
+	case !succeeded && !strings.Contains(message, step.ExpectError):
+		t.Errorf("step %v (%v as %v) failed with %q, want %q", stepNumber, step.Action, step.As, message, step.ExpectError)
+	default:
+		return true
+	}
+	return false
+}
+
+/**
+Compare the parts of the report the scenario has expectations for. Settlements are compared as a set keyed by asset.
+ */
+func compareScenarioReport(t *testing.T, expect *ScenarioReport, report *ScenarioReport) {
+	t.Helper()
+	if expect.Settlements != nil {
+		settled := make(map[string]ScenarioSettlement)
+		for _, settlement := range report.Settlements {
+			settled[settlement.Asset] = settlement
+		}
+		expected := make(map[string]bool)
+		for _, want := range expect.Settlements {
+			expected[want.Asset] = true
+			got, ok := settled[want.Asset]
+			if !ok {
+				t.Errorf("asset %v was not settled, want it sold to %v", want.Asset, want.Winner)
+				continue
+			}
+			if got.Winner != want.Winner || !sameAmount(got.WinningBid, want.WinningBid) ||
+				(len(want.Seller) > 0 && got.Seller != want.Seller) ||
+				(want.PriceCharged != nil && !sameAmount(got.PriceCharged, want.PriceCharged)) {
+				t.Errorf("asset %v settled as %+v, want %+v", want.Asset, describeSettlement(got), describeSettlement(want))
+			}
+		}
+		for _, got := range report.Settlements {
+			if !expected[got.Asset] {
+				t.Errorf("asset %v was settled unexpectedly : %+v", got.Asset, describeSettlement(got))
+			}
+		}
+	}
+
+	var emails []string
+	for email := range expect.Balances {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+	for _, email := range emails {
+		if got, want := report.Balances[email], expect.Balances[email]; !sameAmount(got, want) {
+			t.Errorf("balance of %v is %v, want %v", email, formatScenarioAmount(got), formatScenarioAmount(want))
+		}
+	}
+	for ref, want := range expect.Owners {
+		if got := report.Owners[ref]; got != want {
+			t.Errorf("asset %v is owned by %v, want %v", ref, got, want)
+		}
+	}
+}
+
+func sameAmount(a *Money, b *Money) bool {
+	return (a == nil) == (b == nil) && (a == nil || a.Cmp(b) == 0)
+}
+
+func formatScenarioAmount(amount *Money) string {
+	if amount == nil {
+		return "none"
+	}
+	return amount.String()
+}
+
+func describeSettlement(settlement ScenarioSettlement) string {
+	return fmt.Sprintf("{seller %v winner %v winningBid %v priceCharged %v}", settlement.Seller, settlement.Winner,
+		formatScenarioAmount(settlement.WinningBid), formatScenarioAmount(settlement.PriceCharged))
+}
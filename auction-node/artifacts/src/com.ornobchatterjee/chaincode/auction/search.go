@@ -0,0 +1,172 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var sortFields = map[string]string{
+	"bidEnd":   "bidEnd",
+	"bidStart": "bidStart",
+	"price":    "priceIndex",
+	"name":     "name",
+}
+
+/**
+Page through the asset catalogue. args[0] is an AssetSearch document. This is a read only query, so it can use the
+paginated rich query API.
+ */
+func (t *AuctionChaincode) searchAssets(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var search AssetSearch
+	err := decodeInput(args[0], &search)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if err = validateAssetSearch(&search); err != nil {
+		return errorResponse(err)
+	}
+
+	if search.PageSize == 0 {
+		search.PageSize = DEFAULT_PAGE_SIZE
+	}
+
+	query, err := getAssetSearchQuery(&search)
+	if err != nil {
+		return errorResponse(err)
+	}
+	t.Infof("[ searchAssets ] - query %v", query)
+
+	resultsIterator, metadata, err := stub.GetQueryResultWithPagination(query, search.PageSize, search.Bookmark)
+	if err != nil {
+		return errorResponse(err)
+	}
+	defer resultsIterator.Close()
+
+	assets := make([]Asset, 0)
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return errorResponse(err)
+		}
+		var assetObj Asset
+		if err = json.Unmarshal(queryResponse.Value, &assetObj); err != nil {
+			return errorResponse(err)
+		}
+		assets = append(assets, assetObj)
+	}
+	return listSuccess(assets, metadata.GetBookmark())
+}
+
+/**
+Translate an AssetSearch into a CouchDB query. Every value is added through the selector map, never spliced into the
+query string.
+ */
+func getAssetSearchQuery(search *AssetSearch) (string, error) {
+	selector := map[string]interface{}{
+		"docType": "Asset",
+	}
+	condition := func(field string, operator string, value interface{}) {
+		operators, ok := selector[field].(map[string]interface{})
+		if !ok {
+			operators = make(map[string]interface{})
+			selector[field] = operators
+		}
+		operators[operator] = value
+	}
+	timeString := func(value *time.Time) string {
+		return ledgerTime(*value)
+	}
+
+	filter := search.Filter
+	if filter == nil {
+		filter = new(AssetFilter)
+	}
+	if filter.MinPrice != nil {
+		condition("priceIndex", "$gte", filter.MinPrice.Float64())
+	}
+	if filter.MaxPrice != nil {
+		condition("priceIndex", "$lte", filter.MaxPrice.Float64())
+	}
+	//prices are only comparable within a currency; migrateLedger stores it on assets listed before currencies existed
+	if len(filter.Currency) > 0 {
+		selector["currency"] = filter.Currency
+	}
+	if len(filter.Seller) > 0 {
+		selector["owner.email"] = filter.Seller
+	}
+	if len(filter.Category) > 0 {
+		selector["category"] = filter.Category
+	}
+	if len(filter.Tag) > 0 {
+		selector["tags"] = map[string]interface{}{"$elemMatch": map[string]interface{}{"$eq": strings.ToLower(filter.Tag)}}
+	}
+	if filter.BidStartFrom != nil {
+		condition("bidStart", "$gte", timeString(filter.BidStartFrom))
+	}
+	if filter.BidEndTo != nil {
+		condition("bidEnd", "$lte", timeString(filter.BidEndTo))
+	}
+	if len(filter.Text) > 0 {
+		pattern := "(?i)" + regexp.QuoteMeta(filter.Text)
+		selector["$or"] = []interface{}{
+			map[string]interface{}{"name": map[string]interface{}{"$regex": pattern}},
+			map[string]interface{}{"description": map[string]interface{}{"$regex": pattern}},
+		}
+	}
+
+	switch filter.Status {
+	case "":
+	case "sold":
+		selector["isSold"] = true
+	case "unsold":
+		condition("isSold", "$ne", true)
+	case "upcoming", "open", "ended":
+		if filter.AsOf == nil {
+			return "", newError(ERROR_REQUIRED, "filter.asOf", "Status %v needs the asOf time", filter.Status)
+		}
+		asOf := timeString(filter.AsOf)
+		condition("isSold", "$ne", true)
+		switch filter.Status {
+		case "upcoming":
+			condition("bidStart", "$gt", asOf)
+		case "open":
+			condition("bidStart", "$lte", asOf)
+			condition("bidEnd", "$gt", asOf)
+		case "ended":
+			condition("bidEnd", "$lte", asOf)
+		}
+	default:
+		return "", newError(ERROR_INVALID_FORMAT, "filter.status", "Unknown status %v", filter.Status)
+	}
+
+	sortBy := search.SortBy
+	if len(sortBy) == 0 {
+		sortBy = "bidEnd"
+	}
+	sortField, ok := sortFields[sortBy]
+	if !ok {
+		return "", newError(ERROR_INVALID_FORMAT, "sortBy", "Assets can only be sorted by bidEnd, bidStart, price or name")
+	}
+	direction := "asc"
+	if search.SortDesc {
+		direction = "desc"
+	}
+	//CouchDB only sorts on an index when the selector constrains the sort field
+	if _, constrained := selector[sortField]; !constrained {
+		condition(sortField, "$gt", nil)
+	}
+
+	query := map[string]interface{}{
+		"selector": selector,
+		"sort":     []interface{}{map[string]string{"docType": direction}, map[string]string{sortField: direction}},
+	}
+	queryBytes, err := json.Marshal(query)
+	if err != nil {
+		return "", err
+	}
+	return string(queryBytes), nil
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+/**
+Write the settlement receipt together with its buyer and seller index entries. A settlement can only be written once.
+ */
+func recordSettlement(stub shim.ChaincodeStubInterface, settlement *Settlement) error {
+	settlementKey, err := getCompositeKey(stub, COMPOSITE_KEY_SETTLEMENT_ASSET, settlement.AssetId, settlement.SellerEmail)
+	if err != nil {
+		return err
+	}
+	existing, err := stub.GetState(settlementKey)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("Settlement for asset %v is already recorded", settlement.AssetId)
+	}
+
+	settlement.TxId = stub.GetTxID()
+	settlement.Timestamp, err = getTxTime(stub)
+	if err != nil {
+		return err
+	}
+	settlement.DocType = reflect.TypeOf(*settlement).Name()
+	settlementBytes, err := json.Marshal(settlement)
+	if err != nil {
+		return err
+	}
+	if err = stub.PutState(settlementKey, []byte(settlementBytes)); err != nil {
+		return err
+	}
+
+	//index entries only carry the key parts needed to rebuild the settlement key
+	buyerKey, err := getCompositeKey(stub, COMPOSITE_KEY_BUYER_SETTLEMENT, settlement.WinnerEmail, settlement.AssetId, settlement.SellerEmail)
+	if err != nil {
+		return err
+	}
+	if err = stub.PutState(buyerKey, []byte{0x00}); err != nil {
+		return err
+	}
+	sellerKey, err := getCompositeKey(stub, COMPOSITE_KEY_SELLER_SETTLEMENT, settlement.SellerEmail, settlement.AssetId)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(sellerKey, []byte{0x00})
+}
+
+func (t *AuctionChaincode) getSettlementsForAsset(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	assetId := args[0]
+	if len(assetId) == 0 {
+		return errorResponse(newError(ERROR_REQUIRED, "assetId", "Asset ID is mandatory"))
+	}
+	settlementsIterator, err := stub.GetStateByPartialCompositeKey(COMPOSITE_KEY_SETTLEMENT_ASSET, []string{assetId})
+	if err != nil {
+		return errorResponse(err)
+	}
+	defer settlementsIterator.Close()
+
+	var settlements = make([]Settlement, 0)
+	for settlementsIterator.HasNext() {
+		responseRange, err := settlementsIterator.Next()
+		if err != nil {
+			return errorResponse(err)
+		}
+		var settlement Settlement
+		if err = json.Unmarshal(responseRange.Value, &settlement); err != nil {
+			return errorResponse(err)
+		}
+		settlements = append(settlements, settlement)
+	}
+	return listSuccess(settlements, "")
+}
+
+func (t *AuctionChaincode) getSettlementsForBuyer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return t.getIndexedSettlements(stub, COMPOSITE_KEY_BUYER_SETTLEMENT, args)
+}
+
+func (t *AuctionChaincode) getSettlementsForSeller(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return t.getIndexedSettlements(stub, COMPOSITE_KEY_SELLER_SETTLEMENT, args)
+}
+
+/**
+List the settlements of a buyer or seller. General users can only see their own settlements, the auction house can query anyone.
+ */
+func (t *AuctionChaincode) getIndexedSettlements(stub shim.ChaincodeStubInterface, indexName string, args []string) pb.Response {
+	user, err := getUserByEmail(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	email := user.Email
+	if len(args) == 1 && args[0] != email {
+		org, _ := getMSPAttr(stub, MSP_ATTRIBUTE_ORG)
+		if org != "Org2" {
+			return unauthorized("Only Auction house users are allowed to query settlements of other users")
+		}
+		email = args[0]
+	}
+
+	indexIterator, err := stub.GetStateByPartialCompositeKey(indexName, []string{email})
+	if err != nil {
+		return errorResponse(err)
+	}
+	defer indexIterator.Close()
+
+	var settlements = make([]Settlement, 0)
+	for indexIterator.HasNext() {
+		responseRange, err := indexIterator.Next()
+		if err != nil {
+			return errorResponse(err)
+		}
+		_, keyParts, err := stub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return errorResponse(err)
+		}
+		//buyer~settlement is {buyer}{asset}{seller}, seller~settlement is {seller}{asset}
+		sellerEmail := keyParts[0]
+		if indexName == COMPOSITE_KEY_BUYER_SETTLEMENT {
+			sellerEmail = keyParts[2]
+		}
+		settlement, err := getSettlement(stub, keyParts[1], sellerEmail)
+		if err != nil {
+			return errorResponse(err)
+		}
+		settlements = append(settlements, *settlement)
+	}
+	return listSuccess(settlements, "")
+}
+
+func getSettlement(stub shim.ChaincodeStubInterface, assetId string, sellerEmail string) (*Settlement, error) {
+	settlementKey, err := getCompositeKey(stub, COMPOSITE_KEY_SETTLEMENT_ASSET, assetId, sellerEmail)
+	if err != nil {
+		return nil, err
+	}
+	settlementBytes, err := stub.GetState(settlementKey)
+	if err != nil {
+		return nil, err
+	}
+	if settlementBytes == nil {
+		return nil, errors.New("settlement not found for asset " + assetId)
+	}
+	var settlement Settlement
+	if err = json.Unmarshal(settlementBytes, &settlement); err != nil {
+		return nil, err
+	}
+	return &settlement, nil
+}
+
+/**
+Remember why an asset could not be settled. The record is only rewritten when the reason changes so that repeated sweeps do not keep writing the same key.
+ */
+func recordFailedClosure(stub shim.ChaincodeStubInterface, sellerEmail string, closureErr *ClosureError) error {
+	failureKey, err := getCompositeKey(stub, COMPOSITE_KEY_FAILED_CLOSURE, closureErr.AssetId, sellerEmail)
+	if err != nil {
+		return err
+	}
+	existingBytes, err := stub.GetState(failureKey)
+	if err != nil {
+		return err
+	}
+	if existingBytes != nil {
+		var existing FailedClosure
+		if err = json.Unmarshal(existingBytes, &existing); err != nil {
+			return err
+		}
+		if existing.Reason == closureErr.Reason {
+			return nil
+		}
+	}
+
+	failure := FailedClosure{
+		AssetId:     closureErr.AssetId,
+		SellerEmail: sellerEmail,
+		Reason:      closureErr.Reason,
+		TxId:        stub.GetTxID(),
+	}
+	failure.Timestamp, err = getTxTime(stub)
+	if err != nil {
+		return err
+	}
+	failure.DocType = reflect.TypeOf(failure).Name()
+	failureBytes, err := json.Marshal(failure)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(failureKey, []byte(failureBytes))
+}
+
+func clearFailedClosure(stub shim.ChaincodeStubInterface, assetId string, sellerEmail string) error {
+	failureKey, err := getCompositeKey(stub, COMPOSITE_KEY_FAILED_CLOSURE, assetId, sellerEmail)
+	if err != nil {
+		return err
+	}
+	failureBytes, err := stub.GetState(failureKey)
+	if err != nil || failureBytes == nil {
+		return err
+	}
+	return stub.DelState(failureKey)
+}
+
+/**
+Walk users, assets and settlements and report every broken balance or ownership invariant. Read only, meant to be run as a query by the auction house.
+ */
+func (t *AuctionChaincode) checkConsistency(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	org, _ := getMSPAttr(stub, MSP_ATTRIBUTE_ORG)
+	if org != "Org2" {
+		return unauthorized("Only Auction house users are allowed to invoke this function")
+	}
+
+	report := ConsistencyReport{Violations: make([]string, 0)}
+	violation := func(format string, a ...interface{}) {
+		report.Violations = append(report.Violations, fmt.Sprintf(format, a...))
+	}
+
+	//every user has a non negative balance and is stored under its own email
+	users := make(map[string]bool)
+	balances := make(map[string]map[string]*Money)
+	held := make(map[string]map[string]*Money)
+	var userEmails []string
+	usersIterator, err := stub.GetStateByPartialCompositeKey(USER_KEY, []string{})
+	if err != nil {
+		return errorResponse(err)
+	}
+	defer usersIterator.Close()
+	for usersIterator.HasNext() {
+		responseRange, err := usersIterator.Next()
+		if err != nil {
+			return errorResponse(err)
+		}
+		_, keyParts, err := stub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return errorResponse(err)
+		}
+		var user User
+		if err = json.Unmarshal(responseRange.Value, &user); err != nil {
+			violation("user %v cannot be read : %v", keyParts[0], err.Error())
+			continue
+		}
+		report.Users++
+		users[keyParts[0]] = true
+		if user.Email != keyParts[0] {
+			violation("user stored under %v has email %v", keyParts[0], user.Email)
+		}
+		for _, currency := range sortedCurrencies(user.Balances) {
+			if balance := user.Balances[currency]; balance == nil || balance.Sign() < 0 || !balance.fitsScale(currencyScale(currency)) {
+				violation("user %v has invalid %v balance %v", keyParts[0], currency, balance)
+			}
+		}
+		for _, currency := range sortedCurrencies(user.Held) {
+			if held := user.Held[currency]; held == nil || held.Sign() < 0 {
+				violation("user %v has invalid %v held %v", keyParts[0], currency, held)
+			}
+		}
+		balances[keyParts[0]] = user.Balances
+		held[keyParts[0]] = user.Held
+		userEmails = append(userEmails, keyParts[0])
+	}
+
+	//the journal of every user adds up to their balance and what they have held in every currency
+	journalBalances := make(map[string]map[string]*Money)
+	journalHeld := make(map[string]map[string]*Money)
+	var journalEmails []string
+	journalIterator, err := stub.GetStateByPartialCompositeKey(COMPOSITE_KEY_JOURNAL, []string{})
+	if err != nil {
+		return errorResponse(err)
+	}
+	defer journalIterator.Close()
+	for journalIterator.HasNext() {
+		responseRange, err := journalIterator.Next()
+		if err != nil {
+			return errorResponse(err)
+		}
+		var entry JournalEntry
+		if err = json.Unmarshal(responseRange.Value, &entry); err != nil || entry.Amount == nil {
+			violation("journal entry %v cannot be read", responseRange.Key)
+			continue
+		}
+		if journalBalances[entry.Email] == nil {
+			journalBalances[entry.Email] = make(map[string]*Money)
+			journalHeld[entry.Email] = make(map[string]*Money)
+			journalEmails = append(journalEmails, entry.Email)
+		}
+		currency := currencyOf(entry.Currency)
+		sums := journalBalances[entry.Email]
+		if entry.Type == JOURNAL_HOLD || entry.Type == JOURNAL_RELEASE {
+			sums = journalHeld[entry.Email]
+		}
+		if sums[currency] == nil {
+			sums[currency] = zeroMoney(currency)
+		}
+		sums[currency] = sums[currency].Add(entry.Amount)
+	}
+	for _, email := range journalEmails {
+		if !users[email] {
+			violation("journal of %v belongs to no registered user", email)
+		}
+	}
+	for _, email := range userEmails {
+		for _, currency := range sortedCurrencies(balances[email], journalBalances[email]) {
+			balance, journalBalance := balances[email][currency], journalBalances[email][currency]
+			if journalBalance == nil {
+				journalBalance = zeroMoney(currency)
+			}
+			if balance == nil {
+				balance = zeroMoney(currency)
+			}
+			if balance.Cmp(journalBalance) != 0 {
+				violation("user %v has %v balance %v but their journal adds up to %v", email, currency, balance, journalBalance)
+			}
+		}
+		for _, currency := range sortedCurrencies(held[email], journalHeld[email]) {
+			userHeld, heldInJournal := held[email][currency], journalHeld[email][currency]
+			if heldInJournal == nil {
+				heldInJournal = zeroMoney(currency)
+			}
+			if userHeld == nil {
+				userHeld = zeroMoney(currency)
+			}
+			if userHeld.Cmp(heldInJournal) != 0 {
+				violation("user %v has %v %v held but their journal holds %v", email, userHeld, currency, heldInJournal)
+			}
+		}
+	}
+
+	//the owner index points every asset at exactly one owner
+	owners := make(map[string][]string)
+	ownersIterator, err := stub.GetStateByPartialCompositeKey(COMPOSITE_KEY_OWNER_ASSET, []string{})
+	if err != nil {
+		return errorResponse(err)
+	}
+	defer ownersIterator.Close()
+	for ownersIterator.HasNext() {
+		responseRange, err := ownersIterator.Next()
+		if err != nil {
+			return errorResponse(err)
+		}
+		_, keyParts, err := stub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return errorResponse(err)
+		}
+		owners[keyParts[1]] = append(owners[keyParts[1]], keyParts[0])
+	}
+
+	//every asset belongs to a registered owner and every sold asset has a settlement for its owner
+	assetsIterator, err := stub.GetStateByPartialCompositeKey(COMPOSITE_KEY_ASSET, []string{})
+	if err != nil {
+		return errorResponse(err)
+	}
+	defer assetsIterator.Close()
+	for assetsIterator.HasNext() {
+		responseRange, err := assetsIterator.Next()
+		if err != nil {
+			return errorResponse(err)
+		}
+		_, keyParts, err := stub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return errorResponse(err)
+		}
+		assetId := keyParts[0]
+		var asset Asset
+		if err = json.Unmarshal(responseRange.Value, &asset); err != nil {
+			violation("asset %v cannot be read : %v", assetId, err.Error())
+			continue
+		}
+		report.Assets++
+		if asset.AssetId != assetId || asset.Owner == nil {
+			violation("asset stored under %v does not match its document", assetId)
+			continue
+		}
+		ownerEmail := asset.Owner.Email
+		if len(owners[assetId]) != 1 || owners[assetId][0] != ownerEmail {
+			violation("asset %v of %v is indexed under owners %v", assetId, ownerEmail, owners[assetId])
+		}
+		delete(owners, assetId)
+		if !users[ownerEmail] {
+			violation("asset %v is owned by unregistered user %v", assetId, ownerEmail)
+		}
+		if asset.IsSold {
+			settlementsIterator, err := stub.GetStateByPartialCompositeKey(COMPOSITE_KEY_BUYER_SETTLEMENT, []string{ownerEmail, assetId})
+			if err != nil {
+				return errorResponse(err)
+			}
+			if !settlementsIterator.HasNext() {
+				violation("sold asset %v of %v has no settlement", assetId, ownerEmail)
+			}
+			settlementsIterator.Close()
+		}
+	}
+	for assetId, assetOwners := range owners {
+		violation("owners %v are indexed for missing asset %v", assetOwners, assetId)
+	}
+
+	//every settlement moved the asset to the winner and its amounts add up
+	settlementsIterator, err := stub.GetStateByPartialCompositeKey(COMPOSITE_KEY_SETTLEMENT_ASSET, []string{})
+	if err != nil {
+		return errorResponse(err)
+	}
+	defer settlementsIterator.Close()
+	for settlementsIterator.HasNext() {
+		responseRange, err := settlementsIterator.Next()
+		if err != nil {
+			return errorResponse(err)
+		}
+		var settlement Settlement
+		if err = json.Unmarshal(responseRange.Value, &settlement); err != nil {
+			violation("settlement %v cannot be read : %v", responseRange.Key, err.Error())
+			continue
+		}
+		report.Settlements++
+
+		settledAsset, err := getAsset(stub, settlement.AssetId)
+		if err != nil {
+			return errorResponse(err)
+		}
+		if settledAsset == nil || !settledAsset.IsSold || settledAsset.Owner == nil || settledAsset.Owner.Email != settlement.WinnerEmail {
+			violation("settled asset %v is not owned by winner %v", settlement.AssetId, settlement.WinnerEmail)
+		}
+
+		fees := settlement.Fees
+		if fees == nil || fees.HammerPrice == nil || fees.BuyerPremium == nil || fees.SellerCommission == nil ||
+			fees.BuyerTotal == nil || fees.SellerProceeds == nil {
+			violation("settlement of asset %v has no fee breakdown", settlement.AssetId)
+			continue
+		}
+		if fees.HammerPrice.Add(fees.BuyerPremium).Cmp(fees.BuyerTotal) != 0 {
+			violation("settlement of asset %v charged %v for hammer price %v and premium %v", settlement.AssetId, fees.BuyerTotal, fees.HammerPrice, fees.BuyerPremium)
+		}
+		if fees.HammerPrice.Sub(fees.SellerCommission).Cmp(fees.SellerProceeds) != 0 {
+			violation("settlement of asset %v paid out %v for hammer price %v and commission %v", settlement.AssetId, fees.SellerProceeds, fees.HammerPrice, fees.SellerCommission)
+		}
+	}
+
+	return querySuccess(report)
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Replay a failure with go test -run TestSettlementProperties -args -seed <seed>
+var (
+	propertySeed = flag.Int64("seed", 0, "seed of the settlement property test, random when 0")
+	propertyRuns = flag.Int("runs", 20, "number of ledgers the settlement property test generates")
+)
+
+// propertyModel is what the test expects of the ledger: the bids the chaincode
+// accepted for each listed asset, the balance of every user and the fee rates.
+// Amounts are in cents and rates in hundredths of a percent, so the model
+// works the outcome of a sweep out without the chaincode's Money or ranking.
+type propertyModel struct {
+	users         []*testIdentity
+	assets        []string
+	bids          map[string]map[string]int64
+	balances      map[string]int64
+	premiumPct    int64
+	commissionPct int64
+	failed        map[string]bool
+	total         *Money
+}
+
+func TestSettlementProperties(t *testing.T) {
+	seed := *propertySeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	for run := 0; run < *propertyRuns; run++ {
+		runSeed := seed + int64(run)
+		t.Run(fmt.Sprintf("seed=%v", runSeed), func(t *testing.T) {
+			runSettlementProperties(t, rand.New(rand.NewSource(runSeed)))
+		})
+	}
+}
+
+/**
+Generate users, a fee schedule, assets and bids, sweep the ended auctions with getBidResult at random page sizes and
+check the invariants after every sweep.
+ */
+func runSettlementProperties(t *testing.T, random *rand.Rand) {
+	l := newTestLedger(t)
+	model := &propertyModel{bids: make(map[string]map[string]int64), balances: make(map[string]int64), failed: make(map[string]bool)}
+	amount := func(maxCents int) int64 {
+		return int64(random.Intn(maxCents) + 1)
+	}
+
+	house := newTestIdentity(t, "house@example.com", "Org2")
+	model.balances[house.email] = amount(100000)
+	l.addUser(house, formatCents(model.balances[house.email]))
+	model.users = append(model.users, house)
+	for i, count := 0, 2+random.Intn(5); i < count; i++ {
+		user := newTestIdentity(t, fmt.Sprintf("user%02d@example.com", i), "Org1")
+		model.balances[user.email] = amount(200000)
+		l.addUser(user, formatCents(model.balances[user.email]))
+		model.users = append(model.users, user)
+	}
+	if random.Intn(4) > 0 {
+		model.premiumPct, model.commissionPct = amount(2500), amount(2500)
+		l.mustInvoke(house, "setFeeSchedule", fmt.Sprintf(`{"buyerPremiumPct":%q,"sellerCommissionPct":%q,"houseAccountEmail":%q}`,
+			formatCents(model.premiumPct), formatCents(model.commissionPct), house.email))
+	}
+	model.total = sumBalances(t, l)
+
+	for round, rounds := 0, 1+random.Intn(4); round < rounds; round++ {
+		for i, count := 0, 1+random.Intn(6); i < count; i++ {
+			seller := model.users[1+random.Intn(len(model.users)-1)]
+			assetId := l.addAsset(seller, fmt.Sprintf("Lot %v-%v", round, i), formatCents(amount(50000)), time.Duration(1+random.Intn(180))*time.Minute)
+			model.assets = append(model.assets, assetId)
+			model.bids[assetId] = make(map[string]int64)
+		}
+
+		for i, count := 0, random.Intn(30); i < count; i++ {
+			bidder := model.users[1+random.Intn(len(model.users)-1)]
+			assetId := model.assets[random.Intn(len(model.assets))]
+			//a small range of amounts so that equal bids happen
+			bidAmount := amount(60000)
+			if random.Intn(3) == 0 {
+				bidAmount = int64(10000 * (1 + random.Intn(5)))
+			}
+			if response := l.placeBid(bidder, assetId, formatCents(bidAmount)); response.Status < 400 {
+				model.bids[assetId][bidder.email] = bidAmount
+			}
+			l.advance(time.Duration(random.Intn(20)) * time.Minute)
+		}
+
+		l.advance(time.Duration(random.Intn(240)) * time.Minute)
+		winners := model.sweep(t, l)
+		pageSize := fmt.Sprintf("%d", 1+random.Intn(4))
+		bookmark := ""
+		for {
+			var result BatchResult
+			decodeEntity(t, l.mustInvoke(house, "getBidResult", l.now.Format(time.RFC3339), pageSize, bookmark), &result)
+			swept := len(result.Bookmark) == 0
+			checkSettlementInvariants(t, l, model)
+			if swept {
+				break
+			}
+			bookmark = result.Bookmark
+		}
+		checkSweep(t, l, model, winners)
+	}
+}
+
+/**
+Close the ended auctions of the model the way a sweep should: in the order of their end of bidding and asset id, each
+to the highest bidder who can pay the bid and the premium, the earlier email first among equal bids. Returns the
+winner of every asset the sweep should settle, an empty winner for a closure that should fail.
+ */
+func (model *propertyModel) sweep(t *testing.T, l *testLedger) map[string]string {
+	t.Helper()
+	var closable []*Asset
+	for _, assetId := range model.assets {
+		asset := l.getAsset(assetId)
+		if !asset.IsSold && !model.failed[assetId] && len(model.bids[assetId]) > 0 && asset.BidEnd.Before(l.now) {
+			closable = append(closable, asset)
+		}
+	}
+	sort.Slice(closable, func(i, j int) bool {
+		if !closable[i].BidEnd.Equal(*closable[j].BidEnd) {
+			return closable[i].BidEnd.Before(*closable[j].BidEnd)
+		}
+		return closable[i].AssetId < closable[j].AssetId
+	})
+
+	winners := make(map[string]string)
+	for _, asset := range closable {
+		bids := model.bids[asset.AssetId]
+		var bidders []string
+		for email := range bids {
+			bidders = append(bidders, email)
+		}
+		sort.Slice(bidders, func(i, j int) bool {
+			if bids[bidders[i]] != bids[bidders[j]] {
+				return bids[bidders[i]] > bids[bidders[j]]
+			}
+			return bidders[i] < bidders[j]
+		})
+		winners[asset.AssetId] = ""
+		for _, bidder := range bidders {
+			bid := bids[bidder]
+			premium, commission := percentOfCents(bid, model.premiumPct), percentOfCents(bid, model.commissionPct)
+			if model.balances[bidder] < bid+premium {
+				continue
+			}
+			winners[asset.AssetId] = bidder
+			model.balances[bidder] -= bid + premium
+			model.balances[asset.Owner.Email] += bid - commission
+			model.balances[model.users[0].email] += premium + commission
+			break
+		}
+		if len(winners[asset.AssetId]) == 0 {
+			model.failed[asset.AssetId] = true
+		}
+	}
+	return winners
+}
+
+/**
+Check the ledger after a complete sweep against the outcome the model worked out.
+ */
+func checkSweep(t *testing.T, l *testLedger, model *propertyModel, winners map[string]string) {
+	t.Helper()
+	for assetId, winner := range winners {
+		asset := l.getAsset(assetId)
+		if len(winner) == 0 {
+			failureKey, _ := getCompositeKey(l.stub, COMPOSITE_KEY_FAILED_CLOSURE, assetId, asset.Owner.Email)
+			if asset.IsSold || l.stub.State[failureKey] == nil {
+				t.Fatalf("no bidder on asset %v can pay, but it went to %v (sold %v) without a failed closure", assetId,
+					asset.Owner.Email, asset.IsSold)
+			}
+			continue
+		}
+		if !asset.IsSold || asset.Owner.Email != winner || asset.SoldPrice.String() != formatCents(model.bids[assetId][winner]) {
+			t.Fatalf("asset %v should have gone to %v for %v, it is owned by %v (sold %v for %v)", assetId, winner,
+				formatCents(model.bids[assetId][winner]), asset.Owner.Email, asset.IsSold, asset.SoldPrice)
+		}
+	}
+	for _, user := range model.users {
+		if balance := l.getUser(model.users[0], user.email).balance(DEFAULT_CURRENCY); balance.String() != formatCents(model.balances[user.email]) {
+			t.Fatalf("balance of %v is %v, want %v", user.email, balance, formatCents(model.balances[user.email]))
+		}
+	}
+}
+
+/**
+Check the invariants that hold after every page of a sweep.
+ */
+func checkSettlementInvariants(t *testing.T, l *testLedger, model *propertyModel) {
+	t.Helper()
+	if total := sumBalances(t, l); total.Cmp(model.total) != 0 {
+		t.Fatalf("balances add up to %v, want %v", total, model.total)
+	}
+
+	ownerKeys := make(map[string][]string)
+	iterator, err := l.stub.GetStateByPartialCompositeKey(COMPOSITE_KEY_OWNER_ASSET, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer iterator.Close()
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, keyParts, err := l.stub.SplitCompositeKey(kv.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ownerKeys[keyParts[1]] = append(ownerKeys[keyParts[1]], keyParts[0])
+	}
+
+	for _, assetId := range model.assets {
+		asset := l.getAsset(assetId)
+		if owners := ownerKeys[assetId]; len(owners) != 1 || owners[0] != asset.Owner.Email {
+			t.Fatalf("asset %v is owned by %v but has owner keys %v", assetId, asset.Owner.Email, owners)
+		}
+
+	}
+}
+
+/**
+pct hundredths of a percent of cents, rounded half up to the cent.
+ */
+func percentOfCents(cents int64, pct int64) int64 {
+	return (2*cents*pct + 10000) / 20000
+}
+
+func formatCents(cents int64) string {
+	return fmt.Sprintf("%d.%02d", cents/100, cents%100)
+}
+
+func sumBalances(t *testing.T, l *testLedger) *Money {
+	t.Helper()
+	total := zeroMoney(DEFAULT_CURRENCY)
+	iterator, err := l.stub.GetStateByPartialCompositeKey(USER_KEY, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer iterator.Close()
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var user User
+		if err = json.Unmarshal(kv.Value, &user); err != nil {
+			t.Fatal(err)
+		}
+		balance := user.balance(DEFAULT_CURRENCY)
+		if balance.Sign() < 0 {
+			t.Fatalf("balance of %v is %v", user.Email, balance)
+		}
+		total = total.Add(balance)
+	}
+	return total
+}
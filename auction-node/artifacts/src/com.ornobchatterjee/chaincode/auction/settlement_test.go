@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetSettlementsForBuyerAndSeller(t *testing.T) {
+	f := newAuctionFixture(t)
+	first := f.addAsset(f.alice, "Vase", "100", time.Hour)
+	second := f.addAsset(f.alice, "Lamp", "100", time.Hour)
+	third := f.addAsset(f.carol, "Kite", "100", time.Hour)
+	f.advance(90 * time.Minute)
+	for _, bid := range []struct {
+		bidder  *testIdentity
+		assetId string
+		amount  string
+	}{{f.bob, first, "110"}, {f.carol, second, "120"}, {f.bob, third, "130"}} {
+		if response := f.placeBid(bid.bidder, bid.assetId, bid.amount); response.Status != 200 {
+			t.Fatalf("bid failed : %v", response.Message)
+		}
+	}
+	f.advance(time.Hour)
+	if result := f.getBidResult(); result.Settled != 3 {
+		t.Fatalf("expected three settlements, got %+v", result)
+	}
+
+	//each settlement as asset:seller>winner@price
+	list := func(identity *testIdentity, function string, args ...string) string {
+		t.Helper()
+		var settlements []Settlement
+		decodeItems(t, f.mustInvoke(identity, function, args...), &settlements)
+		var summary []string
+		for _, settlement := range settlements {
+			summary = append(summary, settlement.AssetId+":"+strings.Split(settlement.SellerEmail, "@")[0]+">"+
+				strings.Split(settlement.WinnerEmail, "@")[0]+"@"+settlement.WinningBid.String())
+		}
+		return strings.Join(summary, " ")
+	}
+	for _, c := range []struct {
+		identity *testIdentity
+		function string
+		args     []string
+		want     string
+	}{
+		{f.bob, "getSettlementsForBuyer", nil, first + ":alice>bob@110.00 " + third + ":carol>bob@130.00"},
+		{f.bob, "getSettlementsForBuyer", []string{f.bob.email}, first + ":alice>bob@110.00 " + third + ":carol>bob@130.00"},
+		{f.house, "getSettlementsForBuyer", []string{f.carol.email}, second + ":alice>carol@120.00"},
+		{f.alice, "getSettlementsForBuyer", nil, ""},
+		{f.alice, "getSettlementsForSeller", nil, first + ":alice>bob@110.00 " + second + ":alice>carol@120.00"},
+		{f.house, "getSettlementsForSeller", []string{f.carol.email}, third + ":carol>bob@130.00"},
+	} {
+		if got := list(c.identity, c.function, c.args...); got != c.want {
+			t.Errorf("%v(%v) as %v is %q, want %q", c.function, c.args, c.identity.email, got, c.want)
+		}
+	}
+
+	f.expectErrorCode(ERROR_UNAUTHORIZED, "", f.bob, "getSettlementsForBuyer", f.carol.email)
+	f.expectErrorCode(ERROR_UNAUTHORIZED, "", f.bob, "getSettlementsForSeller", f.alice.email)
+	f.expectError("user not registered", newTestIdentity(t, "dave@example.com", "Org1"), "getSettlementsForBuyer")
+}
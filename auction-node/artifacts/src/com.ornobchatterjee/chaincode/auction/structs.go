@@ -1,18 +1,81 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"math/big"
 	"time"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 )
 
+// User holds a balance per currency code. A currency the user never held is
+// a zero balance. Held is the part of the balance set aside for the bids of
+// the user that lead, per currency code.
 type User struct {
-	UserId       string   `json:"userId,omitempty"`
-	Email        string   `json:"email,omitempty"`
-	Phone        string   `json:"phone,omitempty"`
-	Balance      *big.Rat `json:"balance,omitempty"`
-	Organization string   `json:"org,omitempty"`
-	DocType      string   `json:"docType,omitempty"`
+	UserId       string            `json:"userId,omitempty"`
+	Email        string            `json:"email,omitempty"`
+	Phone        string            `json:"phone,omitempty"`
+	Balances     map[string]*Money `json:"balances,omitempty"`
+	Held         map[string]*Money `json:"held,omitempty"`
+	Organization string            `json:"org,omitempty"`
+	Status       string            `json:"status,omitempty"`
+	CreditLimits map[string]*Money `json:"creditLimits,omitempty"`
+	ApprovedBy   string            `json:"approvedBy,omitempty"`
+	ApprovedAt   *time.Time        `json:"approvedAt,omitempty"`
+	DocType      string            `json:"docType,omitempty"`
+}
+
+/**
+Read a user. Users stored before balances were kept per currency have a single balance, which was in dollars. Amounts
+are moved to the scale of their currency, see Money.UnmarshalText.
+ */
+func (u *User) UnmarshalJSON(data []byte) error {
+	type storedUser User
+	stored := struct {
+		*storedUser
+		Balance *Money `json:"balance,omitempty"`
+	}{storedUser: (*storedUser)(u)}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	if stored.Balance != nil && u.Balances[DEFAULT_CURRENCY] == nil {
+		if u.Balances == nil {
+			u.Balances = make(map[string]*Money)
+		}
+		u.Balances[DEFAULT_CURRENCY] = stored.Balance
+	}
+	for _, currency := range sortedCurrencies(u.Balances) {
+		if err := checkAmount("balances."+currency, u.Balances[currency], currency); err != nil {
+			return err
+		}
+	}
+	for _, currency := range sortedCurrencies(u.Held) {
+		if err := checkAmount("held."+currency, u.Held[currency], currency); err != nil {
+			return err
+		}
+	}
+	for _, currency := range sortedCurrencies(u.CreditLimits) {
+		if err := checkAmount("creditLimits."+currency, u.CreditLimits[currency], currency); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// balance is the balance of the user in currency, zero if they never held it.
+func (u *User) balance(currency string) *Money {
+	if balance := u.Balances[currency]; balance != nil {
+		return balance
+	}
+	return zeroMoney(currency)
+}
+
+// held is what the user has set aside for leading bids in currency.
+func (u *User) held(currency string) *Money {
+	if held := u.Held[currency]; held != nil {
+		return held
+	}
+	return zeroMoney(currency)
 }
 
 type Asset struct {
@@ -20,21 +83,422 @@ type Asset struct {
 	Owner       *User      `json:"owner,omitempty"`
 	Name        string     `json:"name,omitempty"`
 	Description string     `json:"description,omitempty"`
-	Price       *big.Rat   `json:"price,omitempty"`
+	Category    string     `json:"category,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	Price       *Money     `json:"price,omitempty"`
+	Currency    string     `json:"currency,omitempty"`
+	PriceIndex  float64    `json:"priceIndex,omitempty"`
 	BidStart    *time.Time `json:"bidStart,omitempty"`
 	BidEnd      *time.Time `json:"bidEnd,omitempty"`
-	IsSold      bool       `json:"isSold,omitempty"`
+	IsSold      bool       `json:"isSold"`
+	SoldPrice   *Money     `json:"soldPrice,omitempty"`
 	DocType     string     `json:"docType,omitempty"`
+
+	ClosingSoonNotified bool `json:"closingSoonNotified"`
+	ClosureFailed       bool `json:"closureFailed"`
+}
+
+// ProvenanceEntry is one owner in the history of an asset. SalePrice is the
+// hammer price the owner paid, empty for the original seller.
+type ProvenanceEntry struct {
+	OwnerEmail string     `json:"ownerEmail,omitempty"`
+	SalePrice  *Money     `json:"salePrice,omitempty"`
+	Currency   string     `json:"currency,omitempty"`
+	TxId       string     `json:"txId,omitempty"`
+	Timestamp  *time.Time `json:"timestamp,omitempty"`
+}
+
+// Category is defined by the auction house; assets refer to it by CategoryId.
+type Category struct {
+	CategoryId  string `json:"categoryId,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	DocType     string `json:"docType,omitempty"`
 }
 
+// Bid is the bid of one bidder on an asset. Held is what the bidder has set
+// aside for it while it leads, the bid and the buyer's premium on it.
 type Bid struct {
 	BidId     string     `json:"bidId,omitempty"`
 	Asset     *Asset     `json:"asset,omitempty"`
-	BidAmount *big.Rat   `json:"bidAmount,omitempty"`
+	BidAmount *Money     `json:"bidAmount,omitempty"`
+	Currency  string     `json:"currency,omitempty"`
 	BidTime   *time.Time `json:"bidTime,omitempty"`
+	Held      *Money     `json:"held,omitempty"`
+	DocType   string     `json:"docType,omitempty"`
+}
+
+func (b *Bid) UnmarshalJSON(data []byte) error {
+	type storedBid Bid
+	if err := json.Unmarshal(data, (*storedBid)(b)); err != nil {
+		return err
+	}
+	if err := checkAmount("bidAmount", b.BidAmount, b.Currency); err != nil {
+		return err
+	}
+	return checkAmount("held", b.Held, b.Currency)
+}
+
+// BidActivity is the state of one auction as seen by a bidder.
+// SecondsRemaining is zero once bidding has ended. The display amounts are
+// the bid amounts converted to the currency the bidder asked for.
+type BidActivity struct {
+	AssetId          string     `json:"assetId,omitempty"`
+	AssetName        string     `json:"assetName,omitempty"`
+	BidAmount        *Money     `json:"bidAmount,omitempty"`
+	BidTime          *time.Time `json:"bidTime,omitempty"`
+	HighBid          *Money     `json:"highBid,omitempty"`
+	Currency         string     `json:"currency,omitempty"`
+	DisplayBidAmount *Money     `json:"displayBidAmount,omitempty"`
+	DisplayHighBid   *Money     `json:"displayHighBid,omitempty"`
+	DisplayCurrency  string     `json:"displayCurrency,omitempty"`
+	IsLeading        bool       `json:"isLeading"`
+	IsSold           bool       `json:"isSold,omitempty"`
+	BidEnd           *time.Time `json:"bidEnd,omitempty"`
+	SecondsRemaining int64      `json:"secondsRemaining"`
+}
+
+// WatchedAsset is an asset on a watchlist together with the state of its auction.
+type WatchedAsset struct {
+	Asset   *Asset `json:"asset,omitempty"`
+	Status  string `json:"status,omitempty"`
+	HighBid *Money `json:"highBid,omitempty"`
+	Bidders int    `json:"bidders"`
+}
+
+// EventEnvelope is the one chaincode event of a transaction. It carries every
+// event the transaction raised, in the order they were raised.
+type EventEnvelope struct {
+	Version   int              `json:"version"`
+	TxId      string           `json:"txId,omitempty"`
+	Timestamp *time.Time       `json:"timestamp,omitempty"`
+	Events    []ChaincodeEvent `json:"events"`
+}
+
+// ChaincodeEvent is a typed event. Version is the version of the payload
+// schema of that type, bumped whenever a field changes meaning or is removed.
+type ChaincodeEvent struct {
+	Type    string          `json:"type"`
+	Version int             `json:"version"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type AssetListedEvent struct {
+	AssetId  string     `json:"assetId,omitempty"`
+	Name     string     `json:"name,omitempty"`
+	Seller   string     `json:"seller,omitempty"`
+	Category string     `json:"category,omitempty"`
+	Price    *Money     `json:"price,omitempty"`
+	Currency string     `json:"currency,omitempty"`
+	BidStart *time.Time `json:"bidStart,omitempty"`
+	BidEnd   *time.Time `json:"bidEnd,omitempty"`
+}
+
+// BidPlacedEvent names the bidder who led before this bid when that was
+// somebody else, so that they can be told they were outbid if IsLeading.
+type BidPlacedEvent struct {
+	AssetId        string   `json:"assetId,omitempty"`
+	Bidder         string   `json:"bidder,omitempty"`
+	BidAmount      *Money   `json:"bidAmount,omitempty"`
+	Currency       string   `json:"currency,omitempty"`
+	IsLeading      bool     `json:"isLeading"`
+	PreviousLeader string   `json:"previousLeader,omitempty"`
+	PreviousBid    *Money   `json:"previousBid,omitempty"`
+	Watchers       []string `json:"watchers,omitempty"`
+}
+
+type AuctionExtendedEvent struct {
+	AssetId        string     `json:"assetId,omitempty"`
+	PreviousBidEnd *time.Time `json:"previousBidEnd,omitempty"`
+	BidEnd         *time.Time `json:"bidEnd,omitempty"`
+	Watchers       []string   `json:"watchers,omitempty"`
+}
+
+type AuctionClosedEvent struct {
+	AssetId     string `json:"assetId,omitempty"`
+	Seller      string `json:"seller,omitempty"`
+	Winner      string `json:"winner,omitempty"`
+	HammerPrice *Money `json:"hammerPrice,omitempty"`
+	Currency    string `json:"currency,omitempty"`
+	BidderCount int    `json:"bidderCount"`
+}
+
+type AssetTransferredEvent struct {
+	AssetId   string `json:"assetId,omitempty"`
+	From      string `json:"from,omitempty"`
+	To        string `json:"to,omitempty"`
+	SalePrice *Money `json:"salePrice,omitempty"`
+	Currency  string `json:"currency,omitempty"`
+}
+
+// BalanceChangedEvent is raised for the balance of the user in one currency.
+type BalanceChangedEvent struct {
+	Email           string `json:"email,omitempty"`
+	Currency        string `json:"currency,omitempty"`
+	PreviousBalance *Money `json:"previousBalance,omitempty"`
+	Balance         *Money `json:"balance,omitempty"`
+	Reason          string `json:"reason,omitempty"`
+	AssetId         string `json:"assetId,omitempty"`
+}
+
+// UserApprovedEvent is raised by approveUser.
+type UserApprovedEvent struct {
+	Email       string `json:"email,omitempty"`
+	CreditLimit *Money `json:"creditLimit,omitempty"`
+	Currency    string `json:"currency,omitempty"`
+	ApprovedBy  string `json:"approvedBy,omitempty"`
+}
+
+// ClosingSoonEvent is raised by notifyClosingSoon for every asset whose auction ends within the window.
+type ClosingSoonEvent struct {
+	AssetId  string     `json:"assetId,omitempty"`
+	BidEnd   *time.Time `json:"bidEnd,omitempty"`
+	HighBid  *Money     `json:"highBid,omitempty"`
+	Currency string     `json:"currency,omitempty"`
+	Bidders  []string   `json:"bidders,omitempty"`
+	Watchers []string   `json:"watchers,omitempty"`
+}
+
+// FeeBracket applies its rates to the portion of the hammer price at or above
+// From, up to the From of the next bracket. From is in the currency of the
+// asset being settled.
+type FeeBracket struct {
+	From                *Money   `json:"from,omitempty"`
+	BuyerPremiumPct     *big.Rat `json:"buyerPremiumPct,omitempty"`
+	SellerCommissionPct *big.Rat `json:"sellerCommissionPct,omitempty"`
+}
+
+// FeeSchedule is maintained by the auction house and applied at settlement.
+// When Brackets is empty the flat percentages apply to the whole hammer price.
+type FeeSchedule struct {
+	BuyerPremiumPct     *big.Rat     `json:"buyerPremiumPct,omitempty"`
+	SellerCommissionPct *big.Rat     `json:"sellerCommissionPct,omitempty"`
+	Brackets            []FeeBracket `json:"brackets,omitempty"`
+	HouseAccountEmail   string       `json:"houseAccountEmail,omitempty"`
+	DocType             string       `json:"docType,omitempty"`
+}
+
+type FeeBreakdown struct {
+	HammerPrice       *Money `json:"hammerPrice,omitempty"`
+	BuyerPremium      *Money `json:"buyerPremium,omitempty"`
+	SellerCommission  *Money `json:"sellerCommission,omitempty"`
+	BuyerTotal        *Money `json:"buyerTotal,omitempty"`
+	SellerProceeds    *Money `json:"sellerProceeds,omitempty"`
+	HouseAccountEmail string `json:"houseAccountEmail,omitempty"`
+}
+
+// Settlement is the receipt written once for every closed auction. It is
+// never updated after it has been recorded.
+type Settlement struct {
+	AssetId      string        `json:"assetId,omitempty"`
+	AssetName    string        `json:"assetName,omitempty"`
+	SellerEmail  string        `json:"sellerEmail,omitempty"`
+	WinnerEmail  string        `json:"winnerEmail,omitempty"`
+	WinningBid   *Money        `json:"winningBid,omitempty"`
+	PriceCharged *Money        `json:"priceCharged,omitempty"`
+	Currency     string        `json:"currency,omitempty"`
+	Fees         *FeeBreakdown `json:"fees,omitempty"`
+	BidderCount  int           `json:"bidderCount,omitempty"`
+	TxId         string        `json:"txId,omitempty"`
+	Timestamp    *time.Time    `json:"timestamp,omitempty"`
+	DocType      string        `json:"docType,omitempty"`
+}
+
+func (s *Settlement) UnmarshalJSON(data []byte) error {
+	type storedSettlement Settlement
+	if err := json.Unmarshal(data, (*storedSettlement)(s)); err != nil {
+		return err
+	}
+	amounts := []struct {
+		field  string
+		amount *Money
+	}{{"winningBid", s.WinningBid}, {"priceCharged", s.PriceCharged}}
+	if s.Fees != nil {
+		amounts = append(amounts, []struct {
+			field  string
+			amount *Money
+		}{
+			{"fees.hammerPrice", s.Fees.HammerPrice},
+			{"fees.buyerPremium", s.Fees.BuyerPremium},
+			{"fees.sellerCommission", s.Fees.SellerCommission},
+			{"fees.buyerTotal", s.Fees.BuyerTotal},
+			{"fees.sellerProceeds", s.Fees.SellerProceeds},
+		}...)
+	}
+	for _, amount := range amounts {
+		if err := checkAmount(amount.field, amount.amount, s.Currency); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FailedClosure records why the sweep could not settle an asset. It is
+// removed once the asset is settled.
+type FailedClosure struct {
+	AssetId     string     `json:"assetId,omitempty"`
+	SellerEmail string     `json:"sellerEmail,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+	TxId        string     `json:"txId,omitempty"`
+	Timestamp   *time.Time `json:"timestamp,omitempty"`
+	DocType     string     `json:"docType,omitempty"`
+}
+
+// JournalEntry records one change of a balance. Amount is signed, a credit is
+// positive, and Balance is the balance right after the change. Entries are
+// never updated, the entries of a user add up to their balance. Hold and
+// release entries change the held funds instead, Held is what is held right
+// after the change and they add up to it.
+type JournalEntry struct {
+	Email     string     `json:"email,omitempty"`
+	Type      string     `json:"type,omitempty"`
+	Currency  string     `json:"currency,omitempty"`
+	Amount    *Money     `json:"amount,omitempty"`
+	Balance   *Money     `json:"balance,omitempty"`
+	Held      *Money     `json:"held,omitempty"`
+	AssetId   string     `json:"assetId,omitempty"`
+	Reference string     `json:"reference,omitempty"`
+	PostedBy  string     `json:"postedBy,omitempty"`
+	TxId      string     `json:"txId,omitempty"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
 	DocType   string     `json:"docType,omitempty"`
 }
 
+func (e *JournalEntry) UnmarshalJSON(data []byte) error {
+	type storedEntry JournalEntry
+	if err := json.Unmarshal(data, (*storedEntry)(e)); err != nil {
+		return err
+	}
+	if err := checkAmount("amount", e.Amount, e.Currency); err != nil {
+		return err
+	}
+	if err := checkAmount("balance", e.Balance, e.Currency); err != nil {
+		return err
+	}
+	return checkAmount("held", e.Held, e.Currency)
+}
+
+// UserApproval is the argument of approveUser. The credit limit is optional.
+type UserApproval struct {
+	Email       string `json:"email,omitempty"`
+	CreditLimit *Money `json:"creditLimit,omitempty"`
+	Currency    string `json:"currency,omitempty"`
+	Reference   string `json:"reference,omitempty"`
+}
+
+// FundsTransfer is the argument of deposit and withdraw.
+type FundsTransfer struct {
+	Email     string `json:"email,omitempty"`
+	Amount    *Money `json:"amount,omitempty"`
+	Currency  string `json:"currency,omitempty"`
+	Reference string `json:"reference,omitempty"`
+}
+
+// ChaincodeError is the envelope every failed invoke returns as its message.
+// Code is one of the ERROR_ constants and never changes meaning, Field is the
+// path of the offending input such as asset.assetId or brackets[1].from.
+type ChaincodeError struct {
+	Code    string `json:"code"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *ChaincodeError) Error() string {
+	return e.Message
+}
+
+// ClosureError is returned when an auction cannot be settled for a business
+// reason, before anything has been written for the asset.
+type ClosureError struct {
+	AssetId string
+	Reason  string
+}
+
+func (e *ClosureError) Error() string {
+	return fmt.Sprintf("Asset : %v cannot be settled : %v", e.AssetId, e.Reason)
+}
+
+// FxRates is the exchange rate table maintained by the auction house. A rate
+// is the amount of the currency one unit of Base buys. The rates are only used
+// to show amounts in another currency, money always moves in the currency of
+// the asset.
+type FxRates struct {
+	Base      string              `json:"base,omitempty"`
+	Rates     map[string]*big.Rat `json:"rates,omitempty"`
+	UpdatedBy string              `json:"updatedBy,omitempty"`
+	Timestamp *time.Time          `json:"timestamp,omitempty"`
+	DocType   string              `json:"docType,omitempty"`
+}
+
+// BatchResult is returned by getBidResult. A non empty Bookmark means there
+// are more assets to look at; pass it back to continue the sweep.
+type BatchResult struct {
+	Processed int    `json:"processed"`
+	Settled   int    `json:"settled"`
+	Failed    int    `json:"failed"`
+	Bookmark  string `json:"bookmark"`
+}
+
+// MigrationResult is returned by migrateLedger. Done is false while there are
+// documents left in an earlier layout; call it again until it is true.
+type MigrationResult struct {
+	Migrated int  `json:"migrated"`
+	Done     bool `json:"done"`
+}
+
+// AssetFilter narrows down searchAssets. Status is one of sold, unsold,
+// upcoming, open or ended; the last three are relative to AsOf.
+type AssetFilter struct {
+	MinPrice     *Money     `json:"minPrice,omitempty"`
+	MaxPrice     *Money     `json:"maxPrice,omitempty"`
+	Currency     string     `json:"currency,omitempty"`
+	Status       string     `json:"status,omitempty"`
+	Seller       string     `json:"seller,omitempty"`
+	Category     string     `json:"category,omitempty"`
+	Tag          string     `json:"tag,omitempty"`
+	BidStartFrom *time.Time `json:"bidStartFrom,omitempty"`
+	BidEndTo     *time.Time `json:"bidEndTo,omitempty"`
+	Text         string     `json:"text,omitempty"`
+	AsOf         *time.Time `json:"asOf,omitempty"`
+}
+
+// AssetSearch is the argument of searchAssets. SortBy is one of bidEnd,
+// bidStart, price or name.
+type AssetSearch struct {
+	Filter   *AssetFilter `json:"filter,omitempty"`
+	SortBy   string       `json:"sortBy,omitempty"`
+	SortDesc bool         `json:"sortDesc,omitempty"`
+	PageSize int32        `json:"pageSize,omitempty"`
+	Bookmark string       `json:"bookmark,omitempty"`
+}
+
+// InvokeResponse is the payload of every invoke that writes to the ledger.
+// Entity is the document the transaction created or updated and Events are
+// the events it raised, the same as in its EventEnvelope.
+type InvokeResponse struct {
+	Status string           `json:"status"`
+	TxId   string           `json:"txId"`
+	Entity interface{}      `json:"entity,omitempty"`
+	Events []ChaincodeEvent `json:"events"`
+}
+
+// ListResponse is the payload of every query for a list. A non empty Bookmark
+// means there are more items; pass it back to get the next page.
+type ListResponse struct {
+	Items    interface{} `json:"items"`
+	Bookmark string      `json:"bookmark"`
+	Count    int         `json:"count"`
+}
+
+// ConsistencyReport is returned by checkConsistency. The ledger is consistent
+// when Violations is empty.
+type ConsistencyReport struct {
+	Users       int      `json:"users"`
+	Assets      int      `json:"assets"`
+	Settlements int      `json:"settlements"`
+	Violations  []string `json:"violations"`
+}
+
 //func toJSON(anyStruct interface{}) ([]byte) {
 //	bytes, _ := json.MarshalIndent(anyStruct, JSON_PREFIX, JSON_INDENT)
 //	return bytes
@@ -0,0 +1,514 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits on client supplied strings, in bytes.
+const (
+	MAX_ID_LENGTH          = 64
+	MAX_NAME_LENGTH        = 128
+	MAX_DESCRIPTION_LENGTH = 2000
+	MAX_TAG_LENGTH         = 32
+	MAX_EMAIL_LENGTH       = 254
+	MAX_PHONE_LENGTH       = 32
+	MAX_BOOKMARK_LENGTH    = 1024
+	MAX_REFERENCE_LENGTH   = 128
+)
+
+var emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+// Currency codes are ISO 4217 alphabetic codes.
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+/**
+Decode a client document into target. Unknown fields and anything after the document are rejected. The error is a
+ChaincodeError naming the offending field where it can be found.
+ */
+func decodeInput(input string, target interface{}) error {
+	decoder := json.NewDecoder(strings.NewReader(input))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		return decodeError(input, target, err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return newError(ERROR_INVALID_JSON, "", "Unexpected data after the JSON document")
+	}
+	//types that read the earlier layouts of their documents accept fields the decoder cannot refuse for them
+	var document interface{}
+	if err := json.Unmarshal([]byte(input), &document); err != nil {
+		return decodeError(input, target, err)
+	}
+	if field, found := findUnknownField(document, reflect.TypeOf(target), ""); found {
+		return newError(ERROR_UNKNOWN_FIELD, field, "Unknown field %v", field)
+	}
+	//and amounts in the forms only earlier versions of the chaincode wrote
+	if field, found := findInvalidValue(document, reflect.TypeOf(target), ""); found {
+		return newError(ERROR_INVALID_FORMAT, field, "%v is not a decimal amount", fieldName(field))
+	}
+	return nil
+}
+
+func decodeError(input string, target interface{}, err error) *ChaincodeError {
+	switch err := err.(type) {
+	case *ChaincodeError:
+		//amounts too precise for their currency
+		return err
+	case *json.SyntaxError:
+		return newError(ERROR_INVALID_JSON, "", "Invalid JSON at offset %v : %v", err.Offset, err.Error())
+	case *json.UnmarshalTypeError:
+		return newError(ERROR_INVALID_FORMAT, err.Field, "%v cannot be a JSON %v", fieldName(err.Field), err.Value)
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return newError(ERROR_INVALID_JSON, "", "Incomplete JSON document")
+	}
+	var document interface{}
+	parsed := json.Unmarshal([]byte(input), &document) == nil
+	if name := strings.TrimPrefix(err.Error(), "json: unknown field "); name != err.Error() {
+		//the decoder only names the field, not where it is
+		name, _ = strconv.Unquote(name)
+		field := name
+		if parsed {
+			if path, found := findUnknownField(document, reflect.TypeOf(target), ""); found {
+				field = path
+			}
+		}
+		return newError(ERROR_UNKNOWN_FIELD, field, "Unknown field %v", field)
+	}
+	//amounts and times report their own parse errors without saying which field they are
+	if parsed {
+		if field, found := findInvalidValue(document, reflect.TypeOf(target), ""); found {
+			return newError(ERROR_INVALID_FORMAT, field, "%v : %v", fieldName(field), err.Error())
+		}
+	}
+	return newError(ERROR_INVALID_FORMAT, "", "%v", err.Error())
+}
+
+/**
+Walk a decoded document along the type it was meant for and return the path of the first member the type has no field
+for.
+ */
+func findUnknownField(value interface{}, t reflect.Type, path string) (string, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if t.Kind() != reflect.Struct {
+			return "", false
+		}
+		fields := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			fields[strings.Split(t.Field(i).Tag.Get("json"), ",")[0]] = t.Field(i).Type
+		}
+		//in document order would be better, but sorted is at least the same on every peer
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fieldValue := value[name]
+			fieldType, ok := fields[name]
+			if !ok {
+				return joinField(path, name), true
+			}
+			if field, found := findUnknownField(fieldValue, fieldType, joinField(path, name)); found {
+				return field, true
+			}
+		}
+	case []interface{}:
+		if t.Kind() != reflect.Slice {
+			return "", false
+		}
+		for i, element := range value {
+			if field, found := findUnknownField(element, t.Elem(), path+"["+strconv.Itoa(i)+"]"); found {
+				return field, true
+			}
+		}
+	}
+	return "", false
+}
+
+/**
+Walk a decoded document along the type it was meant for and return the path of the first amount or time that does not
+parse.
+ */
+func findInvalidValue(value interface{}, t reflect.Type, path string) (string, bool) {
+	for t.Kind() == reflect.Ptr {
+		if t == reflect.TypeOf(&Money{}) || t == reflect.TypeOf(&time.Time{}) {
+			break
+		}
+		t = t.Elem()
+	}
+	switch value := value.(type) {
+	case string:
+		if t == reflect.TypeOf(&Money{}) {
+			if _, err := parseMoney(value); err != nil {
+				return path, true
+			}
+		} else if t.Kind() == reflect.Ptr {
+			if err := reflect.New(t.Elem()).Interface().(interface{ UnmarshalText([]byte) error }).UnmarshalText([]byte(value)); err != nil {
+				return path, true
+			}
+		}
+	case map[string]interface{}:
+		if t.Kind() == reflect.Map {
+			//keys in sorted order so that every peer reports the same field
+			keys := make([]string, 0, len(value))
+			for key := range value {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				if field, found := findInvalidValue(value[key], t.Elem(), joinField(path, key)); found {
+					return field, true
+				}
+			}
+			return "", false
+		}
+		if t.Kind() != reflect.Struct {
+			return "", false
+		}
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			if fieldValue, ok := value[name]; ok {
+				if field, found := findInvalidValue(fieldValue, t.Field(i).Type, joinField(path, name)); found {
+					return field, true
+				}
+			}
+		}
+	case []interface{}:
+		if t.Kind() != reflect.Slice {
+			return "", false
+		}
+		for i, element := range value {
+			if field, found := findInvalidValue(element, t.Elem(), path+"["+strconv.Itoa(i)+"]"); found {
+				return field, true
+			}
+		}
+	}
+	return "", false
+}
+
+func joinField(path string, name string) string {
+	if len(path) == 0 {
+		return name
+	}
+	return path + "." + name
+}
+
+// fieldName is how a field is named in a message, the top level document has no path.
+func fieldName(field string) string {
+	if len(field) == 0 {
+		return "Document"
+	}
+	return field
+}
+
+func requireString(field string, value string, maxLength int, message string) error {
+	if len(value) == 0 {
+		return newError(ERROR_REQUIRED, field, "%v", message)
+	}
+	return checkLength(field, value, maxLength)
+}
+
+func checkLength(field string, value string, maxLength int) error {
+	if len(value) > maxLength {
+		return newError(ERROR_TOO_LONG, field, "%v must not be longer than %v characters", field, maxLength)
+	}
+	return nil
+}
+
+// checkEmail accepts an empty value, combine it with requireString when the email is mandatory.
+func checkEmail(field string, value string) error {
+	if err := checkLength(field, value, MAX_EMAIL_LENGTH); err != nil {
+		return err
+	}
+	if len(value) > 0 && !emailPattern.MatchString(value) {
+		return newError(ERROR_INVALID_EMAIL, field, "%v is not a valid email address", value)
+	}
+	return nil
+}
+
+// checkCurrency accepts an empty value, which stands for DEFAULT_CURRENCY.
+func checkCurrency(field string, value string) error {
+	if err := checkLength(field, value, MAX_ID_LENGTH); err != nil {
+		return err
+	}
+	if len(value) > 0 && !currencyPattern.MatchString(value) {
+		return newError(ERROR_INVALID_CURRENCY, field, "%v is not a currency code such as %v", value, DEFAULT_CURRENCY)
+	}
+	return nil
+}
+
+func requirePositive(field string, amount *Money, message string) error {
+	if amount == nil {
+		return newError(ERROR_REQUIRED, field, "%v is mandatory", field)
+	}
+	if amount.Sign() <= 0 {
+		return newError(ERROR_NOT_POSITIVE, field, "%v", message)
+	}
+	return nil
+}
+
+/**
+Check that amount has no fraction finer than the minor unit of currency and bring it to the scale of the currency, so that
+it is stored and encoded the same way on every peer. A nil amount is left to the required checks.
+ */
+func checkAmount(field string, amount *Money, currency string) error {
+	if amount == nil {
+		return nil
+	}
+	scale := currencyScale(currency)
+	if !amount.fitsScale(scale) {
+		return newError(ERROR_TOO_PRECISE, field, "%v %v has more than %v decimal places", currencyOf(currency), amount, scale)
+	}
+	amount.setScale(scale)
+	return nil
+}
+
+/**
+Parse a time passed as a plain argument.
+ */
+func parseTimeArg(field string, value string) (time.Time, error) {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return parsed, newError(ERROR_INVALID_FORMAT, field, "%v must be an RFC 3339 time : %v", field, err.Error())
+	}
+	return parsed, nil
+}
+
+/**
+Parse an optional count passed as a plain argument, def when it is empty.
+ */
+func parseCountArg(field string, value string, def int, max int, message string) (int, error) {
+	if len(value) == 0 {
+		return def, nil
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count <= 0 || count > max {
+		return 0, newError(ERROR_OUT_OF_RANGE, field, "%v", message)
+	}
+	return count, nil
+}
+
+// Client documents are unmarshalled straight into the ledger types, so any
+// field may be missing. These checks run before a field is dereferenced.
+
+func validateUserInput(user *User) error {
+	if err := requireString("userId", user.UserId, MAX_ID_LENGTH, "User Id is mandatory"); err != nil {
+		return err
+	}
+	if err := checkEmail("email", user.Email); err != nil {
+		return err
+	}
+	if err := checkLength("phone", user.Phone, MAX_PHONE_LENGTH); err != nil {
+		return err
+	}
+	if err := checkLength("org", user.Organization, MAX_ID_LENGTH); err != nil {
+		return err
+	}
+	//new users start at zero, funds only come from an approval or a deposit
+	if user.Balances != nil {
+		return newError(ERROR_READ_ONLY, "balances", "User Balance cannot be set, new users start at zero")
+	}
+	if user.Held != nil {
+		return newError(ERROR_READ_ONLY, "held", "User held funds are set by placeBid")
+	}
+	for _, approvalField := range []struct {
+		field string
+		set   bool
+	}{
+		{"status", len(user.Status) > 0},
+		{"creditLimits", user.CreditLimits != nil},
+		{"approvedBy", len(user.ApprovedBy) > 0},
+		{"approvedAt", user.ApprovedAt != nil},
+	} {
+		if approvalField.set {
+			return newError(ERROR_READ_ONLY, approvalField.field, "User %v can only be set by approveUser", approvalField.field)
+		}
+	}
+	return nil
+}
+
+func validateUserApproval(approval *UserApproval) error {
+	if err := requireString("email", approval.Email, MAX_EMAIL_LENGTH, "User email is mandatory"); err != nil {
+		return err
+	}
+	if err := checkEmail("email", approval.Email); err != nil {
+		return err
+	}
+	if approval.CreditLimit != nil && approval.CreditLimit.Sign() < 0 {
+		return newError(ERROR_NEGATIVE, "creditLimit", "Credit limit cannot be negative")
+	}
+	if err := checkCurrency("currency", approval.Currency); err != nil {
+		return err
+	}
+	if err := checkAmount("creditLimit", approval.CreditLimit, approval.Currency); err != nil {
+		return err
+	}
+	return checkLength("reference", approval.Reference, MAX_REFERENCE_LENGTH)
+}
+
+func validateAssetInput(asset *Asset) error {
+	if err := requireString("name", asset.Name, MAX_NAME_LENGTH, "Asset name is mandatory"); err != nil {
+		return err
+	}
+	if err := checkLength("description", asset.Description, MAX_DESCRIPTION_LENGTH); err != nil {
+		return err
+	}
+	if err := checkLength("category", asset.Category, MAX_ID_LENGTH); err != nil {
+		return err
+	}
+	for i, tag := range asset.Tags {
+		if err := checkLength("tags["+strconv.Itoa(i)+"]", tag, MAX_TAG_LENGTH); err != nil {
+			return err
+		}
+	}
+	if asset.Price == nil {
+		return newError(ERROR_REQUIRED, "price", "Asset price is mandatory")
+	}
+	if err := requirePositive("price", asset.Price, "Asset price cannot be zero or less than zero"); err != nil {
+		return err
+	}
+	if err := checkCurrency("currency", asset.Currency); err != nil {
+		return err
+	}
+	if err := checkAmount("price", asset.Price, asset.Currency); err != nil {
+		return err
+	}
+	if asset.BidStart == nil {
+		return newError(ERROR_REQUIRED, "bidStart", "Bid start is mandatory")
+	}
+	if asset.BidEnd == nil {
+		return newError(ERROR_REQUIRED, "bidEnd", "Bid end is mandatory")
+	}
+	if asset.BidEnd.Before(*asset.BidStart) {
+		return newError(ERROR_OUT_OF_RANGE, "bidEnd", "Incorrect Bid Duration")
+	}
+	//the seller lists the asset, everything else about it is kept by the chaincode
+	for _, serverField := range []struct {
+		field string
+		set   bool
+	}{
+		{"assetId", len(asset.AssetId) > 0},
+		{"owner", asset.Owner != nil},
+		{"priceIndex", asset.PriceIndex != 0},
+		{"isSold", asset.IsSold},
+		{"soldPrice", asset.SoldPrice != nil},
+		{"docType", len(asset.DocType) > 0},
+		{"closingSoonNotified", asset.ClosingSoonNotified},
+		{"closureFailed", asset.ClosureFailed},
+	} {
+		if serverField.set {
+			return newError(ERROR_READ_ONLY, serverField.field, "Asset %v is set by the chaincode", serverField.field)
+		}
+	}
+	return nil
+}
+
+func validateBidInput(bid *Bid) error {
+	if bid.Asset == nil {
+		return newError(ERROR_REQUIRED, "asset.assetId", "Asset ID is mandatory")
+	}
+	if err := requireString("asset.assetId", bid.Asset.AssetId, MAX_ID_LENGTH, "Asset ID is mandatory"); err != nil {
+		return err
+	}
+	if bid.BidAmount == nil {
+		return newError(ERROR_REQUIRED, "bidAmount", "Bid amount is mandatory")
+	}
+	if err := requirePositive("bidAmount", bid.BidAmount, "Bid amount must be greater than zero"); err != nil {
+		return err
+	}
+	if err := checkCurrency("currency", bid.Currency); err != nil {
+		return err
+	}
+	if bid.Held != nil {
+		return newError(ERROR_READ_ONLY, "held", "Bid held funds are set by placeBid")
+	}
+	return checkAmount("bidAmount", bid.BidAmount, bid.Currency)
+}
+
+func validateCategoryInput(category *Category) error {
+	if err := requireString("categoryId", category.CategoryId, MAX_ID_LENGTH, "Category ID is mandatory"); err != nil {
+		return err
+	}
+	if err := requireString("name", category.Name, MAX_NAME_LENGTH, "Category name is mandatory"); err != nil {
+		return err
+	}
+	return checkLength("description", category.Description, MAX_DESCRIPTION_LENGTH)
+}
+
+func validateAssetSearch(search *AssetSearch) error {
+	if search.PageSize < 0 || search.PageSize > MAX_PAGE_SIZE {
+		return newError(ERROR_OUT_OF_RANGE, "pageSize", "Page size must be between 1 and %v", MAX_PAGE_SIZE)
+	}
+	if err := checkLength("bookmark", search.Bookmark, MAX_BOOKMARK_LENGTH); err != nil {
+		return err
+	}
+	//the price index has no currency, prices are only comparable within one
+	filter := search.Filter
+	comparesPrices := search.SortBy == "price" || (filter != nil && (filter.MinPrice != nil || filter.MaxPrice != nil))
+	if comparesPrices && (filter == nil || len(filter.Currency) == 0) {
+		return newError(ERROR_REQUIRED, "filter.currency", "Prices can only be filtered and sorted within a currency")
+	}
+	if filter == nil {
+		return nil
+	}
+	if err := checkEmail("filter.seller", filter.Seller); err != nil {
+		return err
+	}
+	if err := checkLength("filter.category", filter.Category, MAX_ID_LENGTH); err != nil {
+		return err
+	}
+	if err := checkCurrency("filter.currency", filter.Currency); err != nil {
+		return err
+	}
+	if err := checkLength("filter.tag", filter.Tag, MAX_TAG_LENGTH); err != nil {
+		return err
+	}
+	if err := checkLength("filter.text", filter.Text, MAX_NAME_LENGTH); err != nil {
+		return err
+	}
+	if filter.MinPrice != nil && filter.MinPrice.Sign() < 0 {
+		return newError(ERROR_NEGATIVE, "filter.minPrice", "Minimum price cannot be negative")
+	}
+	if filter.MaxPrice != nil && filter.MaxPrice.Sign() < 0 {
+		return newError(ERROR_NEGATIVE, "filter.maxPrice", "Maximum price cannot be negative")
+	}
+	return nil
+}
+
+func validateFundsTransfer(transfer *FundsTransfer) error {
+	if err := requireString("email", transfer.Email, MAX_EMAIL_LENGTH, "User email is mandatory"); err != nil {
+		return err
+	}
+	if err := checkEmail("email", transfer.Email); err != nil {
+		return err
+	}
+	if err := requirePositive("amount", transfer.Amount, "Amount must be greater than zero"); err != nil {
+		return err
+	}
+	if err := checkCurrency("currency", transfer.Currency); err != nil {
+		return err
+	}
+	if err := checkAmount("amount", transfer.Amount, transfer.Currency); err != nil {
+		return err
+	}
+	return checkLength("reference", transfer.Reference, MAX_REFERENCE_LENGTH)
+}
+
+/**
+Check an asset id passed as a plain argument.
+ */
+func validateAssetIdArg(field string, assetId string) error {
+	return requireString(field, assetId, MAX_ID_LENGTH, "Asset ID is mandatory")
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrorEnvelope(t *testing.T) {
+	f := newAuctionFixture(t)
+	response := f.invoke(f.alice, "getUser", "nobody@example.com")
+	if response.Status < shim.ERRORTHRESHOLD {
+		t.Fatal("getUser of an unregistered user succeeded")
+	}
+	var envelope map[string]string
+	if err := json.Unmarshal([]byte(response.Message), &envelope); err != nil {
+		t.Fatalf("message %q is not an envelope : %v", response.Message, err)
+	}
+	if envelope["code"] != ERROR_NOT_REGISTERED || envelope["message"] != "user not registered" {
+		t.Fatalf("envelope is %v", envelope)
+	}
+	if _, ok := envelope["field"]; ok {
+		t.Fatalf("envelope %v names a field", envelope)
+	}
+
+	if message := errorResponse(errors.New("disk full")).Message; message != `{"code":"INTERNAL","message":"disk full"}` {
+		t.Fatalf("internal error envelope is %v", message)
+	}
+	closureErr := &ClosureError{AssetId: "a1", Reason: "no funds"}
+	if message := errorResponse(closureErr).Message; !strings.Contains(message, `"code":"SETTLEMENT_FAILED"`) {
+		t.Fatalf("closure error envelope is %v", message)
+	}
+}
+
+func TestValidateUserInput(t *testing.T) {
+	l := newTestLedger(t)
+	dave := newTestIdentity(t, "dave@example.com", "Org1")
+	tests := []struct {
+		name  string
+		user  string
+		code  string
+		field string
+	}{
+		{"malformed json", `{"userId":`, ERROR_INVALID_JSON, ""},
+		{"trailing data", `{"userId":"dave"} {}`, ERROR_INVALID_JSON, ""},
+		{"unknown field", `{"userId":"dave","admin":true}`, ERROR_UNKNOWN_FIELD, "admin"},
+		{"wrong type", `{"userId":7}`, ERROR_INVALID_FORMAT, "userId"},
+		{"unparsable balance", `{"userId":"dave","balances":{"USD":"ten"}}`, ERROR_INVALID_FORMAT, "balances.USD"},
+		{"no user id", `{"phone":"12"}`, ERROR_REQUIRED, "userId"},
+		{"long user id", `{"userId":"` + strings.Repeat("d", MAX_ID_LENGTH+1) + `"}`, ERROR_TOO_LONG, "userId"},
+		{"bad email", `{"userId":"dave","email":"dave.example.com"}`, ERROR_INVALID_EMAIL, "email"},
+		{"long phone", `{"userId":"dave","phone":"` + strings.Repeat("1", MAX_PHONE_LENGTH+1) + `"}`, ERROR_TOO_LONG, "phone"},
+		{"single balance", `{"userId":"dave","balance":"10"}`, ERROR_UNKNOWN_FIELD, "balance"},
+		{"own balance", `{"userId":"dave","balances":{"USD":"1000000"}}`, ERROR_READ_ONLY, "balances"},
+		{"zero balance", `{"userId":"dave","balances":{}}`, ERROR_READ_ONLY, "balances"},
+		{"own status", `{"userId":"dave","status":"approved"}`, ERROR_READ_ONLY, "status"},
+		{"own credit limit", `{"userId":"dave","creditLimits":{"USD":"10"}}`, ERROR_READ_ONLY, "creditLimits"},
+		{"own held funds", `{"userId":"dave","held":{"USD":"0"}}`, ERROR_READ_ONLY, "held"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l.t = t
+			l.expectErrorCode(test.code, test.field, dave, "addUser", test.user)
+		})
+	}
+	l.t = t
+	l.mustInvoke(dave, "addUser", `{"userId":"dave","email":"dave@example.com"}`)
+}
+
+func TestValidateAssetInput(t *testing.T) {
+	f := newAuctionFixture(t)
+	window := `"bidStart":"` + f.now.Add(time.Hour).Format(time.RFC3339) + `","bidEnd":"` + f.now.Add(2*time.Hour).Format(time.RFC3339) + `"`
+	tests := []struct {
+		name  string
+		asset string
+		code  string
+		field string
+	}{
+		{"unknown field", `{"name":"Vase","price":"10","reserve":"5",` + window + `}`, ERROR_UNKNOWN_FIELD, "reserve"},
+		{"unknown owner field", `{"name":"Vase","price":"10","owner":{"wallet":"x"},` + window + `}`, ERROR_UNKNOWN_FIELD, "owner.wallet"},
+		{"no name", `{"price":"10",` + window + `}`, ERROR_REQUIRED, "name"},
+		{"long name", `{"name":"` + strings.Repeat("v", MAX_NAME_LENGTH+1) + `","price":"10",` + window + `}`, ERROR_TOO_LONG, "name"},
+		{"long tag", `{"name":"Vase","price":"10","tags":["ok","` + strings.Repeat("t", MAX_TAG_LENGTH+1) + `"],` + window + `}`, ERROR_TOO_LONG, "tags[1]"},
+		{"too many tags", `{"name":"Vase","price":"10","tags":["1","2","3","4","5","6","7","8","9","10","11"],` + window + `}`, ERROR_TOO_MANY, "tags"},
+		{"unparsable price", `{"name":"Vase","price":"cheap",` + window + `}`, ERROR_INVALID_FORMAT, "price"},
+		{"zero price", `{"name":"Vase","price":"0",` + window + `}`, ERROR_NOT_POSITIVE, "price"},
+		{"fractional price", `{"name":"Vase","price":"1/3",` + window + `}`, ERROR_INVALID_FORMAT, "price"},
+		{"exact fractional price", `{"name":"Vase","price":"25/2",` + window + `}`, ERROR_INVALID_FORMAT, "price"},
+		{"price below the cent", `{"name":"Vase","price":"10.005",` + window + `}`, ERROR_TOO_PRECISE, "price"},
+		{"price below the yen", `{"name":"Vase","price":"10.5","currency":"JPY",` + window + `}`, ERROR_TOO_PRECISE, "price"},
+		{"unparsable bid start", `{"name":"Vase","price":"10","bidStart":"soon"}`, ERROR_INVALID_FORMAT, "bidStart"},
+		{"no bid start", `{"name":"Vase","price":"10"}`, ERROR_REQUIRED, "bidStart"},
+		{"unknown category", `{"name":"Vase","price":"10","category":"cars",` + window + `}`, ERROR_NOT_FOUND, "category"},
+		{"own asset id", `{"name":"Vase","price":"10","assetId":"vase1",` + window + `}`, ERROR_READ_ONLY, "assetId"},
+		{"own owner", `{"name":"Vase","price":"10","owner":{"email":"bob@example.com"},` + window + `}`, ERROR_READ_ONLY, "owner"},
+		{"own price index", `{"name":"Vase","price":"10","priceIndex":0.5,` + window + `}`, ERROR_READ_ONLY, "priceIndex"},
+		{"already sold", `{"name":"Vase","price":"10","isSold":true,` + window + `}`, ERROR_READ_ONLY, "isSold"},
+		{"own sold price", `{"name":"Vase","price":"10","soldPrice":"10",` + window + `}`, ERROR_READ_ONLY, "soldPrice"},
+		{"own doc type", `{"name":"Vase","price":"10","docType":"User",` + window + `}`, ERROR_READ_ONLY, "docType"},
+		{"already notified", `{"name":"Vase","price":"10","closingSoonNotified":true,` + window + `}`, ERROR_READ_ONLY, "closingSoonNotified"},
+		{"already failed", `{"name":"Vase","price":"10","closureFailed":true,` + window + `}`, ERROR_READ_ONLY, "closureFailed"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f.t = t
+			f.expectErrorCode(test.code, test.field, f.alice, "addAssetForBid", test.asset)
+		})
+	}
+}
+
+func TestValidateBidInput(t *testing.T) {
+	f := newAuctionFixture(t)
+	assetId := f.addAsset(f.alice, "Vase", "100", time.Hour)
+	f.advance(90 * time.Minute)
+	tests := []struct {
+		name  string
+		bid   string
+		code  string
+		field string
+	}{
+		{"unknown field", `{"asset":{"assetId":"` + assetId + `"},"bidAmount":"200","proxy":true}`, ERROR_UNKNOWN_FIELD, "proxy"},
+		{"no asset", `{"bidAmount":"200"}`, ERROR_REQUIRED, "asset.assetId"},
+		{"no asset id", `{"asset":{},"bidAmount":"200"}`, ERROR_REQUIRED, "asset.assetId"},
+		{"unparsable amount", `{"asset":{"assetId":"` + assetId + `"},"bidAmount":"lots"}`, ERROR_INVALID_FORMAT, "bidAmount"},
+		{"zero amount", `{"asset":{"assetId":"` + assetId + `"},"bidAmount":"0"}`, ERROR_NOT_POSITIVE, "bidAmount"},
+		{"amount below the cent", `{"asset":{"assetId":"` + assetId + `"},"bidAmount":"200.001"}`, ERROR_TOO_PRECISE, "bidAmount"},
+		{"below price", `{"asset":{"assetId":"` + assetId + `"},"bidAmount":"50"}`, ERROR_OUT_OF_RANGE, "bidAmount"},
+		{"own held funds", `{"asset":{"assetId":"` + assetId + `"},"bidAmount":"200","held":"0"}`, ERROR_READ_ONLY, "held"},
+		{"unknown asset", `{"asset":{"assetId":"missing"},"bidAmount":"200"}`, ERROR_NOT_FOUND, "assetId"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f.t = t
+			f.expectErrorCode(test.code, test.field, f.bob, "placeBid", test.bid, "-")
+		})
+	}
+}
+
+func TestValidateOtherInputs(t *testing.T) {
+	f := newAuctionFixture(t)
+	f.expectErrorCode(ERROR_UNAUTHORIZED, "", f.alice, "addCategory", `{"categoryId":"art","name":"Art"}`)
+	f.expectErrorCode(ERROR_REQUIRED, "name", f.house, "addCategory", `{"categoryId":"art"}`)
+	f.expectErrorCode(ERROR_UNKNOWN_FIELD, "parent", f.house, "addCategory", `{"categoryId":"art","name":"Art","parent":"x"}`)
+	f.expectErrorCode(ERROR_INVALID_EMAIL, "houseAccountEmail", f.house, "setFeeSchedule", `{"houseAccountEmail":"house"}`)
+	f.expectErrorCode(ERROR_OUT_OF_RANGE, "brackets[1].buyerPremiumPct", f.house, "setFeeSchedule",
+		`{"brackets":[{"from":"0"},{"from":"100","buyerPremiumPct":"120"}],"houseAccountEmail":"house@example.com"}`)
+	f.expectErrorCode(ERROR_INVALID_FORMAT, "brackets[1].from", f.house, "setFeeSchedule",
+		`{"brackets":[{"from":"0"},{"from":"1e3"}],"houseAccountEmail":"house@example.com"}`)
+	f.expectErrorCode(ERROR_TOO_PRECISE, "amount", f.house, "deposit", `{"email":"bob@example.com","amount":"0.0001","currency":"KWD"}`)
+	f.expectErrorCode(ERROR_TOO_PRECISE, "creditLimit", f.admin, "approveUser", `{"email":"bob@example.com","creditLimit":"0.5","currency":"JPY"}`)
+	f.expectErrorCode(ERROR_INVALID_EMAIL, "filter.seller", f.alice, "searchAssets", `{"filter":{"seller":"alice"}}`)
+	f.expectErrorCode(ERROR_UNKNOWN_FIELD, "limit", f.alice, "searchAssets", `{"limit":5}`)
+	f.expectErrorCode(ERROR_INVALID_FORMAT, "filter.status", f.alice, "searchAssets", `{"filter":{"status":"lost"}}`)
+	f.expectErrorCode(ERROR_REQUIRED, "filter.currency", f.alice, "searchAssets", `{"filter":{"minPrice":"10"}}`)
+	f.expectErrorCode(ERROR_REQUIRED, "filter.currency", f.alice, "searchAssets", `{"filter":{"maxPrice":"10","seller":"bob@example.com"}}`)
+	f.expectErrorCode(ERROR_REQUIRED, "filter.currency", f.alice, "searchAssets", `{"sortBy":"price"}`)
+	f.expectErrorCode(ERROR_INVALID_FORMAT, "currentTime", f.house, "getBidResult", "yesterday")
+	f.expectErrorCode(ERROR_OUT_OF_RANGE, "pageSize", f.house, "getBidResult", f.now.Format(time.RFC3339), "0")
+	f.expectErrorCode(ERROR_UNKNOWN_FUNCTION, "", f.alice, "dropTables")
+	f.expectErrorCode(ERROR_ARGUMENT_COUNT, "", f.alice, "getUser", "a", "b")
+}
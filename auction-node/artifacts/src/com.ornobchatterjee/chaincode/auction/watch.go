@@ -0,0 +1,242 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+/**
+Put an asset on the watchlist of the invoker. args[0] is the asset id.
+ */
+func (t *AuctionChaincode) watchAsset(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	user, assetId, err := getWatchArgs(stub, args)
+	if err != nil {
+		return errorResponse(err)
+	}
+	assetObj, err := getAsset(stub, assetId)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if assetObj == nil {
+		return errorResponse(newError(ERROR_NOT_FOUND, "assetId", "Asset : %v is not found", assetId))
+	}
+
+	watchKey, err := getCompositeKey(stub, COMPOSITE_KEY_USER_WATCH_ASSET, user.Email, assetId)
+	if err != nil {
+		return errorResponse(err)
+	}
+	watcherKey, err := getCompositeKey(stub, COMPOSITE_KEY_ASSET_WATCHER, assetId, user.Email)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if err = stub.PutState(watchKey, []byte{0x00}); err != nil {
+		return errorResponse(err)
+	}
+	if err = stub.PutState(watcherKey, []byte{0x00}); err != nil {
+		return errorResponse(err)
+	}
+	return invokeSuccess(stub, assetObj, nil)
+}
+
+/**
+Take an asset off the watchlist of the invoker. args[0] is the asset id.
+ */
+func (t *AuctionChaincode) unwatchAsset(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	user, assetId, err := getWatchArgs(stub, args)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	watchKey, err := getCompositeKey(stub, COMPOSITE_KEY_USER_WATCH_ASSET, user.Email, assetId)
+	if err != nil {
+		return errorResponse(err)
+	}
+	watched, err := stub.GetState(watchKey)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if watched == nil {
+		return errorResponse(newError(ERROR_INVALID_STATE, "", "Asset : %v is not on the watchlist", assetId))
+	}
+	watcherKey, err := getCompositeKey(stub, COMPOSITE_KEY_ASSET_WATCHER, assetId, user.Email)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if err = stub.DelState(watchKey); err != nil {
+		return errorResponse(err)
+	}
+	if err = stub.DelState(watcherKey); err != nil {
+		return errorResponse(err)
+	}
+	return invokeSuccess(stub, nil, nil)
+}
+
+/**
+List the assets on the watchlist of the invoker with the status of their auction and the high bid.
+ */
+func (t *AuctionChaincode) getWatchedAssets(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	user, err := getUserByEmail(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	watchIterator, err := stub.GetStateByPartialCompositeKey(COMPOSITE_KEY_USER_WATCH_ASSET, []string{user.Email})
+	if err != nil {
+		return errorResponse(err)
+	}
+	defer watchIterator.Close()
+
+	var watchedAssets = make([]WatchedAsset, 0)
+	for watchIterator.HasNext() {
+		responseRange, err := watchIterator.Next()
+		if err != nil {
+			return errorResponse(err)
+		}
+		//user~watch~asset is {user}{asset}
+		_, keyParts, err := stub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return errorResponse(err)
+		}
+		assetObj, err := getAsset(stub, keyParts[1])
+		if err != nil {
+			return errorResponse(err)
+		}
+		if assetObj == nil {
+			return errorResponse(newError(ERROR_NOT_FOUND, "", "Asset : %v is not found", keyParts[1]))
+		}
+		highBid, _, bidders, err := getHighBid(stub, assetObj.AssetId, "")
+		if err != nil {
+			return errorResponse(err)
+		}
+		watchedAssets = append(watchedAssets, WatchedAsset{assetObj, getAssetStatus(assetObj, *txTime), highBid, len(bidders)})
+	}
+
+	return listSuccess(watchedAssets, "")
+}
+
+/**
+Tell bidders and watchers about the auctions that end soon. args are the current time and an optional window in
+minutes. Every asset is reported once, so the auction house can run this as often as it likes.
+ */
+func (t *AuctionChaincode) notifyClosingSoon(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	org, _ := getMSPAttr(stub, MSP_ATTRIBUTE_ORG)
+	if org != "Org2" {
+		return unauthorized("Only Auction house users are allowed to invoke this function")
+	}
+
+	currentTime, err := parseTimeArg("currentTime", args[0])
+	if err != nil {
+		return errorResponse(err)
+	}
+	window := DEFAULT_CLOSING_SOON_MINUTES
+	if len(args) > 1 && len(args[1]) > 0 {
+		window, err = strconv.Atoi(args[1])
+		if err != nil || window <= 0 {
+			return errorResponse(newError(ERROR_OUT_OF_RANGE, "minutes", "Window must be a positive number of minutes"))
+		}
+	}
+
+	query, err := getClosingSoonQuery(currentTime, currentTime.Add(time.Duration(window)*time.Minute))
+	if err != nil {
+		return errorResponse(err)
+	}
+	resultsIterator, err := stub.GetQueryResult(query)
+	if err != nil {
+		return errorResponse(err)
+	}
+	defer resultsIterator.Close()
+
+	var events EventBatch
+	var closingSoon = make([]ClosingSoonEvent, 0)
+	for len(closingSoon) < MAX_BATCH_SIZE && resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return errorResponse(err)
+		}
+		var assetObj Asset
+		if err = json.Unmarshal(queryResponse.Value, &assetObj); err != nil {
+			return errorResponse(err)
+		}
+		highBid, _, bidders, err := getHighBid(stub, assetObj.AssetId, "")
+		if err != nil {
+			return errorResponse(err)
+		}
+		watchers, err := getWatchers(stub, assetObj.AssetId)
+		if err != nil {
+			return errorResponse(err)
+		}
+		closingSoonEvent := ClosingSoonEvent{assetObj.AssetId, assetObj.BidEnd, highBid, currencyOf(assetObj.Currency), bidders, watchers}
+		if err = events.add(EVENT_CLOSING_SOON, closingSoonEvent); err != nil {
+			return errorResponse(err)
+		}
+		closingSoon = append(closingSoon, closingSoonEvent)
+
+		assetObj.ClosingSoonNotified = true
+		if err = putAsset(stub, &assetObj); err != nil {
+			return errorResponse(err)
+		}
+	}
+	t.Infof("[ notifyClosingSoon ] - %v assets end within %v minutes", len(closingSoon), window)
+
+	return invokeSuccess(stub, closingSoon, &events)
+}
+
+func getWatchArgs(stub shim.ChaincodeStubInterface, args []string) (*User, string, error) {
+	user, err := getUserByEmail(stub)
+	if err != nil {
+		return nil, "", err
+	}
+	if err = validateAssetIdArg("assetId", args[0]); err != nil {
+		return nil, "", err
+	}
+	return user, args[0], nil
+}
+
+/**
+The emails of the users watching an asset.
+ */
+func getWatchers(stub shim.ChaincodeStubInterface, assetId string) ([]string, error) {
+	watchersIterator, err := stub.GetStateByPartialCompositeKey(COMPOSITE_KEY_ASSET_WATCHER, []string{assetId})
+	if err != nil {
+		return nil, err
+	}
+	defer watchersIterator.Close()
+
+	var watchers []string
+	for watchersIterator.HasNext() {
+		responseRange, err := watchersIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		//asset~watcher is {asset}{watcher}
+		_, keyParts, err := stub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, err
+		}
+		watchers = append(watchers, keyParts[1])
+	}
+	return watchers, nil
+}
+
+/**
+The status of an auction at the given time, using the same names as the status filter of searchAssets.
+ */
+func getAssetStatus(assetObj *Asset, now time.Time) string {
+	switch {
+	case assetObj.IsSold:
+		return "sold"
+	case assetObj.BidStart != nil && now.Before(*assetObj.BidStart):
+		return "upcoming"
+	case assetObj.BidEnd != nil && !now.Before(*assetObj.BidEnd):
+		return "ended"
+	default:
+		return "open"
+	}
+}
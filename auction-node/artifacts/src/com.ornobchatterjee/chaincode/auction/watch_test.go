@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+/**
+Run notifyClosingSoon at the current time and return the assets it reported, checking that each has an event.
+ */
+func (f *auctionFixture) notifyClosingSoon() []ClosingSoonEvent {
+	f.t.Helper()
+	var closingSoon []ClosingSoonEvent
+	response := decodeEntity(f.t, f.mustInvoke(f.house, "notifyClosingSoon", f.now.Format(time.RFC3339)), &closingSoon)
+	if len(response.Events) != len(closingSoon) {
+		f.t.Fatalf("%v assets end soon but %v events were raised", len(closingSoon), len(response.Events))
+	}
+	for _, event := range response.Events {
+		if event.Type != EVENT_CLOSING_SOON {
+			f.t.Fatalf("notifyClosingSoon raised a %v event", event.Type)
+		}
+	}
+	return closingSoon
+}
+
+func TestNotifyClosingSoon(t *testing.T) {
+	f := newAuctionFixture(t)
+	//bidding opens at 10:00, the vase closes at 10:30 and the lamp at 13:00
+	vase := f.addAsset(f.alice, "Vase", "100", 30*time.Minute)
+	lamp := f.addAsset(f.alice, "Lamp", "100", 3*time.Hour)
+	f.mustInvoke(f.carol, "watchAsset", vase)
+
+	f.expectErrorCode(ERROR_UNAUTHORIZED, "", f.alice, "notifyClosingSoon", f.now.Format(time.RFC3339))
+	f.expectErrorCode(ERROR_OUT_OF_RANGE, "minutes", f.house, "notifyClosingSoon", f.now.Format(time.RFC3339), "0")
+
+	if closingSoon := f.notifyClosingSoon(); len(closingSoon) != 0 {
+		t.Fatalf("at 9:00 %+v end within the hour", closingSoon)
+	}
+
+	f.advance(time.Hour)
+	if response := f.placeBid(f.bob, vase, "120"); response.Status != 200 {
+		t.Fatalf("bid failed : %v", response.Message)
+	}
+	closingSoon := f.notifyClosingSoon()
+	if len(closingSoon) != 1 || closingSoon[0].AssetId != vase || closingSoon[0].HighBid.String() != "120.00" ||
+		strings.Join(closingSoon[0].Bidders, ",") != f.bob.email || strings.Join(closingSoon[0].Watchers, ",") != f.carol.email {
+		t.Fatalf("at 10:00 the assets ending soon are %+v", closingSoon)
+	}
+
+	//every asset is reported once however often the auction house asks
+	for i := 0; i < 3; i++ {
+		f.advance(5 * time.Minute)
+		if closingSoon := f.notifyClosingSoon(); len(closingSoon) != 0 {
+			t.Fatalf("the vase is reported again : %+v", closingSoon)
+		}
+	}
+
+	//until its auction is extended
+	f.mustInvoke(f.house, "extendAuction", vase, time.Date(2018, 10, 1, 12, 30, 0, 0, time.UTC).Format(time.RFC3339))
+	f.now = time.Date(2018, 10, 1, 11, 45, 0, 0, time.UTC)
+	if closingSoon := f.notifyClosingSoon(); len(closingSoon) != 1 || closingSoon[0].AssetId != vase {
+		t.Fatalf("at 11:45 the assets ending soon are %+v", closingSoon)
+	}
+	f.advance(25 * time.Minute)
+	if closingSoon := f.notifyClosingSoon(); len(closingSoon) != 1 || closingSoon[0].AssetId != lamp || len(closingSoon[0].Bidders) != 0 {
+		t.Fatalf("at 12:10 the assets ending soon are %+v", closingSoon)
+	}
+	if closingSoon := f.notifyClosingSoon(); len(closingSoon) != 0 {
+		t.Fatalf("the lamp is reported again : %+v", closingSoon)
+	}
+}
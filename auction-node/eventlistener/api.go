@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// API serves the projection over HTTP:
+//
+//	GET /assets?status=open|ended|sold&seller=&owner=&category=&bidder=
+//	GET /assets/{assetId}
+//	GET /assets/{assetId}/bids
+//	GET /settlements?seller=&winner=
+//	GET /balances/{email}
+//	GET /checkpoint
+type API struct {
+	store *Store
+	now   func() time.Time
+}
+
+func NewAPI(store *Store) *API {
+	return &API{store, time.Now}
+}
+
+func (a *API) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/assets", a.getAssets)
+	mux.HandleFunc("/assets/", a.getAsset)
+	mux.HandleFunc("/settlements", a.getSettlements)
+	mux.HandleFunc("/balances/", a.getBalances)
+	mux.HandleFunc("/checkpoint", a.getCheckpoint)
+	return mux
+}
+
+func (a *API) getAssets(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	status := query.Get("status")
+	if status != "" && status != "open" && status != "ended" && status != "sold" {
+		writeError(w, http.StatusBadRequest, "status must be open, ended or sold")
+		return
+	}
+	var bidAssets map[string]bool
+	if bidder := query.Get("bidder"); bidder != "" {
+		var err error
+		if bidAssets, err = a.bidderAssets(bidder); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	now := a.now()
+	assets, err := a.store.Assets(func(asset *AssetView) bool {
+		switch {
+		case !matches(query.Get("seller"), asset.Seller),
+			!matches(query.Get("owner"), asset.Owner),
+			!matches(query.Get("category"), asset.Category),
+			bidAssets != nil && !bidAssets[asset.AssetId]:
+			return false
+		}
+		ended := asset.BidEnd != nil && !now.Before(*asset.BidEnd)
+		switch status {
+		case "open":
+			return !asset.IsSold && !ended
+		case "ended":
+			return !asset.IsSold && ended
+		case "sold":
+			return asset.IsSold
+		}
+		return true
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, assets)
+}
+
+func (a *API) getAsset(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/assets/"), "/")
+	assetId := path[0]
+	switch {
+	case len(path) == 1 && assetId != "":
+		asset, err := a.store.Asset(assetId)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+		} else if asset == nil {
+			writeError(w, http.StatusNotFound, "asset "+assetId+" is not found")
+		} else {
+			writeJSON(w, asset)
+		}
+	case len(path) == 2 && assetId != "" && path[1] == "bids":
+		bids, err := a.store.Bids(assetId)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, bids)
+	default:
+		writeError(w, http.StatusNotFound, "unknown path "+r.URL.Path)
+	}
+}
+
+func (a *API) getSettlements(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	settlements, err := a.store.Settlements(func(settlement *SettlementView) bool {
+		return matches(query.Get("seller"), settlement.Seller) && matches(query.Get("winner"), settlement.Winner)
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, settlements)
+}
+
+func (a *API) getBalances(w http.ResponseWriter, r *http.Request) {
+	email := strings.TrimPrefix(r.URL.Path, "/balances/")
+	balances, err := a.store.Balances(email)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+	} else if len(balances) == 0 {
+		writeError(w, http.StatusNotFound, "no balance change seen for "+email)
+	} else {
+		writeJSON(w, balances)
+	}
+}
+
+func (a *API) getCheckpoint(w http.ResponseWriter, r *http.Request) {
+	checkpoint, err := a.store.Checkpoint()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, checkpoint)
+}
+
+func (a *API) bidderAssets(bidder string) (map[string]bool, error) {
+	assets, err := a.store.Assets(func(asset *AssetView) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	bidAssets := make(map[string]bool)
+	for _, asset := range assets {
+		bids, err := a.store.Bids(asset.AssetId)
+		if err != nil {
+			return nil, err
+		}
+		for _, bid := range bids {
+			if bid.Bidder == bidder {
+				bidAssets[asset.AssetId] = true
+			}
+		}
+	}
+	return bidAssets, nil
+}
+
+func matches(want string, value string) bool {
+	return want == "" || want == value
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(value); err != nil {
+		Logger.Printf("[ API ] - writing the response failed : %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
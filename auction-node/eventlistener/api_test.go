@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+/**
+GET path from the API and decode the response into value. Returns the status code.
+ */
+func get(t *testing.T, api *API, path string, value interface{}) int {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	api.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	if err := json.Unmarshal(recorder.Body.Bytes(), value); err != nil {
+		t.Fatalf("GET %v returned %q : %v", path, recorder.Body.String(), err)
+	}
+	return recorder.Code
+}
+
+func TestAPI(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	store := openTestStore(t, dir)
+	defer store.Close()
+	api := NewAPI(store)
+
+	//up to the extension, the auction ends at 12:00
+	replay(t, store, sampleEvents(t, dir, 4))
+	for _, c := range []struct {
+		now    time.Time
+		status string
+		count  int
+	}{
+		{time.Date(2018, 10, 2, 11, 0, 0, 0, time.UTC), "open", 1},
+		{time.Date(2018, 10, 2, 11, 0, 0, 0, time.UTC), "ended", 0},
+		{time.Date(2018, 10, 2, 12, 0, 0, 0, time.UTC), "open", 0},
+		{time.Date(2018, 10, 2, 12, 0, 0, 0, time.UTC), "ended", 1},
+		{time.Date(2018, 10, 2, 12, 0, 0, 0, time.UTC), "sold", 0},
+	} {
+		api.now = func() time.Time { return c.now }
+		var assets []AssetView
+		if code := get(t, api, "/assets?status="+c.status, &assets); code != http.StatusOK || len(assets) != c.count {
+			t.Errorf("at %v %v assets are %v %+v", c.now, c.status, code, assets)
+		}
+	}
+
+	replay(t, store, "sample-events.jsonl")
+	for path, count := range map[string]int{
+		"/assets":                                             1,
+		"/assets?status=sold":                                 1,
+		"/assets?status=ended":                                0,
+		"/assets?owner=bob@example.com":                       1,
+		"/assets?seller=bob@example.com":                      0,
+		"/assets?category=paintings&bidder=alice@example.com": 1,
+		"/assets?bidder=carol@example.com":                    0,
+	} {
+		var assets []AssetView
+		if code := get(t, api, path, &assets); code != http.StatusOK || len(assets) != count {
+			t.Errorf("GET %v is %v %+v, want %v assets", path, code, assets, count)
+		}
+	}
+
+	var asset AssetView
+	if code := get(t, api, "/assets/"+SAMPLE_ASSET, &asset); code != http.StatusOK || asset.Owner != "bob@example.com" || !asset.IsSold {
+		t.Errorf("asset is %v %+v", code, asset)
+	}
+	var bids []BidView
+	if code := get(t, api, "/assets/"+SAMPLE_ASSET+"/bids", &bids); code != http.StatusOK || len(bids) != 2 {
+		t.Errorf("bids are %v %+v", code, bids)
+	}
+	var settlements []SettlementView
+	if code := get(t, api, "/settlements?winner=bob@example.com", &settlements); code != http.StatusOK ||
+		len(settlements) != 1 || settlements[0].HammerPrice != "150.00" {
+		t.Errorf("settlements won by bob are %v %+v", code, settlements)
+	}
+	if code := get(t, api, "/settlements?seller=alice@example.com", &settlements); code != http.StatusOK || len(settlements) != 0 {
+		t.Errorf("settlements of alice are %v %+v", code, settlements)
+	}
+	var balances []BalanceView
+	if code := get(t, api, "/balances/bob@example.com", &balances); code != http.StatusOK ||
+		len(balances) != 1 || balances[0].Balance != "850.00" {
+		t.Errorf("balances of bob are %v %+v", code, balances)
+	}
+	var checkpoint Checkpoint
+	if code := get(t, api, "/checkpoint", &checkpoint); code != http.StatusOK || checkpoint.BlockNumber != 12 || !checkpoint.TxIds["tx-close"] {
+		t.Errorf("checkpoint is %v %+v", code, checkpoint)
+	}
+
+	for path, want := range map[string]int{
+		"/assets?status=closed":                 http.StatusBadRequest,
+		"/assets/nothing":                       http.StatusNotFound,
+		"/assets/":                              http.StatusNotFound,
+		"/assets/" + SAMPLE_ASSET + "/watchers": http.StatusNotFound,
+		"/balances/carol@example.com":           http.StatusNotFound,
+	} {
+		var response map[string]string
+		if code := get(t, api, path, &response); code != want || len(response["error"]) == 0 {
+			t.Errorf("GET %v is %v %v, want %v", path, code, response, want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// The chaincode sets a single event of this name per transaction, see
+// artifacts/src/com.ornobchatterjee/chaincode/auction/events.go
+const (
+	EVENT_NAME             = "AuctionEvents"
+	EVENT_ENVELOPE_VERSION = 1
+)
+
+const (
+	EVENT_ASSET_LISTED      = "AssetListed"
+	EVENT_BID_PLACED        = "BidPlaced"
+	EVENT_AUCTION_EXTENDED  = "AuctionExtended"
+	EVENT_AUCTION_CLOSED    = "AuctionClosed"
+	EVENT_ASSET_TRANSFERRED = "AssetTransferred"
+	EVENT_BALANCE_CHANGED   = "BalanceChanged"
+	EVENT_CLOSING_SOON      = "ClosingSoon"
+)
+
+// The newest payload version of every event type this projection understands.
+// Events of a newer version are skipped rather than misread.
+var eventVersions = map[string]int{
+	EVENT_ASSET_LISTED:      1,
+	EVENT_BID_PLACED:        1,
+	EVENT_AUCTION_EXTENDED:  1,
+	EVENT_AUCTION_CLOSED:    1,
+	EVENT_ASSET_TRANSFERRED: 1,
+	EVENT_BALANCE_CHANGED:   1,
+	EVENT_CLOSING_SOON:      1,
+}
+
+// BlockEvent is a chaincode event together with the block that committed it.
+type BlockEvent struct {
+	BlockNumber uint64          `json:"blockNumber"`
+	TxId        string          `json:"txId"`
+	EventName   string          `json:"eventName"`
+	Payload     json.RawMessage `json:"payload"`
+}
+
+type EventEnvelope struct {
+	Version   int              `json:"version"`
+	TxId      string           `json:"txId,omitempty"`
+	Timestamp *time.Time       `json:"timestamp,omitempty"`
+	Events    []ChaincodeEvent `json:"events"`
+}
+
+type ChaincodeEvent struct {
+	Type    string          `json:"type"`
+	Version int             `json:"version"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Amount is an amount as the chaincode encodes it, a decimal string with the
+// decimal places of its currency such as "12.50". It is stored and served
+// exactly as it arrived and only parsed to compare bids.
+type Amount string
+
+func (a *Amount) UnmarshalText(text []byte) error {
+	if _, ok := new(big.Rat).SetString(string(text)); !ok {
+		return fmt.Errorf("%q is not an amount", text)
+	}
+	*a = Amount(text)
+	return nil
+}
+
+// Cmp compares the values of two amounts, so "150" and "150.00" are equal.
+func (a Amount) Cmp(other Amount) int {
+	return a.rat().Cmp(other.rat())
+}
+
+//amounts were checked when they were read, so anything else is treated as zero
+func (a Amount) rat() *big.Rat {
+	if value, ok := new(big.Rat).SetString(string(a)); ok {
+		return value
+	}
+	return new(big.Rat)
+}
+
+type AssetListedEvent struct {
+	AssetId  string     `json:"assetId,omitempty"`
+	Name     string     `json:"name,omitempty"`
+	Seller   string     `json:"seller,omitempty"`
+	Category string     `json:"category,omitempty"`
+	Price    Amount     `json:"price,omitempty"`
+	Currency string     `json:"currency,omitempty"`
+	BidStart *time.Time `json:"bidStart,omitempty"`
+	BidEnd   *time.Time `json:"bidEnd,omitempty"`
+}
+
+type BidPlacedEvent struct {
+	AssetId        string   `json:"assetId,omitempty"`
+	Bidder         string   `json:"bidder,omitempty"`
+	BidAmount      Amount   `json:"bidAmount,omitempty"`
+	Currency       string   `json:"currency,omitempty"`
+	IsLeading      bool     `json:"isLeading"`
+	PreviousLeader string   `json:"previousLeader,omitempty"`
+	PreviousBid    Amount   `json:"previousBid,omitempty"`
+	Watchers       []string `json:"watchers,omitempty"`
+}
+
+type AuctionExtendedEvent struct {
+	AssetId        string     `json:"assetId,omitempty"`
+	PreviousBidEnd *time.Time `json:"previousBidEnd,omitempty"`
+	BidEnd         *time.Time `json:"bidEnd,omitempty"`
+	Watchers       []string   `json:"watchers,omitempty"`
+}
+
+type AuctionClosedEvent struct {
+	AssetId     string `json:"assetId,omitempty"`
+	Seller      string `json:"seller,omitempty"`
+	Winner      string `json:"winner,omitempty"`
+	HammerPrice Amount `json:"hammerPrice,omitempty"`
+	Currency    string `json:"currency,omitempty"`
+	BidderCount int    `json:"bidderCount"`
+}
+
+type AssetTransferredEvent struct {
+	AssetId   string `json:"assetId,omitempty"`
+	From      string `json:"from,omitempty"`
+	To        string `json:"to,omitempty"`
+	SalePrice Amount `json:"salePrice,omitempty"`
+}
+
+type BalanceChangedEvent struct {
+	Email           string `json:"email,omitempty"`
+	Currency        string `json:"currency,omitempty"`
+	PreviousBalance Amount `json:"previousBalance,omitempty"`
+	Balance         Amount `json:"balance,omitempty"`
+	Reason          string `json:"reason,omitempty"`
+	AssetId         string `json:"assetId,omitempty"`
+}
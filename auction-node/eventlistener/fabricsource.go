@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/event"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/events/deliverclient/seek"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+)
+
+// FabricSource subscribes to the chaincode events of a channel through a peer's
+// deliver service. Chaincode event payloads are only delivered with full block
+// events, so the client asks for those rather than filtered blocks.
+type FabricSource struct {
+	sdk          *fabsdk.FabricSDK
+	channelId    string
+	chaincodeId  string
+	user         string
+	org          string
+	client       *event.Client
+	registration fab.Registration
+}
+
+func NewFabricSource(configPath string, channelId string, chaincodeId string, user string, org string) (*FabricSource, error) {
+	sdk, err := fabsdk.New(config.FromFile(configPath))
+	if err != nil {
+		return nil, fmt.Errorf("creating the Fabric SDK failed : %v", err)
+	}
+	return &FabricSource{sdk: sdk, channelId: channelId, chaincodeId: chaincodeId, user: user, org: org}, nil
+}
+
+func (s *FabricSource) Subscribe(fromBlock uint64) (<-chan *BlockEvent, error) {
+	channelContext := s.sdk.ChannelContext(s.channelId, fabsdk.WithUser(s.user), fabsdk.WithOrg(s.org))
+	client, err := event.New(channelContext, event.WithBlockEvents(), event.WithSeekType(seek.FromBlock), event.WithBlockNum(fromBlock))
+	if err != nil {
+		return nil, fmt.Errorf("creating the event client failed : %v", err)
+	}
+	registration, ccEvents, err := client.RegisterChaincodeEvent(s.chaincodeId, EVENT_NAME)
+	if err != nil {
+		return nil, fmt.Errorf("registering for events of %v failed : %v", s.chaincodeId, err)
+	}
+	s.client, s.registration = client, registration
+
+	events := make(chan *BlockEvent)
+	go func() {
+		defer close(events)
+		for ccEvent := range ccEvents {
+			events <- &BlockEvent{ccEvent.BlockNumber, ccEvent.TxID, ccEvent.EventName, ccEvent.Payload}
+		}
+	}()
+	return events, nil
+}
+
+func (s *FabricSource) Close() {
+	if s.client != nil {
+		s.client.Unregister(s.registration)
+	}
+	s.sdk.Close()
+}
+
+func (s *FabricSource) String() string {
+	return fmt.Sprintf("chaincode %v on channel %v", s.chaincodeId, s.channelId)
+}
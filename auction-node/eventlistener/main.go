@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+var Logger = log.New(os.Stderr, "auction-listener ", log.LstdFlags)
+
+/**
+Projects the auction chaincode events into a local BoltDB read model and serves it over HTTP. The events come from
+the peers through the Fabric Go SDK, or from a file of recorded events when -events is given.
+ */
+func main() {
+	dbPath := flag.String("db", "auction-projection.db", "BoltDB file holding the projection")
+	listen := flag.String("listen", ":4100", "address of the HTTP query API")
+	eventsFile := flag.String("events", "", "replay events from this file instead of subscribing to the peers")
+	configPath := flag.String("config", "../artifacts/network-config.yaml", "Fabric SDK connection profile")
+	channelId := flag.String("channel", "mychannel", "channel of the auction chaincode")
+	chaincodeId := flag.String("chaincode", "mycc", "name of the auction chaincode")
+	user := flag.String("user", "User1", "identity used to connect to the peers")
+	org := flag.String("org", "Org2", "organization of the identity")
+	flag.Parse()
+
+	store, err := OpenStore(*dbPath)
+	if err != nil {
+		Logger.Fatalf("opening %v failed : %v", *dbPath, err)
+	}
+	defer store.Close()
+
+	var source EventSource
+	if len(*eventsFile) > 0 {
+		source = NewFileSource(*eventsFile)
+	} else if source, err = NewFabricSource(*configPath, *channelId, *chaincodeId, *user, *org); err != nil {
+		Logger.Fatal(err)
+	}
+	defer source.Close()
+
+	checkpoint, err := store.Checkpoint()
+	if err != nil {
+		Logger.Fatalf("reading the checkpoint failed : %v", err)
+	}
+	//the checkpoint block is delivered again, the transactions of it that were applied are skipped
+	events, err := source.Subscribe(checkpoint.BlockNumber)
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	Logger.Printf("projecting events of %v from block %v", source, checkpoint.BlockNumber)
+
+	server := &http.Server{Addr: *listen, Handler: NewAPI(store).Handler()}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			Logger.Fatalf("HTTP API failed : %v", err)
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				//a replayed file has run out, keep serving what was projected
+				Logger.Printf("event source %v has no more events", source)
+				events = nil
+				continue
+			}
+			if err := project(store, event); err != nil {
+				Logger.Fatalf("projecting block %v failed : %v", event.BlockNumber, err)
+			}
+		case <-signals:
+			server.Close()
+			return
+		}
+	}
+}
+
+func project(store *Store, event *BlockEvent) error {
+	if event.EventName != EVENT_NAME {
+		return nil
+	}
+	var envelope EventEnvelope
+	if err := json.Unmarshal(event.Payload, &envelope); err != nil {
+		return fmt.Errorf("tx %v has an unreadable envelope : %v", event.TxId, err)
+	}
+	if envelope.Version > EVENT_ENVELOPE_VERSION {
+		return fmt.Errorf("tx %v has envelope version %v, this listener reads up to %v", event.TxId, envelope.Version, EVENT_ENVELOPE_VERSION)
+	}
+	applied, err := store.Apply(event, &envelope)
+	if err != nil {
+		return err
+	}
+	if applied {
+		Logger.Printf("block %v tx %v : %v events", event.BlockNumber, event.TxId, len(envelope.Events))
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// EventSource delivers the chaincode events committed in fromBlock and the
+// blocks after it, in commit order. The channel is closed when the source has
+// no more events to give.
+type EventSource interface {
+	Subscribe(fromBlock uint64) (<-chan *BlockEvent, error)
+	Close()
+}
+
+// FileSource replays events recorded one JSON BlockEvent per line, so that the
+// projection and the query API can be run without a Fabric network.
+type FileSource struct {
+	path string
+	done chan struct{}
+}
+
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path, done: make(chan struct{})}
+}
+
+func (s *FileSource) Subscribe(fromBlock uint64) (<-chan *BlockEvent, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	events := make(chan *BlockEvent)
+	go func() {
+		defer file.Close()
+		defer close(events)
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+			var event BlockEvent
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				Logger.Printf("[ FileSource ] - %v line %v skipped : %v", s.path, line, err)
+				continue
+			}
+			if event.BlockNumber < fromBlock {
+				continue
+			}
+			select {
+			case events <- &event:
+			case <-s.done:
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			Logger.Printf("[ FileSource ] - reading %v failed : %v", s.path, err)
+		}
+	}()
+	return events, nil
+}
+
+func (s *FileSource) Close() {
+	close(s.done)
+}
+
+func (s *FileSource) String() string {
+	return fmt.Sprintf("file %v", s.path)
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	BUCKET_ASSETS      = []byte("assets")
+	BUCKET_BIDS        = []byte("bids")
+	BUCKET_SETTLEMENTS = []byte("settlements")
+	BUCKET_BALANCES    = []byte("balances")
+	BUCKET_CHECKPOINT  = []byte("checkpoint")
+
+	CHECKPOINT_BLOCK = []byte("block")
+	CHECKPOINT_TXS   = []byte("txs")
+)
+
+const DEFAULT_CURRENCY = "USD"
+
+// AssetView is the projected state of an asset and its auction.
+type AssetView struct {
+	AssetId    string     `json:"assetId"`
+	Name       string     `json:"name,omitempty"`
+	Seller     string     `json:"seller,omitempty"`
+	Owner      string     `json:"owner,omitempty"`
+	Category   string     `json:"category,omitempty"`
+	Price      Amount     `json:"price,omitempty"`
+	Currency   string     `json:"currency,omitempty"`
+	BidStart   *time.Time `json:"bidStart,omitempty"`
+	BidEnd     *time.Time `json:"bidEnd,omitempty"`
+	HighBid    Amount     `json:"highBid,omitempty"`
+	HighBidder string     `json:"highBidder,omitempty"`
+	Bidders    int        `json:"bidders"`
+	IsSold     bool       `json:"isSold"`
+	SoldPrice  Amount     `json:"soldPrice,omitempty"`
+	ListedAt   *time.Time `json:"listedAt,omitempty"`
+}
+
+// BidView is the latest bid of a bidder on an asset.
+type BidView struct {
+	AssetId   string     `json:"assetId"`
+	Bidder    string     `json:"bidder"`
+	BidAmount Amount     `json:"bidAmount,omitempty"`
+	TxId      string     `json:"txId,omitempty"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+}
+
+type SettlementView struct {
+	AssetId     string     `json:"assetId"`
+	Seller      string     `json:"seller,omitempty"`
+	Winner      string     `json:"winner,omitempty"`
+	HammerPrice Amount     `json:"hammerPrice,omitempty"`
+	Currency    string     `json:"currency,omitempty"`
+	BidderCount int        `json:"bidderCount"`
+	TxId        string     `json:"txId,omitempty"`
+	BlockNumber uint64     `json:"blockNumber"`
+	Timestamp   *time.Time `json:"timestamp,omitempty"`
+}
+
+// BalanceView is the latest balance of a user in one currency.
+type BalanceView struct {
+	Email     string     `json:"email"`
+	Currency  string     `json:"currency"`
+	Balance   Amount     `json:"balance,omitempty"`
+	TxId      string     `json:"txId,omitempty"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+}
+
+// Checkpoint is the last block the projection has seen and the transactions of
+// that block it has applied. A block can be delivered again after a restart,
+// so transactions already applied are skipped.
+type Checkpoint struct {
+	BlockNumber uint64          `json:"blockNumber"`
+	TxIds       map[string]bool `json:"txIds"`
+}
+
+// Store keeps the projection in a BoltDB file. Every transaction is applied
+// together with the checkpoint in a single bolt transaction, so the two never
+// disagree.
+type Store struct {
+	db *bolt.DB
+}
+
+func OpenStore(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{BUCKET_ASSETS, BUCKET_BIDS, BUCKET_SETTLEMENTS, BUCKET_BALANCES, BUCKET_CHECKPOINT} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) Checkpoint() (*Checkpoint, error) {
+	var checkpoint *Checkpoint
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		checkpoint, err = getCheckpoint(tx)
+		return err
+	})
+	return checkpoint, err
+}
+
+/**
+Apply the events of one transaction. Returns false when the transaction was applied before.
+ */
+func (s *Store) Apply(blockEvent *BlockEvent, envelope *EventEnvelope) (bool, error) {
+	applied := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		checkpoint, err := getCheckpoint(tx)
+		if err != nil {
+			return err
+		}
+		if blockEvent.BlockNumber < checkpoint.BlockNumber || checkpoint.TxIds[blockEvent.TxId] {
+			return nil
+		}
+		for i, event := range envelope.Events {
+			if err = applyEvent(tx, blockEvent, envelope, &event); err != nil {
+				return fmt.Errorf("event %v (%v) of tx %v : %v", i, event.Type, blockEvent.TxId, err)
+			}
+		}
+		if blockEvent.BlockNumber > checkpoint.BlockNumber {
+			checkpoint = &Checkpoint{blockEvent.BlockNumber, make(map[string]bool)}
+		}
+		checkpoint.TxIds[blockEvent.TxId] = true
+		applied = true
+		return putCheckpoint(tx, checkpoint)
+	})
+	return applied, err
+}
+
+func applyEvent(tx *bolt.Tx, blockEvent *BlockEvent, envelope *EventEnvelope, event *ChaincodeEvent) error {
+	latest, known := eventVersions[event.Type]
+	if !known || event.Version > latest {
+		Logger.Printf("[ Store ] - skipping %v event version %v of tx %v", event.Type, event.Version, blockEvent.TxId)
+		return nil
+	}
+
+	switch event.Type {
+	case EVENT_ASSET_LISTED:
+		var listed AssetListedEvent
+		if err := json.Unmarshal(event.Payload, &listed); err != nil {
+			return err
+		}
+		asset := AssetView{
+			AssetId:  listed.AssetId,
+			Name:     listed.Name,
+			Seller:   listed.Seller,
+			Owner:    listed.Seller,
+			Category: listed.Category,
+			Price:    listed.Price,
+			Currency: currencyOf(listed.Currency),
+			BidStart: listed.BidStart,
+			BidEnd:   listed.BidEnd,
+			ListedAt: envelope.Timestamp,
+		}
+		return putJSON(tx, BUCKET_ASSETS, []byte(asset.AssetId), &asset)
+
+	case EVENT_BID_PLACED:
+		var placed BidPlacedEvent
+		if err := json.Unmarshal(event.Payload, &placed); err != nil {
+			return err
+		}
+		bid := BidView{placed.AssetId, placed.Bidder, placed.BidAmount, blockEvent.TxId, envelope.Timestamp}
+		if err := putJSON(tx, BUCKET_BIDS, bidKey(placed.AssetId, placed.Bidder), &bid); err != nil {
+			return err
+		}
+		return updateAsset(tx, placed.AssetId, func(asset *AssetView) error {
+			return refreshHighBid(tx, asset)
+		})
+
+	case EVENT_AUCTION_EXTENDED:
+		var extended AuctionExtendedEvent
+		if err := json.Unmarshal(event.Payload, &extended); err != nil {
+			return err
+		}
+		return updateAsset(tx, extended.AssetId, func(asset *AssetView) error {
+			asset.BidEnd = extended.BidEnd
+			return nil
+		})
+
+	case EVENT_AUCTION_CLOSED:
+		var closed AuctionClosedEvent
+		if err := json.Unmarshal(event.Payload, &closed); err != nil {
+			return err
+		}
+		settlement := SettlementView{
+			AssetId:     closed.AssetId,
+			Seller:      closed.Seller,
+			Winner:      closed.Winner,
+			HammerPrice: closed.HammerPrice,
+			Currency:    currencyOf(closed.Currency),
+			BidderCount: closed.BidderCount,
+			TxId:        blockEvent.TxId,
+			BlockNumber: blockEvent.BlockNumber,
+			Timestamp:   envelope.Timestamp,
+		}
+		if err := putJSON(tx, BUCKET_SETTLEMENTS, []byte(closed.AssetId), &settlement); err != nil {
+			return err
+		}
+		return updateAsset(tx, closed.AssetId, func(asset *AssetView) error {
+			asset.IsSold = true
+			asset.SoldPrice = closed.HammerPrice
+			return nil
+		})
+
+	case EVENT_ASSET_TRANSFERRED:
+		var transferred AssetTransferredEvent
+		if err := json.Unmarshal(event.Payload, &transferred); err != nil {
+			return err
+		}
+		return updateAsset(tx, transferred.AssetId, func(asset *AssetView) error {
+			asset.Owner = transferred.To
+			return nil
+		})
+
+	case EVENT_BALANCE_CHANGED:
+		var changed BalanceChangedEvent
+		if err := json.Unmarshal(event.Payload, &changed); err != nil {
+			return err
+		}
+		balance := BalanceView{changed.Email, currencyOf(changed.Currency), changed.Balance, blockEvent.TxId, envelope.Timestamp}
+		return putJSON(tx, BUCKET_BALANCES, balanceKey(balance.Email, balance.Currency), &balance)
+	}
+	//ClosingSoon is only of interest to notifications
+	return nil
+}
+
+/**
+Load an asset, let update change it and store it again. Events for assets listed before the projection started are
+applied to an empty view, so the view fills in as events arrive.
+ */
+func updateAsset(tx *bolt.Tx, assetId string, update func(asset *AssetView) error) error {
+	asset := AssetView{AssetId: assetId}
+	if _, err := getJSON(tx, BUCKET_ASSETS, []byte(assetId), &asset); err != nil {
+		return err
+	}
+	if err := update(&asset); err != nil {
+		return err
+	}
+	return putJSON(tx, BUCKET_ASSETS, []byte(assetId), &asset)
+}
+
+/**
+Work the high bid out again from the latest bid of every bidder. Like the chaincode, the first of two equal bids in
+bidder order wins.
+ */
+func refreshHighBid(tx *bolt.Tx, asset *AssetView) error {
+	asset.HighBid, asset.HighBidder, asset.Bidders = "", "", 0
+	prefix := bidKey(asset.AssetId, "")
+	cursor := tx.Bucket(BUCKET_BIDS).Cursor()
+	for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+		var bid BidView
+		if err := json.Unmarshal(value, &bid); err != nil {
+			return err
+		}
+		asset.Bidders++
+		if len(bid.BidAmount) > 0 && (len(asset.HighBid) == 0 || bid.BidAmount.Cmp(asset.HighBid) > 0) {
+			asset.HighBid, asset.HighBidder = bid.BidAmount, bid.Bidder
+		}
+	}
+	return nil
+}
+
+func bidKey(assetId string, bidder string) []byte {
+	return []byte(assetId + "\x00" + bidder)
+}
+
+func balanceKey(email string, currency string) []byte {
+	return []byte(email + "\x00" + currency)
+}
+
+/**
+Events written before balances were kept per currency carry no currency and are in dollars, like in the chaincode.
+ */
+func currencyOf(code string) string {
+	if len(code) == 0 {
+		return DEFAULT_CURRENCY
+	}
+	return code
+}
+
+func getCheckpoint(tx *bolt.Tx) (*Checkpoint, error) {
+	bucket := tx.Bucket(BUCKET_CHECKPOINT)
+	checkpoint := Checkpoint{TxIds: make(map[string]bool)}
+	if blockBytes := bucket.Get(CHECKPOINT_BLOCK); blockBytes != nil {
+		checkpoint.BlockNumber = binary.BigEndian.Uint64(blockBytes)
+	}
+	if txsBytes := bucket.Get(CHECKPOINT_TXS); txsBytes != nil {
+		if err := json.Unmarshal(txsBytes, &checkpoint.TxIds); err != nil {
+			return nil, err
+		}
+	}
+	return &checkpoint, nil
+}
+
+func putCheckpoint(tx *bolt.Tx, checkpoint *Checkpoint) error {
+	bucket := tx.Bucket(BUCKET_CHECKPOINT)
+	blockBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(blockBytes, checkpoint.BlockNumber)
+	if err := bucket.Put(CHECKPOINT_BLOCK, blockBytes); err != nil {
+		return err
+	}
+	txsBytes, err := json.Marshal(checkpoint.TxIds)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(CHECKPOINT_TXS, txsBytes)
+}
+
+func putJSON(tx *bolt.Tx, bucket []byte, key []byte, value interface{}) error {
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucket).Put(key, valueBytes)
+}
+
+func getJSON(tx *bolt.Tx, bucket []byte, key []byte, value interface{}) (bool, error) {
+	valueBytes := tx.Bucket(bucket).Get(key)
+	if valueBytes == nil {
+		return false, nil
+	}
+	return true, json.Unmarshal(valueBytes, value)
+}
+
+/**
+The assets that pass the filter, in asset id order.
+ */
+func (s *Store) Assets(filter func(asset *AssetView) bool) ([]AssetView, error) {
+	assets := make([]AssetView, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(BUCKET_ASSETS).ForEach(func(key []byte, value []byte) error {
+			var asset AssetView
+			if err := json.Unmarshal(value, &asset); err != nil {
+				return err
+			}
+			if filter(&asset) {
+				assets = append(assets, asset)
+			}
+			return nil
+		})
+	})
+	return assets, err
+}
+
+func (s *Store) Asset(assetId string) (*AssetView, error) {
+	var asset *AssetView
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var view AssetView
+		found, err := getJSON(tx, BUCKET_ASSETS, []byte(assetId), &view)
+		if found {
+			asset = &view
+		}
+		return err
+	})
+	return asset, err
+}
+
+func (s *Store) Bids(assetId string) ([]BidView, error) {
+	bids := make([]BidView, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		prefix := bidKey(assetId, "")
+		cursor := tx.Bucket(BUCKET_BIDS).Cursor()
+		for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+			var bid BidView
+			if err := json.Unmarshal(value, &bid); err != nil {
+				return err
+			}
+			bids = append(bids, bid)
+		}
+		return nil
+	})
+	return bids, err
+}
+
+func (s *Store) Settlements(filter func(settlement *SettlementView) bool) ([]SettlementView, error) {
+	settlements := make([]SettlementView, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(BUCKET_SETTLEMENTS).ForEach(func(key []byte, value []byte) error {
+			var settlement SettlementView
+			if err := json.Unmarshal(value, &settlement); err != nil {
+				return err
+			}
+			if filter(&settlement) {
+				settlements = append(settlements, settlement)
+			}
+			return nil
+		})
+	})
+	return settlements, err
+}
+
+/**
+The balances of a user in currency order.
+ */
+func (s *Store) Balances(email string) ([]BalanceView, error) {
+	balances := make([]BalanceView, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		prefix := balanceKey(email, "")
+		cursor := tx.Bucket(BUCKET_BALANCES).Cursor()
+		for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+			var balance BalanceView
+			if err := json.Unmarshal(value, &balance); err != nil {
+				return err
+			}
+			balances = append(balances, balance)
+		}
+		return nil
+	})
+	return balances, err
+}
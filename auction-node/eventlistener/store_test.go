@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const SAMPLE_ASSET = "4f1c9a0e6b2d"
+
+/**
+Make a directory for the projection and the events of a test. The caller removes it.
+ */
+func testDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "auction-listener")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func openTestStore(t *testing.T, dir string) *Store {
+	t.Helper()
+	store, err := OpenStore(filepath.Join(dir, "projection.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+/**
+Write the first lines of sample-events.jsonl to a file in dir, to replay the events up to some transaction.
+ */
+func sampleEvents(t *testing.T, dir string, lines int) string {
+	t.Helper()
+	sample, err := ioutil.ReadFile("sample-events.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "events.jsonl")
+	if err = ioutil.WriteFile(path, []byte(strings.Join(strings.SplitN(string(sample), "\n", lines+1)[:lines], "\n")), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+/**
+Replay the events of path from the checkpoint of store, the way the listener does on start. Returns the transactions
+that were applied.
+ */
+func replay(t *testing.T, store *Store, path string) []string {
+	t.Helper()
+	checkpoint, err := store.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := NewFileSource(path)
+	defer source.Close()
+	events, err := source.Subscribe(checkpoint.BlockNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var applied []string
+	for event := range events {
+		before, _ := store.Checkpoint()
+		if err := project(store, event); err != nil {
+			t.Fatal(err)
+		}
+		if after, _ := store.Checkpoint(); after.BlockNumber != before.BlockNumber || len(after.TxIds) != len(before.TxIds) {
+			applied = append(applied, event.TxId)
+		}
+	}
+	return applied
+}
+
+func TestReplaySampleEvents(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	store := openTestStore(t, dir)
+	defer store.Close()
+	if applied := replay(t, store, "sample-events.jsonl"); len(applied) != 5 {
+		t.Fatalf("applied %v", applied)
+	}
+
+	asset, err := store.Asset(SAMPLE_ASSET)
+	if err != nil || asset == nil {
+		t.Fatalf("asset is %+v : %v", asset, err)
+	}
+	if asset.Name != "Oil on canvas" || asset.Seller != "seller@example.com" || asset.Owner != "bob@example.com" ||
+		asset.Category != "paintings" || asset.Currency != DEFAULT_CURRENCY || asset.Price != "100.00" {
+		t.Fatalf("listing is projected as %+v", asset)
+	}
+	if asset.Bidders != 2 || asset.HighBidder != "bob@example.com" || asset.HighBid != "150.00" {
+		t.Fatalf("bids are projected as %+v", asset)
+	}
+	if !asset.BidEnd.Equal(time.Date(2018, 10, 2, 12, 0, 0, 0, time.UTC)) || !asset.ListedAt.Equal(time.Date(2018, 10, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Fatalf("auction times are projected as %v to %v", asset.ListedAt, asset.BidEnd)
+	}
+	if !asset.IsSold || asset.SoldPrice != "150.00" {
+		t.Fatalf("sale is projected as %+v", asset)
+	}
+
+	bids, err := store.Bids(SAMPLE_ASSET)
+	if err != nil || len(bids) != 2 || bids[0].Bidder != "alice@example.com" || bids[0].BidAmount != "120.00" ||
+		bids[1].Bidder != "bob@example.com" || bids[1].TxId != "tx-bid-2" {
+		t.Fatalf("bids are %+v : %v", bids, err)
+	}
+
+	settlements, err := store.Settlements(func(*SettlementView) bool { return true })
+	if err != nil || len(settlements) != 1 || settlements[0].Winner != "bob@example.com" || settlements[0].BidderCount != 2 ||
+		settlements[0].HammerPrice != "150.00" || settlements[0].BlockNumber != 12 || settlements[0].TxId != "tx-close" {
+		t.Fatalf("settlements are %+v : %v", settlements, err)
+	}
+
+	for email, want := range map[string]string{"bob@example.com": "850.00", "seller@example.com": "150.00"} {
+		balances, err := store.Balances(email)
+		if err != nil || len(balances) != 1 || balances[0].Currency != DEFAULT_CURRENCY || balances[0].Balance != Amount(want) {
+			t.Fatalf("balances of %v are %+v : %v", email, balances, err)
+		}
+	}
+}
+
+func TestReplayResumesFromCheckpoint(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	store := openTestStore(t, dir)
+	//the listener stops after the first bid of block 7
+	if applied := replay(t, store, sampleEvents(t, dir, 2)); strings.Join(applied, " ") != "tx-listing tx-bid-1" {
+		t.Fatalf("applied %v", applied)
+	}
+	store.Close()
+
+	store = openTestStore(t, dir)
+	defer store.Close()
+	checkpoint, err := store.Checkpoint()
+	if err != nil || checkpoint.BlockNumber != 7 || len(checkpoint.TxIds) != 1 || !checkpoint.TxIds["tx-bid-1"] {
+		t.Fatalf("checkpoint is %+v : %v", checkpoint, err)
+	}
+
+	//block 7 is delivered again, only the bid that was not applied is
+	if applied := replay(t, store, "sample-events.jsonl"); strings.Join(applied, " ") != "tx-bid-2 tx-extend tx-close" {
+		t.Fatalf("after the restart applied %v", applied)
+	}
+	if asset, _ := store.Asset(SAMPLE_ASSET); asset.Bidders != 2 || !asset.IsSold {
+		t.Fatalf("asset is %+v", asset)
+	}
+	if checkpoint, _ := store.Checkpoint(); checkpoint.BlockNumber != 12 || len(checkpoint.TxIds) != 1 || !checkpoint.TxIds["tx-close"] {
+		t.Fatalf("checkpoint is %+v", checkpoint)
+	}
+
+	//a block before the checkpoint is never applied again
+	applied, err := store.Apply(&BlockEvent{BlockNumber: 9, TxId: "tx-late"}, &EventEnvelope{Version: 1})
+	if err != nil || applied {
+		t.Fatalf("a transaction of block 9 is applied after block 12 : %v", err)
+	}
+	if applied := replay(t, store, "sample-events.jsonl"); len(applied) != 0 {
+		t.Fatalf("a third replay applied %v", applied)
+	}
+}
+
+func TestAmountKeepsTheChaincodeEncoding(t *testing.T) {
+	var placed BidPlacedEvent
+	if err := json.Unmarshal([]byte(`{"assetId":"a","bidAmount":"12.50"}`), &placed); err != nil || placed.BidAmount != "12.50" {
+		t.Fatalf("bid amount is read as %q : %v", placed.BidAmount, err)
+	}
+	served, err := json.Marshal(BidView{AssetId: "a", BidAmount: placed.BidAmount})
+	if err != nil || !strings.Contains(string(served), `"bidAmount":"12.50"`) {
+		t.Fatalf("bid is served as %s : %v", served, err)
+	}
+	if err := json.Unmarshal([]byte(`{"bidAmount":"twelve"}`), &placed); err == nil {
+		t.Fatalf("read %q as an amount", placed.BidAmount)
+	}
+
+	//fractions written before the chaincode kept decimals compare by value
+	for _, want := range []struct {
+		a, b Amount
+		cmp  int
+	}{{"12.50", "25/2", 0}, {"150", "150.00", 0}, {"120.00", "150", -1}, {"1000", "999.99", 1}} {
+		if cmp := want.a.Cmp(want.b); cmp != want.cmp {
+			t.Errorf("%v compared with %v is %v, want %v", want.a, want.b, cmp, want.cmp)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+)
+
+// FabricTransport calls the chaincode through the Fabric Go SDK as an auction
+// house user. The closing functions are restricted to Org2.
+type FabricTransport struct {
+	sdk         *fabsdk.FabricSDK
+	client      *channel.Client
+	chaincodeId string
+}
+
+func NewFabricTransport(configPath string, channelId string, chaincodeId string, user string, org string) (*FabricTransport, error) {
+	sdk, err := fabsdk.New(config.FromFile(configPath))
+	if err != nil {
+		return nil, fmt.Errorf("creating the Fabric SDK failed : %v", err)
+	}
+	client, err := channel.New(sdk.ChannelContext(channelId, fabsdk.WithUser(user), fabsdk.WithOrg(org)))
+	if err != nil {
+		sdk.Close()
+		return nil, fmt.Errorf("creating the channel client failed : %v", err)
+	}
+	return &FabricTransport{sdk, client, chaincodeId}, nil
+}
+
+func (t *FabricTransport) Query(fcn string, args ...string) ([]byte, error) {
+	response, err := t.client.Query(t.request(fcn, args))
+	if err != nil {
+		return nil, err
+	}
+	return response.Payload, nil
+}
+
+func (t *FabricTransport) Invoke(fcn string, args ...string) ([]byte, error) {
+	response, err := t.client.Execute(t.request(fcn, args))
+	if err != nil {
+		return nil, err
+	}
+	return response.Payload, nil
+}
+
+func (t *FabricTransport) Close() {
+	t.sdk.Close()
+}
+
+func (t *FabricTransport) request(fcn string, args []string) channel.Request {
+	byteArgs := make([][]byte, len(args))
+	for i, arg := range args {
+		byteArgs[i] = []byte(arg)
+	}
+	return channel.Request{ChaincodeID: t.chaincodeId, Fcn: fcn, Args: byteArgs}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+var Logger = log.New(os.Stderr, "auction-scheduler ", log.LstdFlags)
+
+/**
+Closes auctions as their bidding ends instead of sweeping on a fixed interval.
+ */
+func main() {
+	configPath := flag.String("config", "../artifacts/network-config.yaml", "Fabric SDK connection profile")
+	channelId := flag.String("channel", "mychannel", "channel of the auction chaincode")
+	chaincodeId := flag.String("chaincode", "mycc", "name of the auction chaincode")
+	user := flag.String("user", "auctionhouse", "auction house identity used to close auctions")
+	org := flag.String("org", "Org2", "organization of the identity")
+	memoryAssets := flag.String("memory", "", "run against an in-memory ledger loaded from this JSON file instead of the peers")
+	refresh := flag.Duration("refresh", time.Minute, "how often the schedule is reloaded from the ledger")
+	batchThreshold := flag.Int("batch-threshold", 10, "sweep with getBidResult when more auctions than this are due")
+	batchSize := flag.Int("batch-size", 100, "page size of getBidResult")
+	maxAttempts := flag.Int("max-attempts", 5, "submissions of a transaction that keeps hitting MVCC conflicts")
+	backoff := flag.Duration("backoff", 500*time.Millisecond, "delay after the first MVCC conflict, doubled after every further one")
+	flag.Parse()
+
+	var transport Transport
+	var err error
+	if len(*memoryAssets) > 0 {
+		transport, err = LoadMemoryTransport(*memoryAssets)
+	} else {
+		transport, err = NewFabricTransport(*configPath, *channelId, *chaincodeId, *user, *org)
+	}
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	defer transport.Close()
+
+	scheduler := NewScheduler(transport)
+	scheduler.RefreshEvery = *refresh
+	scheduler.BatchThreshold = *batchThreshold
+	scheduler.BatchSize = *batchSize
+	scheduler.MaxAttempts = *maxAttempts
+	scheduler.Backoff = *backoff
+
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		close(stop)
+	}()
+	scheduler.Run(stop)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryTransport stands in for the chaincode. It knows just enough of
+// searchAssets, closeAuction, getBidResult and getSettlementsForAsset to drive
+// the scheduler, and can be told to fail transactions with an MVCC conflict.
+type MemoryTransport struct {
+	mutex       sync.Mutex
+	assets      map[string]*MemoryAsset
+	conflicts   int
+	Invocations []string
+}
+
+// MemoryAsset is an asset of the in-memory ledger with the highest bid on it.
+type MemoryAsset struct {
+	AssetId string     `json:"assetId"`
+	BidEnd  *time.Time `json:"bidEnd"`
+	IsSold  bool       `json:"isSold,omitempty"`
+	HighBid string     `json:"highBid,omitempty"`
+	Bidder  string     `json:"bidder,omitempty"`
+}
+
+func NewMemoryTransport(assets ...MemoryAsset) *MemoryTransport {
+	t := &MemoryTransport{assets: make(map[string]*MemoryAsset)}
+	for i := range assets {
+		t.assets[assets[i].AssetId] = &assets[i]
+	}
+	return t
+}
+
+/**
+Load the assets of the in-memory ledger from a JSON array of MemoryAsset.
+ */
+func LoadMemoryTransport(path string) (*MemoryTransport, error) {
+	assetsBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var assets []MemoryAsset
+	if err = json.Unmarshal(assetsBytes, &assets); err != nil {
+		return nil, err
+	}
+	return NewMemoryTransport(assets...), nil
+}
+
+// FailNext makes the next n invocations fail with an MVCC read conflict.
+func (t *MemoryTransport) FailNext(n int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.conflicts = n
+}
+
+func (t *MemoryTransport) Query(fcn string, args ...string) ([]byte, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	switch fcn {
+	case "searchAssets":
+		var search AssetSearch
+		if err := json.Unmarshal([]byte(args[0]), &search); err != nil {
+			return nil, err
+		}
+		var unsold []*MemoryAsset
+		for _, asset := range t.assets {
+			if !asset.IsSold && asset.BidEnd != nil {
+				unsold = append(unsold, asset)
+			}
+		}
+		sort.Slice(unsold, func(i, j int) bool { return unsold[i].BidEnd.Before(*unsold[j].BidEnd) })
+		page := AssetList{Items: make([]Asset, 0)}
+		for _, asset := range unsold {
+			page.Items = append(page.Items, Asset{AssetId: asset.AssetId, BidEnd: asset.BidEnd})
+		}
+		page.Count = len(page.Items)
+		return json.Marshal(page)
+	case "getSettlementsForAsset":
+		settlements := SettlementList{Items: make([]Settlement, 0)}
+		if asset := t.assets[args[0]]; asset != nil && asset.IsSold {
+			settlements.Items = append(settlements.Items, Settlement{AssetId: asset.AssetId, WinnerEmail: asset.Bidder, WinningBid: asset.HighBid})
+		}
+		settlements.Count = len(settlements.Items)
+		return json.Marshal(settlements)
+	}
+	return nil, fmt.Errorf("unknown query %v", fcn)
+}
+
+func (t *MemoryTransport) Invoke(fcn string, args ...string) ([]byte, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.Invocations = append(t.Invocations, fcn)
+	if t.conflicts > 0 {
+		t.conflicts--
+		return nil, errors.New("transaction invalidated with status (MVCC_READ_CONFLICT)")
+	}
+	now, err := time.Parse(time.RFC3339, args[0])
+	if err != nil {
+		return nil, err
+	}
+	switch fcn {
+	case "closeAuction":
+		asset := t.assets[args[1]]
+		switch {
+		case asset == nil:
+			return nil, fmt.Errorf("Asset : %v is not found", args[1])
+		case asset.IsSold:
+			return nil, fmt.Errorf("Asset : %v is already sold", args[1])
+		case !asset.BidEnd.Before(now):
+			return nil, fmt.Errorf("Asset : %v bidding has not ended yet", args[1])
+		case len(asset.Bidder) == 0:
+			return nil, fmt.Errorf("Asset : %v did not receive any bid", args[1])
+		}
+		asset.IsSold = true
+		return t.respond(Settlement{AssetId: asset.AssetId, WinnerEmail: asset.Bidder, WinningBid: asset.HighBid})
+	case "getBidResult":
+		var result BatchResult
+		for _, asset := range t.assets {
+			if asset.IsSold || !asset.BidEnd.Before(now) {
+				continue
+			}
+			result.Processed++
+			if len(asset.Bidder) > 0 {
+				asset.IsSold = true
+				result.Settled++
+			}
+		}
+		return t.respond(result)
+	}
+	return nil, fmt.Errorf("unknown invoke %v", fcn)
+}
+
+// respond wraps entity in an InvokeResponse the way the chaincode does.
+func (t *MemoryTransport) respond(entity interface{}) ([]byte, error) {
+	entityBytes, err := json.Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(InvokeResponse{Status: "OK", TxId: fmt.Sprintf("memory%d", len(t.Invocations)), Entity: entityBytes})
+}
+
+func (t *MemoryTransport) Close() {
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	SEARCH_PAGE_SIZE = 200
+)
+
+// Scheduler keeps the end of bidding of every unsold asset and closes the
+// auctions once they are due. The schedule is refreshed from the ledger every
+// RefreshEvery so that new listings and extended auctions are picked up.
+type Scheduler struct {
+	Transport Transport
+	// RefreshEvery is how often the schedule is reloaded from the ledger.
+	RefreshEvery time.Duration
+	// BatchThreshold is the number of due auctions above which the scheduler
+	// sweeps with getBidResult instead of closing them one by one.
+	BatchThreshold int
+	// BatchSize is the page size given to getBidResult.
+	BatchSize int
+	// MaxAttempts bounds the submissions of a transaction that keeps
+	// hitting MVCC conflicts. Backoff is the delay after the first conflict,
+	// doubled after every further one.
+	MaxAttempts int
+	Backoff     time.Duration
+
+	now   func() time.Time
+	sleep func(time.Duration)
+
+	bidEnds     map[string]time.Time
+	attempted   map[string]time.Time
+	lastRefresh time.Time
+}
+
+func NewScheduler(transport Transport) *Scheduler {
+	return &Scheduler{
+		Transport:      transport,
+		RefreshEvery:   time.Minute,
+		BatchThreshold: 10,
+		BatchSize:      100,
+		MaxAttempts:    5,
+		Backoff:        500 * time.Millisecond,
+		now:            time.Now,
+		sleep:          time.Sleep,
+		bidEnds:        make(map[string]time.Time),
+		attempted:      make(map[string]time.Time),
+	}
+}
+
+/**
+Reload the end of bidding of every unsold asset.
+ */
+func (s *Scheduler) Refresh() error {
+	bidEnds := make(map[string]time.Time)
+	search := AssetSearch{Filter: &AssetFilter{Status: "unsold"}, SortBy: "bidEnd", PageSize: SEARCH_PAGE_SIZE}
+	for {
+		searchBytes, err := json.Marshal(search)
+		if err != nil {
+			return err
+		}
+		pageBytes, err := s.Transport.Query("searchAssets", string(searchBytes))
+		if err != nil {
+			return fmt.Errorf("searching unsold assets failed : %v", err)
+		}
+		var page AssetList
+		if err = json.Unmarshal(pageBytes, &page); err != nil {
+			return err
+		}
+		for _, asset := range page.Items {
+			if asset.BidEnd != nil {
+				bidEnds[asset.AssetId] = *asset.BidEnd
+			}
+		}
+		if page.Count < int(search.PageSize) || len(page.Bookmark) == 0 {
+			break
+		}
+		search.Bookmark = page.Bookmark
+	}
+	//forget the attempts on assets that are gone or whose auction was extended since
+	for assetId, bidEnd := range s.attempted {
+		if current, ok := bidEnds[assetId]; !ok || !current.Equal(bidEnd) {
+			delete(s.attempted, assetId)
+		}
+	}
+	s.bidEnds = bidEnds
+	s.lastRefresh = s.now()
+	Logger.Printf("schedule refreshed : %v unsold assets", len(bidEnds))
+	return nil
+}
+
+/**
+The assets whose bidding ended before now and that have not been tried since, earliest first.
+ */
+func (s *Scheduler) Due(now time.Time) []string {
+	var due []string
+	for assetId, bidEnd := range s.bidEnds {
+		if _, tried := s.attempted[assetId]; !tried && bidEnd.Before(now) {
+			due = append(due, assetId)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		left, right := s.bidEnds[due[i]], s.bidEnds[due[j]]
+		return left.Before(right) || (left.Equal(right) && due[i] < due[j])
+	})
+	return due
+}
+
+/**
+When the scheduler has to wake up next: at the next end of bidding or the next refresh, whichever comes first.
+ */
+func (s *Scheduler) NextWakeUp() time.Time {
+	wakeUp := s.lastRefresh.Add(s.RefreshEvery)
+	for assetId, bidEnd := range s.bidEnds {
+		if _, tried := s.attempted[assetId]; tried {
+			continue
+		}
+		//the chaincode closes an auction once its end is strictly before the time it is given, which is in seconds
+		closable := bidEnd.Truncate(time.Second).Add(time.Second)
+		if closable.Before(wakeUp) {
+			wakeUp = closable
+		}
+	}
+	return wakeUp
+}
+
+/**
+Close the auctions that are due and log the outcome of each.
+ */
+func (s *Scheduler) CloseDue() error {
+	now := s.now().UTC().Truncate(time.Second)
+	due := s.Due(now)
+	if len(due) == 0 {
+		return nil
+	}
+	currentTime := now.Format(time.RFC3339)
+	if len(due) > s.BatchThreshold {
+		return s.sweep(currentTime, due)
+	}
+	for _, assetId := range due {
+		settlementBytes, err := s.invoke("closeAuction", currentTime, assetId)
+		s.attempted[assetId] = s.bidEnds[assetId]
+		if err != nil {
+			Logger.Printf("asset %v not settled : %v", assetId, err)
+			continue
+		}
+		var settlement Settlement
+		if err = decodeEntity(settlementBytes, &settlement); err != nil {
+			return err
+		}
+		Logger.Printf("asset %v settled : sold to %v for %v", assetId, settlement.WinnerEmail, formatAmount(settlement.WinningBid, settlement.Currency))
+	}
+	return nil
+}
+
+func (s *Scheduler) sweep(currentTime string, due []string) error {
+	var total BatchResult
+	bookmark := ""
+	for {
+		resultBytes, err := s.invoke("getBidResult", currentTime, strconv.Itoa(s.BatchSize), bookmark)
+		if err != nil {
+			return fmt.Errorf("closing %v due auctions failed : %v", len(due), err)
+		}
+		var result BatchResult
+		if err = decodeEntity(resultBytes, &result); err != nil {
+			return err
+		}
+		total.Processed += result.Processed
+		total.Settled += result.Settled
+		total.Failed += result.Failed
+		if len(result.Bookmark) == 0 {
+			break
+		}
+		bookmark = result.Bookmark
+	}
+	Logger.Printf("sweep at %v : processed %v settled %v failed %v", currentTime, total.Processed, total.Settled, total.Failed)
+
+	//the sweep only returns counts, look up what happened to each auction
+	for _, assetId := range due {
+		s.attempted[assetId] = s.bidEnds[assetId]
+		settlementsBytes, err := s.Transport.Query("getSettlementsForAsset", assetId)
+		if err != nil {
+			Logger.Printf("asset %v outcome unknown : %v", assetId, err)
+			continue
+		}
+		var settlements SettlementList
+		if err = json.Unmarshal(settlementsBytes, &settlements); err != nil {
+			return err
+		}
+		if len(settlements.Items) == 0 {
+			Logger.Printf("asset %v not settled", assetId)
+			continue
+		}
+		settlement := settlements.Items[len(settlements.Items)-1]
+		Logger.Printf("asset %v settled : sold to %v for %v", assetId, settlement.WinnerEmail, formatAmount(settlement.WinningBid, settlement.Currency))
+	}
+	return nil
+}
+
+/**
+Submit a transaction, submitting it again after a growing, jittered delay while it loses MVCC races.
+ */
+func (s *Scheduler) invoke(fcn string, args ...string) ([]byte, error) {
+	delay := s.Backoff
+	for attempt := 1; ; attempt++ {
+		payload, err := s.Transport.Invoke(fcn, args...)
+		if !isConflict(err) || attempt >= s.MaxAttempts {
+			return payload, err
+		}
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay)/2+1))
+		Logger.Printf("%v hit a conflict on attempt %v, retrying in %v", fcn, attempt, wait)
+		s.sleep(wait)
+		delay *= 2
+	}
+}
+
+/**
+Close auctions as they become due until stop is closed.
+ */
+func (s *Scheduler) Run(stop <-chan struct{}) {
+	for {
+		if !s.now().Before(s.lastRefresh.Add(s.RefreshEvery)) {
+			if err := s.Refresh(); err != nil {
+				Logger.Printf("refreshing the schedule failed : %v", err)
+				//try again at the next refresh
+				s.lastRefresh = s.now()
+			}
+		}
+		if err := s.CloseDue(); err != nil {
+			Logger.Printf("closing auctions failed : %v", err)
+		}
+
+		timer := time.NewTimer(s.NextWakeUp().Sub(s.now()))
+		select {
+		case <-timer.C:
+		case <-stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func formatAmount(amount string, currency string) string {
+	if len(amount) == 0 {
+		return "-"
+	}
+	if len(currency) == 0 {
+		return amount
+	}
+	return amount + " " + currency
+}
+
+/**
+Decode the entity of the InvokeResponse a transaction returned.
+ */
+func decodeEntity(payload []byte, entity interface{}) error {
+	var response InvokeResponse
+	if err := json.Unmarshal(payload, &response); err != nil {
+		return err
+	}
+	return json.Unmarshal(response.Entity, entity)
+}
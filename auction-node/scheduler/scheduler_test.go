@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testClock is the time of a test scheduler and the delays it slept for.
+type testClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func newTestScheduler(transport Transport, clock *testClock) *Scheduler {
+	scheduler := NewScheduler(transport)
+	scheduler.RefreshEvery = time.Hour
+	scheduler.now = func() time.Time { return clock.now }
+	scheduler.sleep = func(delay time.Duration) { clock.sleeps = append(clock.sleeps, delay) }
+	return scheduler
+}
+
+func at(hour int, minute int, second int, nanosecond int) *time.Time {
+	t := time.Date(2018, 10, 2, hour, minute, second, nanosecond, time.UTC)
+	return &t
+}
+
+func asset(assetId string, bidEnd *time.Time, bidder string) MemoryAsset {
+	memoryAsset := MemoryAsset{AssetId: assetId, BidEnd: bidEnd}
+	if len(bidder) > 0 {
+		memoryAsset.HighBid, memoryAsset.Bidder = "150.00", bidder
+	}
+	return memoryAsset
+}
+
+/**
+Change an asset of the in-memory ledger the way a transaction of another client would.
+ */
+func (t *MemoryTransport) update(assetId string, change func(asset *MemoryAsset)) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	change(t.assets[assetId])
+}
+
+func (t *MemoryTransport) isSold(assetId string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.assets[assetId].IsSold
+}
+
+func TestDueAndNextWakeUp(t *testing.T) {
+	sold := asset("sold", at(9, 0, 0, 0), "bob@example.com")
+	sold.IsSold = true
+	transport := NewMemoryTransport(asset("late", at(11, 0, 0, 0), ""), asset("half", at(10, 0, 0, 500000000), ""),
+		asset("second", at(9, 30, 0, 0), ""), asset("first", at(9, 30, 0, 0), ""), sold)
+	clock := &testClock{now: *at(9, 0, 0, 0)}
+	scheduler := newTestScheduler(transport, clock)
+	scheduler.RefreshEvery = 3 * time.Hour
+	if err := scheduler.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		now  *time.Time
+		want string
+	}{
+		{at(9, 30, 0, 0), ""},
+		{at(9, 30, 1, 0), "first second"},
+		{at(10, 0, 0, 0), "first second"},
+		{at(10, 0, 1, 0), "first second half"},
+		{at(12, 0, 0, 0), "first second half late"},
+	} {
+		if due := strings.Join(scheduler.Due(*c.now), " "); due != c.want {
+			t.Errorf("due at %v are %q, want %q", c.now.Format(time.RFC3339), due, c.want)
+		}
+	}
+
+	//the chaincode is given whole seconds and closes auctions that ended strictly before
+	if wakeUp := scheduler.NextWakeUp(); !wakeUp.Equal(*at(9, 30, 1, 0)) {
+		t.Fatalf("wakes up at %v", wakeUp)
+	}
+	scheduler.RefreshEvery = 10 * time.Minute
+	if wakeUp := scheduler.NextWakeUp(); !wakeUp.Equal(*at(9, 10, 0, 0)) {
+		t.Fatalf("wakes up at %v before the refresh", wakeUp)
+	}
+	scheduler.RefreshEvery = 3 * time.Hour
+
+	clock.now = *at(9, 45, 0, 0)
+	if err := scheduler.CloseDue(); err != nil {
+		t.Fatal(err)
+	}
+	if wakeUp := scheduler.NextWakeUp(); !wakeUp.Equal(*at(10, 0, 1, 0)) {
+		t.Fatalf("after closing the first two wakes up at %v", wakeUp)
+	}
+}
+
+func TestCloseDueRetriesConflicts(t *testing.T) {
+	transport := NewMemoryTransport(asset("vase", at(10, 0, 0, 0), "bob@example.com"), asset("lamp", at(10, 30, 0, 0), "carol@example.com"))
+	clock := &testClock{now: *at(10, 15, 0, 0)}
+	scheduler := newTestScheduler(transport, clock)
+	scheduler.Backoff = 100 * time.Millisecond
+	scheduler.MaxAttempts = 3
+	if err := scheduler.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	transport.FailNext(2)
+	if err := scheduler.CloseDue(); err != nil {
+		t.Fatal(err)
+	}
+	if len(transport.Invocations) != 3 || !transport.isSold("vase") {
+		t.Fatalf("invocations are %v", transport.Invocations)
+	}
+	//the delay doubles after every conflict, jittered down to half of it
+	if len(clock.sleeps) != 2 || clock.sleeps[0] < 50*time.Millisecond || clock.sleeps[0] > 100*time.Millisecond ||
+		clock.sleeps[1] < 100*time.Millisecond || clock.sleeps[1] > 200*time.Millisecond {
+		t.Fatalf("slept %v", clock.sleeps)
+	}
+
+	//a transaction that keeps losing is given up after MaxAttempts and not tried again
+	clock.now, clock.sleeps, transport.Invocations = *at(10, 45, 0, 0), nil, nil
+	transport.FailNext(5)
+	if err := scheduler.CloseDue(); err != nil {
+		t.Fatal(err)
+	}
+	if len(transport.Invocations) != 3 || len(clock.sleeps) != 2 || transport.isSold("lamp") {
+		t.Fatalf("invocations are %v after sleeping %v", transport.Invocations, clock.sleeps)
+	}
+	if due := scheduler.Due(clock.now); len(due) != 0 {
+		t.Fatalf("%v are due again", due)
+	}
+	if wakeUp := scheduler.NextWakeUp(); !wakeUp.Equal(*at(11, 15, 0, 0)) {
+		t.Fatalf("wakes up at %v instead of the next refresh", wakeUp)
+	}
+}
+
+func TestCloseDueSweepsAboveThreshold(t *testing.T) {
+	transport := NewMemoryTransport(asset("a1", at(10, 0, 0, 0), "alice@example.com"), asset("a2", at(10, 5, 0, 0), "bob@example.com"),
+		asset("a3", at(10, 10, 0, 0), ""), asset("a4", at(12, 0, 0, 0), "carol@example.com"))
+	clock := &testClock{now: *at(10, 30, 0, 0)}
+	scheduler := newTestScheduler(transport, clock)
+	scheduler.BatchThreshold = 2
+	if err := scheduler.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := scheduler.CloseDue(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(transport.Invocations, " ") != "getBidResult" {
+		t.Fatalf("three due auctions are closed with %v", transport.Invocations)
+	}
+	for assetId, want := range map[string]bool{"a1": true, "a2": true, "a3": false, "a4": false} {
+		if transport.isSold(assetId) != want {
+			t.Errorf("%v sold is %v", assetId, !want)
+		}
+	}
+	if due := scheduler.Due(clock.now); len(due) != 0 {
+		t.Fatalf("%v are due after the sweep", due)
+	}
+
+	//a single auction due is closed on its own
+	clock.now = *at(12, 0, 1, 0)
+	if err := scheduler.CloseDue(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(transport.Invocations, " ") != "getBidResult closeAuction" || !transport.isSold("a4") {
+		t.Fatalf("invocations are %v", transport.Invocations)
+	}
+}
+
+func TestRefreshRearmsExtendedAuction(t *testing.T) {
+	transport := NewMemoryTransport(asset("vase", at(10, 0, 0, 0), ""))
+	clock := &testClock{now: *at(10, 30, 0, 0)}
+	scheduler := newTestScheduler(transport, clock)
+	if err := scheduler.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	//without a bid the auction cannot be closed
+	if err := scheduler.CloseDue(); err != nil {
+		t.Fatal(err)
+	}
+	if len(transport.Invocations) != 1 || transport.isSold("vase") {
+		t.Fatalf("invocations are %v", transport.Invocations)
+	}
+
+	//a refresh that finds the same end of bidding does not try again
+	clock.now = *at(11, 30, 0, 0)
+	if err := scheduler.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if due := scheduler.Due(clock.now); len(due) != 0 {
+		t.Fatalf("%v are due again", due)
+	}
+
+	//the auction house extends the auction and a bid arrives
+	transport.update("vase", func(asset *MemoryAsset) {
+		asset.BidEnd, asset.HighBid, asset.Bidder = at(12, 0, 0, 0), "120.00", "bob@example.com"
+	})
+	if err := scheduler.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if wakeUp := scheduler.NextWakeUp(); !wakeUp.Equal(*at(12, 0, 1, 0)) {
+		t.Fatalf("the extended auction wakes the scheduler at %v", wakeUp)
+	}
+	clock.now = *at(12, 0, 1, 0)
+	if err := scheduler.CloseDue(); err != nil {
+		t.Fatal(err)
+	}
+	if len(transport.Invocations) != 2 || !transport.isSold("vase") {
+		t.Fatalf("invocations are %v", transport.Invocations)
+	}
+}
+
+func TestSettlementKeepsTheChaincodeEncoding(t *testing.T) {
+	var settlement Settlement
+	if err := json.Unmarshal([]byte(`{"assetId":"a","winningBid":"12.50","currency":"USD"}`), &settlement); err != nil {
+		t.Fatal(err)
+	}
+	if amount := formatAmount(settlement.WinningBid, settlement.Currency); amount != "12.50 USD" {
+		t.Fatalf("winning bid is logged as %v", amount)
+	}
+	if amount := formatAmount("", "USD"); amount != "-" {
+		t.Fatalf("missing winning bid is logged as %v", amount)
+	}
+}
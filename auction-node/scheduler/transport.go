@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+)
+
+// Transport submits chaincode functions on behalf of the scheduler. Invoke
+// waits for the transaction to commit and fails when it is invalidated.
+type Transport interface {
+	Query(fcn string, args ...string) ([]byte, error)
+	Invoke(fcn string, args ...string) ([]byte, error)
+	Close()
+}
+
+// Validation codes of a transaction that lost a race with another one. Such a
+// transaction changed nothing and can be submitted again.
+var conflictCodes = []string{"MVCC_READ_CONFLICT", "PHANTOM_READ_CONFLICT"}
+
+func isConflict(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, code := range conflictCodes {
+		if strings.Contains(err.Error(), code) {
+			return true
+		}
+	}
+	return false
+}
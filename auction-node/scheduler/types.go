@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// The parts of the chaincode documents the scheduler reads, see
+// artifacts/src/com.ornobchatterjee/chaincode/auction/structs.go
+
+type Asset struct {
+	AssetId string     `json:"assetId,omitempty"`
+	Name    string     `json:"name,omitempty"`
+	BidEnd  *time.Time `json:"bidEnd,omitempty"`
+	IsSold  bool       `json:"isSold,omitempty"`
+}
+
+type AssetFilter struct {
+	Status string `json:"status,omitempty"`
+}
+
+type AssetSearch struct {
+	Filter   *AssetFilter `json:"filter,omitempty"`
+	SortBy   string       `json:"sortBy,omitempty"`
+	PageSize int32        `json:"pageSize,omitempty"`
+	Bookmark string       `json:"bookmark,omitempty"`
+}
+
+// InvokeResponse is what every invoke returns. Entity is left for the caller
+// to decode, the events are not needed.
+type InvokeResponse struct {
+	Status string          `json:"status"`
+	TxId   string          `json:"txId"`
+	Entity json.RawMessage `json:"entity,omitempty"`
+}
+
+// The ListResponse of searchAssets and getSettlementsForAsset.
+
+type AssetList struct {
+	Items    []Asset `json:"items"`
+	Bookmark string  `json:"bookmark"`
+	Count    int     `json:"count"`
+}
+
+type SettlementList struct {
+	Items    []Settlement `json:"items"`
+	Bookmark string       `json:"bookmark"`
+	Count    int          `json:"count"`
+}
+
+type BatchResult struct {
+	Processed int    `json:"processed"`
+	Settled   int    `json:"settled"`
+	Failed    int    `json:"failed"`
+	Bookmark  string `json:"bookmark"`
+}
+
+// The winning bid is kept as the decimal string the chaincode encodes, such as
+// "12.50", since the scheduler only logs it.
+type Settlement struct {
+	AssetId     string `json:"assetId,omitempty"`
+	WinnerEmail string `json:"winnerEmail,omitempty"`
+	WinningBid  string `json:"winningBid,omitempty"`
+	Currency    string `json:"currency,omitempty"`
+}
@@ -36,19 +36,42 @@ var userRegistration = async function () {
         let newUserObj = Object.assign({}, userObj);
         delete newUserObj["balance"];
         userTokenObj.push({ "user": newUserObj, "tokenId": token });
-        let attributes = helper.convertUserAttributes(userObj, ["email", "org"]);
+        let attributes = helper.convertUserAttributes(userObj, ["email", "org", "role"]);
         let response = await helper.getRegisteredUser(userObj["userId"], userObj["org"], attributes, true);
         if (response && typeof response !== 'string') {
             logger.debug('Successfully registered the username %s for organization %s', userObj["userId"], userObj["org"]);
         } else {
             logger.debug('Failed to register the username %s for organization %s with::%s', userObj["userId"], userObj["org"], response);
         }
-        let args = [JSON.stringify(userObj)];
+        //the role is only an attribute of the certificate and the balance is granted on approval
+        let chaincodeUserObj = Object.assign({}, userObj);
+        delete chaincodeUserObj["role"];
+        delete chaincodeUserObj["balance"];
+        let args = [JSON.stringify(chaincodeUserObj)];
         let message = await invoke.invokeChaincode(hfc.getConfigSetting('peers'), hfc.getConfigSetting('channelName'), hfc.getConfigSetting('chaincodeName'), "addUser", args, userObj["userId"], userObj["org"]);
         logger.debug('Response from invoke of addUser %s', message);
     }
+    await approveUsers(users);
     writeTokenToFile(userTokenObj);
 };
+//new users wait for the auction house to approve them, the balance in the user file is their credit limit
+var approveUsers = async function (users) {
+    let house = users.find(userObj => userObj["org"] === "Org2");
+    if (!house) {
+        logger.debug('No auction house user to approve the users with');
+        return;
+    }
+    for (let index in users) {
+        let userObj = users[index];
+        let approval = { "email": userObj["email"] };
+        if (userObj["balance"]) {
+            approval["creditLimit"] = userObj["balance"];
+        }
+        let args = [JSON.stringify(approval)];
+        let message = await invoke.invokeChaincode(hfc.getConfigSetting('peers'), hfc.getConfigSetting('channelName'), hfc.getConfigSetting('chaincodeName'), "approveUser", args, house["userId"], house["org"]);
+        logger.debug('Response from invoke of approveUser %s', message);
+    }
+};
 var writeTokenToFile = function (userTokens) {
     var filePath = hfc.getConfigSetting('tokenFilePath');
     if (fs.existsSync(filePath)) {
@@ -251,6 +251,9 @@ echo
 # echo
 # echo
 
+# Chaincode behaviour is regression tested without a network by the scenario runner:
+#   cd artifacts/src/com.ornobchatterjee/chaincode/auction && go test -run TestScenarios -v
+# The runner is part of the chaincode tests only, see the chaincode README.md and testdata/scenarios there.
 
 # echo "Total execution time : $(($(date +%s)-starttime)) secs ..."
 echo "Setup"